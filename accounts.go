@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/GaPhi/gphotosuploader/auth"
+	"github.com/GaPhi/gphotosuploader/utils"
+)
+
+// Name of the account of the auth argument
+const defaultAccountName = "default"
+
+// Google account uploading files, with its own credentials, uploader, list of uploaded files and album cache. The
+// default account uploads the files that are not in the directories of another account
+type account struct {
+	AccountConfig
+
+	// Absolute paths of the directories
+	roots []string
+
+	credentials auth.CookieCredentials
+	uploader    *utils.ConcurrentUploader
+}
+
+var (
+	// Other accounts of the account argument or of the configuration file
+	accountConfigs AccountConfigs
+
+	// Default account, then the other accounts, once the uploads are started
+	accounts []*account
+
+	// Stores of the credentials, by client, to save the cookies refreshed with the At token
+	credentialStores = make(map[*http.Client]auth.Store)
+	storesMutex      sync.Mutex
+)
+
+// Accounts usable as a CLI argument
+type AccountConfigs []AccountConfig
+
+func (a *AccountConfigs) String() string {
+	return "Account"
+}
+
+// Parse an account written as a list of key=value separated by commas, like
+// "name=bob,auth=bob.json,dir=/photos/bob|/photos/shared/bob,maxConcurrent=2"
+func (a *AccountConfigs) Set(value string) error {
+	var config AccountConfig
+	for _, option := range strings.Split(value, ",") {
+		key, val, found := strings.Cut(strings.TrimSpace(option), "=")
+		if !found {
+			return fmt.Errorf("account option '%v' must be written as key=value", option)
+		}
+
+		var err error
+		switch key {
+		case "name":
+			config.Name = val
+		case "auth":
+			config.Auth = val
+		case "dir":
+			config.Directories = append(config.Directories, strings.Split(val, "|")...)
+		case "uploadedList":
+			config.UploadedList = val
+		case "albumCache":
+			config.AlbumCache = val
+		case "maxConcurrent":
+			config.MaxConcurrent, err = strconv.Atoi(val)
+		default:
+			err = fmt.Errorf("unknown account option '%v'", key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return a.add(config)
+}
+
+// Check an account and add it
+func (a *AccountConfigs) add(config AccountConfig) error {
+	if config.Name == "" || config.Auth == "" || len(config.Directories) == 0 {
+		return fmt.Errorf("the account '%v' needs a name, an auth store and directories", config.Name)
+	}
+	if config.Name == defaultAccountName {
+		return fmt.Errorf("the account name '%v' is reserved to the auth argument", config.Name)
+	}
+	for _, other := range *a {
+		if other.Name == config.Name {
+			return fmt.Errorf("the account '%v' is defined twice", config.Name)
+		}
+	}
+	if config.MaxConcurrent < 0 {
+		return fmt.Errorf("invalid maxConcurrent of the account '%v'", config.Name)
+	}
+	*a = append(*a, config)
+	return nil
+}
+
+// Create the default account with the credentials of the auth argument, then load the credentials of the other
+// accounts. Their list of uploaded files and album cache are named after the account by default
+func openAccounts(credentials auth.CookieCredentials) error {
+	accounts = []*account{{
+		AccountConfig: AccountConfig{
+			Name:          defaultAccountName,
+			Auth:          authFile,
+			UploadedList:  uploadedListFile,
+			AlbumCache:    albumCacheFile,
+			MaxConcurrent: maxConcurrentUploads,
+		},
+		credentials: credentials,
+	}}
+
+	for _, config := range accountConfigs {
+		acc := &account{AccountConfig: config}
+		if acc.UploadedList == "" {
+			acc.UploadedList = "uploaded-" + acc.Name + ".txt"
+		}
+		if acc.AlbumCache == "" {
+			acc.AlbumCache = "albums-" + acc.Name + ".json"
+		}
+		if acc.MaxConcurrent == 0 {
+			acc.MaxConcurrent = maxConcurrentUploads
+		}
+		for _, dir := range acc.Directories {
+			root, err := filepath.Abs(dir)
+			if err != nil {
+				return fmt.Errorf("can't get the absolute path of '%v' (%v)", dir, err)
+			}
+			acc.roots = append(acc.roots, root)
+		}
+
+		log.Printf("Loading the credentials of the account '%v' ...\n", acc.Name)
+		acc.credentials = authenticate(acc.Auth)
+		accounts = append(accounts, acc)
+	}
+	return nil
+}
+
+// Account of the deepest directory containing the path, or the default account
+func accountOf(path string) *account {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	owner, deepest := accounts[0], ""
+	for _, acc := range accounts[1:] {
+		for _, root := range acc.roots {
+			if (path == root || strings.HasPrefix(path, root+string(filepath.Separator))) && len(root) > len(deepest) {
+				owner, deepest = acc, root
+			}
+		}
+	}
+	return owner
+}
+
+// Account by name, or nil
+func accountNamed(name string) *account {
+	for _, acc := range accounts {
+		if acc.Name == name {
+			return acc
+		}
+	}
+	return nil
+}
+
+// Suffix of the logs about the files of the account, empty for the default account
+func (a *account) logSuffix() string {
+	if a.Name == defaultAccountName {
+		return ""
+	}
+	return " (account '" + a.Name + "')"
+}
+
+// Remember the store of the credentials
+func registerStore(credentials auth.CookieCredentials, store auth.Store) {
+	storesMutex.Lock()
+	defer storesMutex.Unlock()
+	credentialStores[credentials.Client] = store
+}
+
+// Store of the credentials, or nil
+func storeOf(credentials auth.CookieCredentials) auth.Store {
+	storesMutex.Lock()
+	defer storesMutex.Unlock()
+	return credentialStores[credentials.Client]
+}
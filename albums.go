@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/GaPhi/gphotosuploader/api"
+	"github.com/GaPhi/gphotosuploader/auth"
+)
+
+const albumsUsage = `Usage: gphotosuploader albums <command> [arguments]
+
+Albums can be given by album id, shared album id or URL, media items by media key or URL.
+
+Commands:
+  list                                   List albums
+  create -name NAME                      Create an album
+  list-items -album ALBUM                List the media items of an album
+  add -album ALBUM ITEM...               Add media items to an album
+  remove -album ALBUM ITEM...            Remove media items from an album
+  move -from ALBUM -to ALBUM ITEM...     Move media items from an album to another one
+  rename -album ALBUM -name NAME         Rename an album
+  sort -album ALBUM -kind KIND           Sort an album (1: Newest first, 2: Oldest first, 3: Last added first)
+`
+
+// Run the albums subcommand, returning the exit code
+func runAlbumsCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, albumsUsage)
+		return exitUsage
+	}
+
+	flags := flag.NewFlagSet("albums "+args[0], flag.ExitOnError)
+	flags.StringVar(&authFile, "auth", "auth.json", authUsageText)
+	flags.BoolVar(&api.LogRequests, "debug", false, "Log Google requests and responses")
+	albumArg := flags.String("album", "", "Album")
+	fromArg := flags.String("from", "", "Album to move media items from")
+	toArg := flags.String("to", "", "Album to move media items to")
+	name := flags.String("name", "", "New album name")
+	kind := flags.Int("kind", 0, "Sort kind (1: Newest first, 2: Oldest first, 3: Last added first)")
+	_ = flags.Parse(args[1:])
+
+	// Check arguments before authenticating
+	var (
+		album, from, to api.AlbumRef
+		items           []api.MediaKey
+		err             error
+	)
+	switch args[0] {
+	case "list":
+	case "create":
+		if *name == "" {
+			err = fmt.Errorf("missing album name")
+		}
+	case "list-items", "rename", "sort":
+		album, err = api.ResolveAlbumRef(*albumArg)
+		if err == nil && args[0] == "rename" && *name == "" {
+			err = fmt.Errorf("missing album name")
+		}
+		if err == nil && args[0] == "sort" && (*kind < 1 || *kind > 3) {
+			err = fmt.Errorf("invalid sort kind %v", *kind)
+		}
+	case "add", "remove":
+		album, err = api.ResolveAlbumRef(*albumArg)
+		if err == nil {
+			items, err = parseMediaKeysArgs(flags.Args())
+		}
+	case "move":
+		from, err = api.ResolveAlbumRef(*fromArg)
+		if err == nil {
+			to, err = api.ResolveAlbumRef(*toArg)
+		}
+		if err == nil {
+			items, err = parseMediaKeysArgs(flags.Args())
+		}
+	default:
+		fmt.Fprint(os.Stderr, albumsUsage)
+		return exitUsage
+	}
+	if err != nil {
+		log.Println(err)
+		return exitUsage
+	}
+
+	credentials := initAuthentication()
+
+	var albumId, fromId, toId api.AlbumID
+	switch args[0] {
+	case "list-items", "rename", "sort", "add", "remove":
+		albumId, err = albumIdOf(credentials, album)
+	case "move":
+		fromId, err = albumIdOf(credentials, from)
+		if err == nil {
+			toId, err = albumIdOf(credentials, to)
+		}
+	}
+	if err != nil {
+		log.Println(err)
+		return exitFailure
+	}
+
+	switch args[0] {
+	case "list":
+		_, err = api.ListAllAlbums(credentials, func(albums []api.Album, err error) {
+			for _, album := range albums {
+				fmt.Printf("%v\t%v\t%v\t%v\n", album.AlbumId, album.SharedAlbumId, album.MediaCount, album.AlbumName)
+			}
+		})
+	case "create":
+		albumId, err = api.CreateAlbum(credentials, *name)
+		if err == nil {
+			fmt.Println(albumId)
+		}
+	case "list-items":
+		_, err = api.ListAllAlbumMediaItems(credentials, albumId, func(mediaItems []api.MediaItem, err error) {
+			for _, mediaItem := range mediaItems {
+				fmt.Printf("%v\t%v\t%v\n", mediaItem.MediaItemId, time.Unix(0, mediaItem.StartDate*1000000).Local().Format(time.RFC3339), mediaItem.ContentUrl)
+			}
+		})
+	case "add":
+		err = api.AlbumAddMediaItems(credentials, albumId, items)
+		if err == nil {
+			log.Printf("%v media items added to album '%v'\n", len(items), albumId)
+		}
+	case "remove":
+		err = api.AlbumRemoveMediaItems(credentials, albumId, items)
+		if err == nil {
+			log.Printf("%v media items removed from album '%v'\n", len(items), albumId)
+		}
+	case "move":
+		err = api.AlbumMoveMediaItems(credentials, fromId, toId, items)
+		if err == nil {
+			log.Printf("%v media items moved from album '%v' to album '%v'\n", len(items), fromId, toId)
+		}
+	case "rename":
+		err = api.RenameAlbum(credentials, albumId, *name)
+		if err == nil {
+			log.Printf("Album '%v' renamed to '%v'\n", albumId, *name)
+		}
+	case "sort":
+		err = api.AlbumSortMediaItems(credentials, albumId, *kind)
+		if err == nil {
+			log.Printf("Album '%v' sort kind set to %v\n", albumId, *kind)
+		}
+	}
+	if err != nil {
+		log.Printf("Can't %v: %v\n", args[0], err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+func parseMediaKeysArgs(values []string) ([]api.MediaKey, error) {
+	if len(values) == 0 {
+		return nil, fmt.Errorf("missing media items")
+	}
+	return api.ParseMediaKeys(values)
+}
+
+// Look for the album id of a shared album, replaced by the tests
+var findAlbumId = api.FindAlbumId
+
+// Get the album id of an album, looking for it if the album is referenced by its shared album id. The shared album id
+// is used as is for the albums shared by other users, which are not found
+func albumIdOf(credentials auth.CookieCredentials, album api.AlbumRef) (api.AlbumID, error) {
+	if !album.IsShared() {
+		return album.AlbumId, nil
+	}
+	albumId, err := findAlbumId(credentials, album.SharedAlbumId)
+	if errors.Is(err, api.ErrAlbumNotOwned) {
+		return api.AlbumID(album.SharedAlbumId), nil
+	}
+	return albumId, err
+}
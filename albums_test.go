@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/GaPhi/gphotosuploader/api"
+	"github.com/GaPhi/gphotosuploader/auth"
+)
+
+func TestAlbumIdOf(t *testing.T) {
+	const (
+		ownedId   = api.AlbumID("AF1QipP5CHoTNeAsjAdNQDbfaWTI0A2oJp_er5PSNSFs")
+		ownedRef  = api.SharedAlbumID("AF1QipN4Q7SPvfG2agzCI_ZTH2Hp7zNTGSOcH4MhUuCmNHxKr1JfU3Uz-vg7heZ2z195PA")
+		othersRef = api.SharedAlbumID("AF1QipMyJ6yO3WgjbS5BvHq8ZVRbCqYyqZJhrSvcxHJ3fTUdf5wt3Z0o3yU9Qbq5CrdT_w")
+	)
+	listingErr := errors.New("listing failed")
+	defer func(find func(auth.CookieCredentials, api.SharedAlbumID) (api.AlbumID, error)) {
+		findAlbumId = find
+	}(findAlbumId)
+
+	tests := []struct {
+		name    string
+		album   api.AlbumRef
+		listErr error
+		albumId api.AlbumID
+		err     error
+	}{
+		{"album id", api.AlbumRef{AlbumId: ownedId}, nil, ownedId, nil},
+		{"owned shared album", api.AlbumRef{SharedAlbumId: ownedRef}, nil, ownedId, nil},
+		{"album shared by another user", api.AlbumRef{SharedAlbumId: othersRef}, nil, api.AlbumID(othersRef), nil},
+		{"listing error", api.AlbumRef{SharedAlbumId: ownedRef}, listingErr, "", listingErr},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			findAlbumId = func(_ auth.CookieCredentials, sharedAlbumId api.SharedAlbumID) (api.AlbumID, error) {
+				if test.listErr != nil {
+					return "", test.listErr
+				}
+				if sharedAlbumId == ownedRef {
+					return ownedId, nil
+				}
+				return "", fmt.Errorf("shared album '%v': %w", sharedAlbumId, api.ErrAlbumNotOwned)
+			}
+			albumId, err := albumIdOf(auth.CookieCredentials{}, test.album)
+			if albumId != test.albumId || !errors.Is(err, test.err) {
+				t.Errorf("albumIdOf(%v) = %v, %v, want %v, %v", test.album, albumId, err, test.albumId, test.err)
+			}
+		})
+	}
+}
@@ -12,10 +12,10 @@ import (
 // Album represents an album
 type Album struct {
 	// Album identifier
-	AlbumId string
+	AlbumId AlbumID
 
-	// Shared album identifier
-	SharedAlbumId interface{}
+	// Shared album identifier (empty if the album is not shared)
+	SharedAlbumId SharedAlbumID
 
 	// Album name
 	AlbumName string
@@ -25,7 +25,7 @@ type Album struct {
 }
 
 // Create Album
-func CreateAlbum(credentials auth.CookieCredentials, albumName string) (string, error) {
+func CreateAlbum(credentials auth.CookieCredentials, albumName string) (AlbumID, error) {
 	innerJson := []interface{}{
 		albumName,
 		nil,
@@ -56,10 +56,10 @@ func CreateAlbum(credentials auth.CookieCredentials, albumName string) (string,
 		return "", unexpectedResponse(innerJsonRes)
 	}
 
-	return albumId, nil
+	return AlbumID(albumId), nil
 }
 
-func AlbumAddMediaItems(credentials auth.CookieCredentials, albumId string, items []string) error {
+func AlbumAddMediaItems(credentials auth.CookieCredentials, albumId AlbumID, items []MediaKey) error {
 	innerJson := []interface{}{
 		albumId,
 		[]interface{}{
@@ -105,7 +105,137 @@ func AlbumAddMediaItems(credentials auth.CookieCredentials, albumId string, item
 	return nil
 }
 
-func AlbumSortMediaItems(credentials auth.CookieCredentials, albumId string, kind int) error {
+// Remove media items from an album. The media items are not deleted from the library
+func AlbumRemoveMediaItems(credentials auth.CookieCredentials, albumId AlbumID, items []MediaKey) error {
+	innerJson := []interface{}{
+		items,
+		[]interface{}{
+			albumId,
+		},
+	}
+	innerJsonString, err := json.Marshal(innerJson)
+	if err != nil {
+		return err
+	}
+	jsonReq := []interface{}{
+		[]interface{}{
+			[]interface{}{
+				"ycV3Nd",
+				string(innerJsonString),
+				nil,
+				"generic",
+			},
+		},
+	}
+	_, err = doRequest(credentials, jsonReq)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Move media items from an album to another one
+func AlbumMoveMediaItems(credentials auth.CookieCredentials, fromAlbumId AlbumID, toAlbumId AlbumID, items []MediaKey) error {
+	// Add first, so that a failure never leaves the media items out of both albums
+	err := AlbumAddMediaItems(credentials, toAlbumId, items)
+	if err != nil {
+		return err
+	}
+
+	return AlbumRemoveMediaItems(credentials, fromAlbumId, items)
+}
+
+// Rename an album
+func RenameAlbum(credentials auth.CookieCredentials, albumId AlbumID, albumName string) error {
+	innerJson := []interface{}{
+		albumId,
+		[]interface{}{},
+		1,
+		albumName,
+	}
+	innerJsonString, err := json.Marshal(innerJson)
+	if err != nil {
+		return err
+	}
+	jsonReq := []interface{}{
+		[]interface{}{
+			[]interface{}{
+				"QD9nKf",
+				string(innerJsonString),
+				nil,
+				"generic",
+			},
+		},
+	}
+	_, err = doRequest(credentials, jsonReq)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// List all media items of an album. The optional callback is called with each page of media items, and with the
+// error that stops the listing, if any
+func ListAllAlbumMediaItems(credentials auth.CookieCredentials, albumId AlbumID, cb func([]MediaItem, error)) ([]MediaItem, error) {
+	return listAll(IterateAlbumMediaItems(credentials, albumId, ""), cb)
+}
+
+// Iterate over the media items of an album, starting from the given page
+func IterateAlbumMediaItems(credentials auth.CookieCredentials, albumId AlbumID, start PageToken) *Iterator[MediaItem] {
+	return NewIterator(func(pageToken PageToken) ([]MediaItem, PageToken, error) {
+		return ListAlbumMediaItems(credentials, albumId, pageToken)
+	}, start)
+}
+
+// List media items of an album by page
+func ListAlbumMediaItems(credentials auth.CookieCredentials, albumId AlbumID, pageToken PageToken) ([]MediaItem, PageToken, error) {
+	innerJson := []interface{}{
+		albumId,
+		pageToken, // Page token
+		nil,
+		nil,
+	}
+	innerJsonString, err := json.Marshal(innerJson)
+	if err != nil {
+		return nil, "", err
+	}
+	jsonReq := []interface{}{
+		[]interface{}{
+			[]interface{}{
+				"snAcKc",
+				string(innerJsonString),
+				nil,
+				"generic",
+			},
+		},
+	}
+	innerJsonRes, err := doRequest(credentials, jsonReq)
+	if err != nil {
+		return nil, "", err
+	}
+
+	mediaItems := []MediaItem{}
+	_, _ = jsonparser.ArrayEach(innerJsonRes, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+		if err != nil {
+			return
+		}
+		mediaItem, err := parseMediaItem(value)
+		if err != nil {
+			return
+		}
+		mediaItems = append(mediaItems, mediaItem)
+	}, "[1]")
+
+	nextPageToken, err := jsonparser.GetString(innerJsonRes, "[2]")
+	if err != nil {
+		return mediaItems, "", nil
+	}
+	return mediaItems, PageToken(nextPageToken), nil
+}
+
+func AlbumSortMediaItems(credentials auth.CookieCredentials, albumId AlbumID, kind int) error {
 	var kindJson []interface{}
 	switch kind {
 	case 1: // Newest first
@@ -214,7 +344,7 @@ func createUserInterface(user string) interface{} {
 }
 
 // Share Album
-func AlbumShareWithUser(credentials auth.CookieCredentials, albumId string, user string) (string, error) {
+func AlbumShareWithUser(credentials auth.CookieCredentials, albumId AlbumID, user string) (SharedAlbumID, error) {
 	innerJson := []interface{}{
 		nil,
 		nil,
@@ -280,11 +410,11 @@ func AlbumShareWithUser(credentials auth.CookieCredentials, albumId string, user
 		return "", unexpectedResponse(innerJsonRes)
 	}
 
-	return sharedAlbumId, nil
+	return SharedAlbumID(sharedAlbumId), nil
 }
 
 // Add a new user to a Album share
-func AlbumShareAddUser(credentials auth.CookieCredentials, sharedAlbumId string, user string) error {
+func AlbumShareAddUser(credentials auth.CookieCredentials, sharedAlbumId SharedAlbumID, user string) error {
 	innerJson := []interface{}{
 		[]interface{}{
 			sharedAlbumId,
@@ -348,8 +478,8 @@ func AlbumShareAddUser(credentials auth.CookieCredentials, sharedAlbumId string,
 
 // Delete Albums
 // albumId: Own albumId (AF1QipP5CHoTNeAsjAdNQDbfaWTI0A2oJp_er5PSNSFs)
-// sharedAlbumId: Shared album Id (AF1QipN4Q7SPvfG2agzCI_ZTH2Hp7zNTGSOcH4MhUuCmNHxKr1JfU3Uz-vg7heZ2z195PA)
-func DeleteAlbum(credentials auth.CookieCredentials, albumId string, sharedAlbumId interface{}) error {
+// sharedAlbumId: Shared album Id (AF1QipN4Q7SPvfG2agzCI_ZTH2Hp7zNTGSOcH4MhUuCmNHxKr1JfU3Uz-vg7heZ2z195PA), empty if not shared
+func DeleteAlbum(credentials auth.CookieCredentials, albumId AlbumID, sharedAlbumId SharedAlbumID) error {
 	innerJson := []interface{}{
 		[]interface{}{},
 		[]interface{}{},
@@ -383,35 +513,21 @@ func DeleteAlbum(credentials auth.CookieCredentials, albumId string, sharedAlbum
 	return nil
 }
 
-// List all albums
+// List all albums. The optional callback is called with each page of albums, and with the error that stops the
+// listing, if any
 func ListAllAlbums(credentials auth.CookieCredentials, cb func([]Album, error)) ([]Album, error) {
-	var (
-		nextPageToken interface{}
-		allAlbums     = []Album{}
-		albums        []Album
-		err           error
-	)
-
-	// Fetch all pages
-	for {
-		albums, nextPageToken, err = ListAlbums(credentials, nextPageToken)
-		if err != nil {
-			return allAlbums, err
-		}
-		if cb != nil {
-			cb(albums, err)
-		}
-		allAlbums = append(allAlbums, albums...)
-		if nextPageToken == nil || nextPageToken == "" {
-			// Return result
-			return allAlbums, nil
-		}
-	}
+	return listAll(IterateAlbums(credentials, ""), cb)
+}
+
+// Iterate over the albums, starting from the given page
+func IterateAlbums(credentials auth.CookieCredentials, start PageToken) *Iterator[Album] {
+	return NewIterator(func(pageToken PageToken) ([]Album, PageToken, error) {
+		return ListAlbums(credentials, pageToken)
+	}, start)
 }
 
-// List albums by page
-func ListAlbums(credentials auth.CookieCredentials, pageToken interface{}) ([]Album, interface{}, error) {
-	// FIXME Only shared albums are listed
+// List albums by page. The shared album id is empty for the albums that are not shared
+func ListAlbums(credentials auth.CookieCredentials, pageToken PageToken) ([]Album, PageToken, error) {
 	innerJson := []interface{}{
 		pageToken, // Page token
 		nil,
@@ -419,7 +535,7 @@ func ListAlbums(credentials auth.CookieCredentials, pageToken interface{}) ([]Al
 	}
 	innerJsonString, err := json.Marshal(innerJson)
 	if err != nil {
-		return nil, nil, err
+		return nil, "", err
 	}
 	jsonReq := []interface{}{
 		[]interface{}{
@@ -433,7 +549,7 @@ func ListAlbums(credentials auth.CookieCredentials, pageToken interface{}) ([]Al
 	}
 	innerJsonRes, err := doRequest(credentials, jsonReq)
 	if err != nil {
-		return nil, nil, err
+		return nil, "", err
 	}
 
 	albums := []Album{}
@@ -442,9 +558,9 @@ func ListAlbums(credentials auth.CookieCredentials, pageToken interface{}) ([]Al
 			return
 		}
 		var album Album
-		album.SharedAlbumId, err = jsonparser.GetString(value, "[6]")
-		if err != nil {
-			return
+		// Only the shared albums have a shared album id
+		if sharedAlbumId, err := jsonparser.GetString(value, "[6]"); err == nil {
+			album.SharedAlbumId = SharedAlbumID(sharedAlbumId)
 		}
 		album.AlbumName, err = jsonparser.GetString(value, "[1]")
 		if err != nil {
@@ -454,18 +570,19 @@ func ListAlbums(credentials auth.CookieCredentials, pageToken interface{}) ([]Al
 		if err != nil {
 			return
 		}
-		album.AlbumId, err = jsonparser.GetString(value, "[17]")
+		albumId, err := jsonparser.GetString(value, "[17]")
 		if err != nil {
 			return
 		}
+		album.AlbumId = AlbumID(albumId)
 		albums = append(albums, album)
 	}, "[0]")
 
 	nextPageToken, err := jsonparser.GetString(innerJsonRes, "[1]")
 	if err != nil {
-		return albums, nil, nil
+		return albums, "", nil
 	}
-	return albums, nextPageToken, nil
+	return albums, PageToken(nextPageToken), nil
 }
 
 // Delete empty albums
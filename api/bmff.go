@@ -0,0 +1,235 @@
+package api
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// Canon CR3 box containing the metadata, and its EXIF IFD child box
+var (
+	cr3MetadataUuid = string([]byte{0x85, 0xc0, 0xb6, 0x87, 0x82, 0x0f, 0x11, 0xe0, 0x81, 0x11, 0xf4, 0xce, 0x46, 0x2b, 0x6a, 0x48})
+	cr3ExifBox      = "CMT2"
+)
+
+// Start of the QuickTime and MP4 timestamps
+var quickTimeEpoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var errNoVideoDate = errors.New("no movie header creation time found")
+
+// Box of an ISO base media file (MP4, MOV, HEIC, CR3, ...)
+type bmffBox struct {
+	boxType string
+
+	// Offset and size of the content of the box, without its header
+	offset int64
+	size   int64
+}
+
+// Read the boxes contained between start and end
+func readBmffBoxes(r io.ReaderAt, start int64, end int64) []bmffBox {
+	var boxes []bmffBox
+	header := make([]byte, 16)
+	for offset := start; offset+8 <= end; {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			break
+		}
+		size := int64(binary.BigEndian.Uint32(header))
+		headerSize := int64(8)
+		switch size {
+		case 0: // The box extends to the end of the file
+			size = end - offset
+		case 1: // 64 bits size
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return boxes
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:]))
+			headerSize = 16
+		}
+		if size < headerSize || offset+size > end {
+			break
+		}
+
+		box := bmffBox{boxType: string(header[4:8]), offset: offset + headerSize, size: size - headerSize}
+		if box.boxType == "uuid" && box.size >= 16 {
+			uuid := make([]byte, 16)
+			if _, err := r.ReadAt(uuid, box.offset); err == nil {
+				box.boxType = string(uuid)
+				box.offset += 16
+				box.size -= 16
+			}
+		}
+		boxes = append(boxes, box)
+		offset += size
+	}
+	return boxes
+}
+
+// Find the first box of a type between start and end
+func findBmffBox(r io.ReaderAt, start int64, end int64, boxType string) (bmffBox, bool) {
+	for _, box := range readBmffBoxes(r, start, end) {
+		if box.boxType == boxType {
+			return box, true
+		}
+	}
+	return bmffBox{}, false
+}
+
+// Get the creation time of a QuickTime or MP4 video from its movie header
+func videoCreationTime(r io.ReaderAt, size int64) (time.Time, error) {
+	moov, found := findBmffBox(r, 0, size, "moov")
+	if !found {
+		return time.Time{}, errNoVideoDate
+	}
+	mvhd, found := findBmffBox(r, moov.offset, moov.offset+moov.size, "mvhd")
+	if !found || mvhd.size < 12 {
+		return time.Time{}, errNoVideoDate
+	}
+
+	header := make([]byte, 12)
+	if _, err := r.ReadAt(header, mvhd.offset); err != nil {
+		return time.Time{}, err
+	}
+	var seconds uint64
+	if header[0] == 1 {
+		seconds = binary.BigEndian.Uint64(header[4:])
+	} else {
+		seconds = uint64(binary.BigEndian.Uint32(header[4:]))
+	}
+	// Some cameras don't set the creation time
+	if seconds == 0 {
+		return time.Time{}, errNoVideoDate
+	}
+	return quickTimeEpoch.Add(time.Duration(seconds) * time.Second), nil
+}
+
+// Get the EXIF date of a HEIC/AVIF image (EXIF item of the meta box) or of a CR3 raw file (CMT2 box)
+func bmffExifDate(r io.ReaderAt, size int64) (time.Time, error) {
+	if moov, found := findBmffBox(r, 0, size, "moov"); found {
+		if metadata, found := findBmffBox(r, moov.offset, moov.offset+moov.size, cr3MetadataUuid); found {
+			if exif, found := findBmffBox(r, metadata.offset, metadata.offset+metadata.size, cr3ExifBox); found {
+				return tiffDate(r, exif.offset)
+			}
+		}
+	}
+
+	meta, found := findBmffBox(r, 0, size, "meta")
+	if !found {
+		return time.Time{}, errNoExifDate
+	}
+	// The meta box is a full box: skip its version and flags
+	children := readBmffBoxes(r, meta.offset+4, meta.offset+meta.size)
+
+	var exifItem uint32
+	for _, box := range children {
+		if box.boxType == "iinf" {
+			exifItem = findExifItem(r, box)
+		}
+	}
+	if exifItem == 0 {
+		return time.Time{}, errNoExifDate
+	}
+	for _, box := range children {
+		if box.boxType == "iloc" {
+			if offset, found := locateItem(r, box, exifItem); found {
+				// The EXIF item starts with the offset of the TIFF header
+				header := make([]byte, 4)
+				if _, err := r.ReadAt(header, offset); err != nil {
+					return time.Time{}, err
+				}
+				return tiffDate(r, offset+4+int64(binary.BigEndian.Uint32(header)))
+			}
+		}
+	}
+	return time.Time{}, errNoExifDate
+}
+
+// Find the id of the EXIF item in the item information box, 0 if not found
+func findExifItem(r io.ReaderAt, iinf bmffBox) uint32 {
+	header := make([]byte, 8)
+	if _, err := r.ReadAt(header, iinf.offset); err != nil {
+		return 0
+	}
+	entriesOffset := iinf.offset + 6
+	if header[0] != 0 {
+		entriesOffset = iinf.offset + 8
+	}
+
+	for _, infe := range readBmffBoxes(r, entriesOffset, iinf.offset+iinf.size) {
+		if infe.boxType != "infe" || infe.size < 12 {
+			continue
+		}
+		entry := make([]byte, 12)
+		if _, err := r.ReadAt(entry, infe.offset); err != nil {
+			continue
+		}
+		// Only the versions 2 and 3 of the entries have an item type
+		switch {
+		case entry[0] == 2 && string(entry[8:12]) == "Exif":
+			return uint32(binary.BigEndian.Uint16(entry[4:]))
+		case entry[0] == 3 && infe.size >= 14:
+			entry = make([]byte, 14)
+			if _, err := r.ReadAt(entry, infe.offset); err == nil && string(entry[10:14]) == "Exif" {
+				return binary.BigEndian.Uint32(entry[4:])
+			}
+		}
+	}
+	return 0
+}
+
+// Find the file offset of the first extent of an item in the item location box
+func locateItem(r io.ReaderAt, iloc bmffBox, itemId uint32) (int64, bool) {
+	data := make([]byte, iloc.size)
+	if _, err := r.ReadAt(data, iloc.offset); err != nil || len(data) < 8 {
+		return 0, false
+	}
+	version := data[0]
+	offsetSize, lengthSize := int(data[4]>>4), int(data[4]&0x0F)
+	baseOffsetSize, indexSize := int(data[5]>>4), 0
+	if version == 1 || version == 2 {
+		indexSize = int(data[5] & 0x0F)
+	}
+
+	position := 6
+	read := func(size int) (uint64, bool) {
+		if position+size > len(data) {
+			return 0, false
+		}
+		var value uint64
+		for _, b := range data[position : position+size] {
+			value = value<<8 | uint64(b)
+		}
+		position += size
+		return value, true
+	}
+
+	idSize := 2
+	if version == 2 {
+		idSize = 4
+	}
+	itemCount, ok := read(idSize)
+	for i := uint64(0); ok && i < itemCount; i++ {
+		id, _ := read(idSize)
+		constructionMethod := uint64(0)
+		if version == 1 || version == 2 {
+			constructionMethod, _ = read(2)
+			constructionMethod &= 0x0F
+		}
+		read(2) // Data reference index
+		baseOffset, _ := read(baseOffsetSize)
+		var extentCount uint64
+		extentCount, ok = read(2)
+
+		for e := uint64(0); ok && e < extentCount; e++ {
+			read(indexSize)
+			extentOffset, _ := read(offsetSize)
+			_, ok = read(lengthSize)
+			// Only the items stored in the file (not in an idat box) are supported
+			if ok && e == 0 && uint32(id) == itemId && constructionMethod == 0 {
+				return int64(baseOffset + extentOffset), true
+			}
+		}
+	}
+	return 0, false
+}
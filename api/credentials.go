@@ -0,0 +1,80 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/GaPhi/gphotosuploader/auth"
+)
+
+// Detailed check of the credentials
+type CredentialsReport struct {
+	// Presence and expiration of the cookies
+	Cookies []auth.CookieStatus `json:"cookies"`
+
+	// User id of the credentials, and user id of the account logged in by the cookies (empty if not logged in)
+	UserId        string `json:"userId"`
+	AccountUserId string `json:"accountUserId"`
+
+	// Whether an at token could be scraped, and a request using it succeeded
+	AtToken bool `json:"atToken"`
+	Rpc     bool `json:"rpc"`
+
+	// Estimated expiration time of the session, zero if unknown
+	SessionExpires time.Time `json:"sessionExpires,omitzero"`
+
+	// Problems found, the credentials are valid if there is none
+	Problems []string `json:"problems"`
+	Valid    bool     `json:"valid"`
+}
+
+// Check the cookies of the credentials, that they log in the account of their user id, and that an at token can be
+// scraped and used by a request (the storage query, which needs the user id). The at token of the credentials is left
+// unchanged
+func CheckCredentials(credentials auth.CookieCredentials) *CredentialsReport {
+	report := &CredentialsReport{
+		Cookies:        credentials.CheckCookies(),
+		SessionExpires: credentials.SessionExpiration(),
+		Problems:       []string{},
+	}
+	if credentials.PersistentParameters != nil {
+		report.UserId = credentials.PersistentParameters.UserId
+	}
+	if report.UserId == "" {
+		report.Problems = append(report.Problems, "no user id in the credentials")
+	}
+	for _, cookie := range report.Cookies {
+		if cookie.Required && !cookie.Present {
+			report.Problems = append(report.Problems, fmt.Sprintf("the %v cookie is missing or expired", cookie.Name))
+		}
+	}
+
+	accountUserId, err := credentials.ExtractUserId()
+	if err != nil {
+		report.Problems = append(report.Problems, err.Error())
+	} else {
+		report.AccountUserId = accountUserId
+		if report.UserId != "" && accountUserId != report.UserId {
+			report.Problems = append(report.Problems,
+				fmt.Sprintf("the user id %v is not the id of the logged in account (%v)", report.UserId, accountUserId))
+		}
+	}
+
+	if token, err := scrapeAtToken(credentials); err != nil {
+		report.Problems = append(report.Problems, err.Error())
+	} else if report.UserId != "" {
+		report.AtToken = true
+		check := credentials
+		check.RuntimeParameters = &auth.RuntimeParameters{AtToken: token}
+		if _, _, err := queryStorage(check, false); err != nil {
+			report.Problems = append(report.Problems, fmt.Sprintf("can't query the storage (%v)", err))
+		} else {
+			report.Rpc = true
+		}
+	} else {
+		report.AtToken = true
+	}
+
+	report.Valid = len(report.Problems) == 0
+	return report
+}
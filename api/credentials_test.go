@@ -0,0 +1,39 @@
+package api
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/GaPhi/gphotosuploader/auth"
+)
+
+func TestCheckCredentialsUserId(t *testing.T) {
+	tests := []struct {
+		parameters *auth.PersistentParameters
+		userId     string
+		noUserId   bool
+		requests   int
+	}{
+		{nil, "", true, 0},
+		{&auth.PersistentParameters{}, "", true, 0},
+		{&auth.PersistentParameters{UserId: "12345"}, "12345", false, 1},
+	}
+	for _, test := range tests {
+		transport := &refusingTransport{}
+		credentials := auth.NewCookieCredentials(nil, test.parameters)
+		credentials.Client.Transport = transport
+
+		report := CheckCredentials(*credentials)
+		if report.UserId != test.userId || report.AccountUserId != "12345" || !report.AtToken || report.Rpc || report.Valid {
+			t.Errorf("parameters %+v: got %+v", test.parameters, report)
+		}
+		if noUserId := slices.Contains(report.Problems, "no user id in the credentials"); noUserId != test.noUserId {
+			t.Errorf("parameters %+v: got problems %q", test.parameters, report.Problems)
+		}
+
+		// The storage query needs the user id
+		if transport.requests != test.requests {
+			t.Errorf("parameters %+v: %v requests, want %v", test.parameters, transport.requests, test.requests)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/GaPhi/gphotosuploader/auth"
+)
+
+// Download the original content of a media item. It returns the content, that must be closed, and the name of the
+// file given by Google (empty if unknown)
+func DownloadMediaItem(credentials auth.CookieCredentials, mediaItem MediaItem) (io.ReadCloser, string, error) {
+	url := mediaItem.DownloadUrl
+	if url == "" {
+		if mediaItem.ContentUrl == "" {
+			return nil, "", fmt.Errorf("no URL to download media item %v", mediaItem.MediaItemId)
+		}
+		// Original photo, or original video
+		url = mediaItem.ContentUrl + "=d"
+		if mediaItem.IsVideo {
+			url = mediaItem.ContentUrl + "=dv"
+		}
+	}
+
+	res, err := credentials.Client.Get(url)
+	if err != nil {
+		return nil, "", fmt.Errorf("error sending the request: %v", err.Error())
+	}
+	if res.StatusCode != http.StatusOK {
+		_ = res.Body.Close()
+		return nil, "", fmt.Errorf("can't download media item %v (%v)", mediaItem.MediaItemId, res.Status)
+	}
+
+	fileName := mediaItem.Filename
+	if _, params, err := mime.ParseMediaType(res.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		fileName = params["filename"]
+	}
+	return res.Body, fileName, nil
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	// TIFF tags
+	tagExifIfdPointer     = 0x8769
+	tagDateTime           = 0x0132
+	tagDateTimeOriginal   = 0x9003
+	tagDateTimeDigitized  = 0x9004
+	tagOffsetTimeOriginal = 0x9011
+
+	// TIFF type of the ASCII strings
+	tiffTypeAscii = 2
+
+	// Format of the EXIF dates
+	exifDateLayout = "2006:01:02 15:04:05"
+)
+
+var errNoExifDate = errors.New("no EXIF date found")
+
+// Get the date when a picture was taken from its EXIF metadata. JPEG, HEIC, CR3, RAF and the TIFF based raw formats
+// (CR2, NEF, ARW, DNG, ORF, RW2, ...) are supported
+func exifDateTimeOriginal(r io.ReaderAt, size int64) (time.Time, error) {
+	header := make([]byte, 16)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return time.Time{}, err
+	}
+
+	switch {
+	case header[0] == 0xFF && header[1] == 0xD8:
+		return jpegExifDate(r, 0, size)
+	case bytes.HasPrefix(header, []byte("FUJIFILMCCD-RAW")):
+		// RAF files embed a JPEG preview with the EXIF metadata
+		offset := make([]byte, 4)
+		if _, err := r.ReadAt(offset, 84); err != nil {
+			return time.Time{}, err
+		}
+		return jpegExifDate(r, int64(binary.BigEndian.Uint32(offset)), size)
+	case string(header[4:8]) == "ftyp":
+		return bmffExifDate(r, size)
+	case string(header[0:2]) == "II" || string(header[0:2]) == "MM":
+		return tiffDate(r, 0)
+	}
+	return time.Time{}, errNoExifDate
+}
+
+// Look for the EXIF segment of a JPEG starting at the given offset
+func jpegExifDate(r io.ReaderAt, offset int64, size int64) (time.Time, error) {
+	offset += 2 // Start of image
+	segment := make([]byte, 10)
+	for offset+4 <= size {
+		if _, err := r.ReadAt(segment, offset); err != nil {
+			return time.Time{}, err
+		}
+		if segment[0] != 0xFF || segment[1] == 0xDA || segment[1] == 0xD9 {
+			break
+		}
+		length := int64(binary.BigEndian.Uint16(segment[2:]))
+		if segment[1] == 0xE1 && string(segment[4:10]) == "Exif\x00\x00" {
+			return tiffDate(r, offset+10)
+		}
+		offset += 2 + length
+	}
+	return time.Time{}, errNoExifDate
+}
+
+// Read the date from the TIFF structure starting at base. The EXIF IFD is looked for in IFD0, and IFD0 itself is
+// searched as some formats (CR3) store the EXIF IFD alone
+func tiffDate(r io.ReaderAt, base int64) (time.Time, error) {
+	header := make([]byte, 8)
+	if _, err := r.ReadAt(header, base); err != nil {
+		return time.Time{}, err
+	}
+
+	var order binary.ByteOrder
+	switch string(header[0:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return time.Time{}, errors.New("invalid TIFF header")
+	}
+
+	ifd0, err := readIfd(r, base, base+int64(order.Uint32(header[4:])), order)
+	if err != nil {
+		return time.Time{}, err
+	}
+	tags := ifd0
+	if exifOffset, found := ifd0[tagExifIfdPointer]; found {
+		exifIfd, err := readIfd(r, base, base+int64(order.Uint32(exifOffset)), order)
+		if err == nil {
+			for tag, value := range exifIfd {
+				tags[tag] = value
+			}
+		}
+	}
+
+	for _, tag := range []uint16{tagDateTimeOriginal, tagDateTimeDigitized, tagDateTime} {
+		value, found := tags[tag]
+		if !found {
+			continue
+		}
+		location := time.Local
+		if tag == tagDateTimeOriginal {
+			if offset, found := tags[tagOffsetTimeOriginal]; found {
+				if zone, err := time.Parse("-07:00", tiffString(offset)); err == nil {
+					location = zone.Location()
+				}
+			}
+		}
+		if date, err := time.ParseInLocation(exifDateLayout, tiffString(value), location); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, errNoExifDate
+}
+
+// Read the entries of an IFD. The value of each entry is its 4 bytes value field, except for the ASCII strings longer
+// than 4 bytes whose value is read from the offset
+func readIfd(r io.ReaderAt, base int64, offset int64, order binary.ByteOrder) (map[uint16][]byte, error) {
+	count := make([]byte, 2)
+	if _, err := r.ReadAt(count, offset); err != nil {
+		return nil, err
+	}
+	entries := make([]byte, 12*int(order.Uint16(count)))
+	if _, err := r.ReadAt(entries, offset+2); err != nil {
+		return nil, err
+	}
+
+	tags := map[uint16][]byte{}
+	for i := 0; i < len(entries); i += 12 {
+		entry := entries[i : i+12]
+		tag := order.Uint16(entry[0:])
+		value := entry[8:12]
+		length := order.Uint32(entry[4:])
+		if order.Uint16(entry[2:]) == tiffTypeAscii && length > 4 && length < 256 {
+			value = make([]byte, length)
+			if _, err := r.ReadAt(value, base+int64(order.Uint32(entry[8:]))); err != nil {
+				continue
+			}
+		}
+		tags[tag] = value
+	}
+	return tags, nil
+}
+
+func tiffString(value []byte) string {
+	return strings.TrimSpace(strings.TrimRight(string(value), "\x00"))
+}
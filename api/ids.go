@@ -0,0 +1,176 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	albumIdLength       = 44
+	sharedAlbumIdLength = 70
+)
+
+// Client resolving the short share links, which must not hang the start of the uploads
+var shareLinkClient = &http.Client{Timeout: 30 * time.Second}
+
+// Identifier of an album, as seen by its owner (AF1QipP5CHoTNeAsjAdNQDbfaWTI0A2oJp_er5PSNSFs)
+type AlbumID string
+
+// Identifier of a shared album, as seen by its members (AF1QipN4Q7SPvfG2agzCI_ZTH2Hp7zNTGSOcH4MhUuCmNHxKr1JfU3Uz-vg7heZ2z195PA)
+type SharedAlbumID string
+
+// Identifier of a media item (picture, video)
+type MediaKey string
+
+// Token of a page of a listing. The empty token designates the first page when sent, and the end of the listing when
+// received
+type PageToken string
+
+// Check that the id looks like an album id
+func (id AlbumID) Valid() bool {
+	return len(id) == albumIdLength && isIdString(string(id))
+}
+
+// Check that the id looks like a shared album id
+func (id SharedAlbumID) Valid() bool {
+	return len(id) == sharedAlbumIdLength && isIdString(string(id))
+}
+
+// Check that the key looks like a media key
+func (key MediaKey) Valid() bool {
+	return len(key) > 0 && isIdString(string(key))
+}
+
+// An album that is not shared has no shared album id: it is sent as null
+func (id SharedAlbumID) MarshalJSON() ([]byte, error) {
+	return marshalOptionalString(string(id))
+}
+
+// The first page is requested with a null token
+func (token PageToken) MarshalJSON() ([]byte, error) {
+	return marshalOptionalString(string(token))
+}
+
+// True if there is no more page to fetch
+func (token PageToken) IsLast() bool {
+	return token == ""
+}
+
+// Reference to an album, either by its album id or by its shared album id. Only one of the fields is set
+type AlbumRef struct {
+	AlbumId       AlbumID
+	SharedAlbumId SharedAlbumID
+}
+
+// Parse an album reference, guessing its kind. The value can be an id or the URL of the album in the Google Photos Web
+// App (https://photos.google.com/album/... or https://photos.google.com/share/...)
+func ParseAlbumRef(value string) (AlbumRef, error) {
+	value = strings.TrimSpace(value)
+	if id, found := idFromPhotosUrl(value, "album", "share"); found {
+		value = id
+	}
+
+	if id := AlbumID(value); id.Valid() {
+		return AlbumRef{AlbumId: id}, nil
+	}
+	if id := SharedAlbumID(value); id.Valid() {
+		return AlbumRef{SharedAlbumId: id}, nil
+	}
+	return AlbumRef{}, fmt.Errorf("'%v' is neither an album id nor a shared album id", value)
+}
+
+// Same as ParseAlbumRef, but short share links (https://photos.app.goo.gl/...) are resolved first, which needs a
+// request to Google
+func ResolveAlbumRef(value string) (AlbumRef, error) {
+	value = strings.TrimSpace(value)
+	if u, err := url.Parse(value); err == nil && u.Host == "photos.app.goo.gl" {
+		res, err := shareLinkClient.Head(value)
+		if err != nil {
+			return AlbumRef{}, fmt.Errorf("can't resolve the share link '%v' (%v)", value, err)
+		}
+		_ = res.Body.Close()
+		value = res.Request.URL.String()
+	}
+	return ParseAlbumRef(value)
+}
+
+// True if the reference is a shared album id
+func (r AlbumRef) IsShared() bool {
+	return r.SharedAlbumId != ""
+}
+
+func (r AlbumRef) String() string {
+	if r.IsShared() {
+		return string(r.SharedAlbumId)
+	}
+	return string(r.AlbumId)
+}
+
+// Parse a media key. The value can be a key or the URL of the media item in the Google Photos Web App
+// (https://photos.google.com/photo/... or https://photos.google.com/album/.../photo/...)
+func ParseMediaKey(value string) (MediaKey, error) {
+	value = strings.TrimSpace(value)
+	if key, found := idFromPhotosUrl(value, "photo"); found {
+		value = key
+	}
+
+	if key := MediaKey(value); key.Valid() {
+		return key, nil
+	}
+	return "", fmt.Errorf("'%v' is not a media key", value)
+}
+
+// Parse several media keys
+func ParseMediaKeys(values []string) ([]MediaKey, error) {
+	keys := make([]MediaKey, len(values))
+	for i, value := range values {
+		key, err := ParseMediaKey(value)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = key
+	}
+	return keys, nil
+}
+
+// Look for the path segment following one of the given names in a photos.google.com URL
+// (https://photos.google.com/u/2/album/ID/photo/KEY?key=...)
+func idFromPhotosUrl(value string, names ...string) (string, bool) {
+	u, err := url.Parse(value)
+	if err != nil || u.Host != "photos.google.com" {
+		return "", false
+	}
+
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	id, found := "", false
+	for i := 0; i < len(segments)-1; i++ {
+		for _, name := range names {
+			if segments[i] == name {
+				// Keep the last one: the photo of an album comes after the album
+				id, found = segments[i+1], true
+			}
+		}
+	}
+	return id, found
+}
+
+// Ids are made of base64 URL encoding characters
+func isIdString(value string) bool {
+	for _, c := range value {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+func marshalOptionalString(value string) ([]byte, error) {
+	if value == "" {
+		return []byte("null"), nil
+	}
+	return json.Marshal(value)
+}
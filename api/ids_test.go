@@ -0,0 +1,85 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const (
+	testAlbumId       = AlbumID("AF1QipP5CHoTNeAsjAdNQDbfaWTI0A2oJp_er5PSNSFs")
+	testSharedAlbumId = SharedAlbumID("AF1QipN4Q7SPvfG2agzCI_ZTH2Hp7zNTGSOcH4MhUuCmNHxKr1JfU3Uz-vg7heZ2z195PA")
+)
+
+func TestParseAlbumRef(t *testing.T) {
+	tests := []struct {
+		value string
+		ref   AlbumRef
+		valid bool
+	}{
+		{string(testAlbumId), AlbumRef{AlbumId: testAlbumId}, true},
+		{" " + string(testSharedAlbumId) + "\n", AlbumRef{SharedAlbumId: testSharedAlbumId}, true},
+		{"https://photos.google.com/album/" + string(testAlbumId), AlbumRef{AlbumId: testAlbumId}, true},
+		{"https://photos.google.com/u/2/album/" + string(testAlbumId) + "/photo/AF1QipOx", AlbumRef{AlbumId: testAlbumId},
+			true},
+		{"https://photos.google.com/share/" + string(testSharedAlbumId) + "?key=abc",
+			AlbumRef{SharedAlbumId: testSharedAlbumId}, true},
+		{"", AlbumRef{}, false},
+		{"AF1Qip", AlbumRef{}, false},
+		{strings.Repeat("!", albumIdLength), AlbumRef{}, false},
+		{"https://example.com/album/" + string(testAlbumId), AlbumRef{}, false},
+	}
+	for _, test := range tests {
+		ref, err := ParseAlbumRef(test.value)
+		if (err == nil) != test.valid || ref != test.ref {
+			t.Errorf("ParseAlbumRef(%q) = %+v, %v, want %+v", test.value, ref, err, test.ref)
+		}
+	}
+}
+
+// Transport answering the short share links with a redirection to the shared album
+type shareLinkTransport struct{}
+
+func (shareLinkTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host == "photos.app.goo.gl" {
+		header := http.Header{}
+		header.Set("Location", "https://photos.google.com/share/"+string(testSharedAlbumId)+"?key=abc")
+		return &http.Response{StatusCode: http.StatusFound, Header: header, Body: http.NoBody, Request: req}, nil
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+}
+
+func TestResolveAlbumRef(t *testing.T) {
+	defer func(client *http.Client) {
+		shareLinkClient = client
+	}(shareLinkClient)
+	shareLinkClient = &http.Client{Transport: shareLinkTransport{}}
+
+	ref, err := ResolveAlbumRef("https://photos.app.goo.gl/aBcD1234")
+	if err != nil || ref != (AlbumRef{SharedAlbumId: testSharedAlbumId}) {
+		t.Errorf("ResolveAlbumRef(share link) = %+v, %v", ref, err)
+	}
+	if ref, err = ResolveAlbumRef(string(testAlbumId)); err != nil || ref != (AlbumRef{AlbumId: testAlbumId}) {
+		t.Errorf("ResolveAlbumRef(album id) = %+v, %v", ref, err)
+	}
+}
+
+func TestParseMediaKey(t *testing.T) {
+	tests := []struct {
+		value string
+		key   MediaKey
+		valid bool
+	}{
+		{"AF1QipOx", "AF1QipOx", true},
+		{"https://photos.google.com/photo/AF1QipOx", "AF1QipOx", true},
+		{"https://photos.google.com/album/" + string(testAlbumId) + "/photo/AF1QipOx", "AF1QipOx", true},
+		{"", "", false},
+		{"not a key", "", false},
+	}
+	for _, test := range tests {
+		key, err := ParseMediaKey(test.value)
+		if (err == nil) != test.valid || key != test.key {
+			t.Errorf("ParseMediaKey(%q) = %v, %v, want %v", test.value, key, err, test.key)
+		}
+	}
+}
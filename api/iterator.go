@@ -0,0 +1,163 @@
+package api
+
+// Function that fetches a page of a listing, returning its items and the token of the next page
+type PageFetcher[T any] func(pageToken PageToken) ([]T, PageToken, error)
+
+// Iterator over a paginated listing. Pages are fetched lazily: the first one when the iteration starts, then the next
+// one is prefetched in background while the items of the current one are consumed.
+// The iteration can be stopped at any time with Close, and resumed later with the token returned by Checkpoint.
+type Iterator[T any] struct {
+	fetch PageFetcher[T]
+
+	// Remaining items of the current page
+	page []T
+
+	// Token of the current page and of the next one
+	pageToken     PageToken
+	nextPageToken PageToken
+
+	// Current item, when iterating by item
+	item T
+
+	// True once the last page has been fetched
+	last bool
+
+	// Page being fetched, if any
+	pending chan pageResult[T]
+
+	closed bool
+	err    error
+}
+
+type pageResult[T any] struct {
+	items         []T
+	pageToken     PageToken
+	nextPageToken PageToken
+	err           error
+}
+
+// Creates a new iterator starting from the given page (use an empty token to start from the first page)
+func NewIterator[T any](fetch PageFetcher[T], start PageToken) *Iterator[T] {
+	return &Iterator[T]{
+		fetch:         fetch,
+		pageToken:     start,
+		nextPageToken: start,
+	}
+}
+
+// Move to the next item. It returns false at the end of the listing, on error (see Err) or once closed
+func (it *Iterator[T]) Next() bool {
+	if it.closed {
+		return false
+	}
+	for len(it.page) == 0 {
+		if !it.NextPage() {
+			return false
+		}
+	}
+	it.item = it.page[0]
+	it.page = it.page[1:]
+	return true
+}
+
+// Current item
+func (it *Iterator[T]) Item() T {
+	return it.item
+}
+
+// Move to the next page. It returns false at the end of the listing, on error (see Err) or once closed.
+// The remaining items of the current page are skipped
+func (it *Iterator[T]) NextPage() bool {
+	if it.closed || it.err != nil || it.last {
+		return false
+	}
+
+	if it.pending == nil {
+		it.fetchAsync(it.nextPageToken)
+	}
+	res := <-it.pending
+	it.pending = nil
+	if res.err != nil {
+		it.err = res.err
+		return false
+	}
+
+	it.page = res.items
+	it.pageToken = res.pageToken
+	it.nextPageToken = res.nextPageToken
+	it.last = res.nextPageToken.IsLast()
+
+	// Prefetch the next page
+	if !it.last {
+		it.fetchAsync(it.nextPageToken)
+	}
+	return true
+}
+
+// Items of the current page that have not been consumed yet by Next
+func (it *Iterator[T]) Page() []T {
+	page := it.page
+	it.page = nil
+	return page
+}
+
+// Error that stopped the iteration, if any
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
+
+// Token from which a new iterator can resume this iteration. The items of the current page that were already returned
+// will be returned again. The second value is false if there's nothing left to iterate
+func (it *Iterator[T]) Checkpoint() (PageToken, bool) {
+	if len(it.page) > 0 {
+		return it.pageToken, true
+	}
+	if it.last {
+		return "", false
+	}
+	return it.nextPageToken, true
+}
+
+// Stop the iteration. A page being prefetched is discarded, the current page is kept for Checkpoint
+func (it *Iterator[T]) Close() {
+	it.closed = true
+	it.pending = nil
+}
+
+func (it *Iterator[T]) fetchAsync(pageToken PageToken) {
+	// Buffered, so that the goroutine never blocks if the iterator gets closed
+	pending := make(chan pageResult[T], 1)
+	it.pending = pending
+	go func() {
+		items, nextPageToken, err := it.fetch(pageToken)
+		pending <- pageResult[T]{
+			items:         items,
+			pageToken:     pageToken,
+			nextPageToken: nextPageToken,
+			err:           err,
+		}
+	}()
+}
+
+// Fetch all the pages of a listing. The optional callback is called with each page, and with the error that stops the
+// listing, if any
+func listAll[T any](it *Iterator[T], cb func([]T, error)) ([]T, error) {
+	defer it.Close()
+
+	all := []T{}
+	for it.NextPage() {
+		page := it.Page()
+		if cb != nil {
+			cb(page, nil)
+		}
+		all = append(all, page...)
+	}
+
+	if err := it.Err(); err != nil {
+		if cb != nil {
+			cb(nil, err)
+		}
+		return all, err
+	}
+	return all, nil
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// Listing of three pages, whose fetched tokens are recorded
+type testListing struct {
+	mutex   sync.Mutex
+	fetched []PageToken
+	failAt  PageToken
+}
+
+var testPages = map[PageToken]struct {
+	items []int
+	next  PageToken
+}{
+	"":   {[]int{1, 2}, "p2"},
+	"p2": {[]int{3}, "p3"},
+	"p3": {[]int{4, 5}, ""},
+}
+
+func (l *testListing) fetch(pageToken PageToken) ([]int, PageToken, error) {
+	l.mutex.Lock()
+	l.fetched = append(l.fetched, pageToken)
+	l.mutex.Unlock()
+	if pageToken == l.failAt && l.failAt != "" {
+		return nil, "", errors.New("fetch failed")
+	}
+	page := testPages[pageToken]
+	return page.items, page.next, nil
+}
+
+func TestIteratorNext(t *testing.T) {
+	listing := &testListing{}
+	it := NewIterator(listing.fetch, "")
+	var items []int
+	for it.Next() {
+		items = append(items, it.Item())
+	}
+	if it.Err() != nil {
+		t.Fatal(it.Err())
+	}
+	if want := []int{1, 2, 3, 4, 5}; !reflect.DeepEqual(items, want) {
+		t.Errorf("got %v, want %v", items, want)
+	}
+	if want := []PageToken{"", "p2", "p3"}; !reflect.DeepEqual(listing.fetched, want) {
+		t.Errorf("fetched %v, want %v", listing.fetched, want)
+	}
+	if _, more := it.Checkpoint(); more {
+		t.Error("checkpoint after the last page")
+	}
+}
+
+func TestIteratorPrefetch(t *testing.T) {
+	// The next page is fetched while the current one is consumed
+	release := make(chan struct{})
+	fetching := make(chan PageToken, 3)
+	it := NewIterator(func(pageToken PageToken) ([]int, PageToken, error) {
+		fetching <- pageToken
+		if pageToken != "" {
+			<-release
+		}
+		page := testPages[pageToken]
+		return page.items, page.next, nil
+	}, "")
+	if !it.NextPage() {
+		t.Fatal(it.Err())
+	}
+	if token := <-fetching; token != "" {
+		t.Fatalf("first fetch of %q", token)
+	}
+	if token := <-fetching; token != "p2" {
+		t.Errorf("prefetch of %q, want p2", token)
+	}
+	if page := it.Page(); !reflect.DeepEqual(page, []int{1, 2}) {
+		t.Errorf("page %v", page)
+	}
+
+	// Closing discards the page being prefetched
+	it.Close()
+	close(release)
+	if it.Next() || it.NextPage() {
+		t.Error("iteration after Close")
+	}
+	if it.Err() != nil {
+		t.Errorf("error after Close: %v", it.Err())
+	}
+}
+
+func TestIteratorCheckpoint(t *testing.T) {
+	listing := &testListing{}
+	it := NewIterator(listing.fetch, "")
+	for i := 0; i < 3; i++ {
+		it.Next()
+	}
+	it.Close()
+
+	// Item 3 is the only one of the page p2: the next iteration starts from p3
+	token, more := it.Checkpoint()
+	if !more || token != "p3" {
+		t.Fatalf("checkpoint %q, %v", token, more)
+	}
+
+	resumed := NewIterator(listing.fetch, "")
+	resumed.Next()
+	resumed.Close()
+	if token, more = resumed.Checkpoint(); !more || token != "" {
+		t.Errorf("checkpoint in the first page %q, %v", token, more)
+	}
+}
+
+func TestIteratorError(t *testing.T) {
+	listing := &testListing{failAt: "p2"}
+	var pages [][]int
+	var cbErr error
+	all, err := listAll(NewIterator(listing.fetch, ""), func(page []int, err error) {
+		if err != nil {
+			cbErr = err
+		} else {
+			pages = append(pages, page)
+		}
+	})
+	if err == nil || cbErr != err {
+		t.Errorf("error %v, callback error %v", err, cbErr)
+	}
+	if !reflect.DeepEqual(all, []int{1, 2}) || !reflect.DeepEqual(pages, [][]int{{1, 2}}) {
+		t.Errorf("got %v and pages %v", all, pages)
+	}
+}
+
+func TestListAll(t *testing.T) {
+	listing := &testListing{}
+	all, err := listAll(NewIterator(listing.fetch, "p2"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{3, 4, 5}; !reflect.DeepEqual(all, want) {
+		t.Errorf("got %v, want %v", all, want)
+	}
+}
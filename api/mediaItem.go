@@ -6,10 +6,15 @@ import (
 	"github.com/GaPhi/gphotosuploader/auth"
 )
 
+const (
+	// Key of the video information in the additional information of a media item
+	videoInfoKey = "76647426"
+)
+
 // MediaItem represents a media item (picture, video)
 type MediaItem struct {
 	// Media item identifier
-	MediaItemId string
+	MediaItemId MediaKey
 
 	// Media item content URL
 	ContentUrl string
@@ -34,36 +39,26 @@ type MediaItem struct {
 
 	// Filename of the media item
 	Filename string
+
+	// True for a video
+	IsVideo bool
 }
 
-// List all media items before a date
+// List all media items before a date. The optional callback is called with each page of media items, and with the
+// error that stops the listing, if any
 func ListAllMediaItemsBefore(credentials auth.CookieCredentials, before interface{}, cb func([]MediaItem, error)) ([]MediaItem, error) {
-	var (
-		nextPageToken interface{}
-		allMediaItems = []MediaItem{}
-		mediaItems    []MediaItem
-		err           error
-	)
+	return listAll(IterateMediaItemsBefore(credentials, before, ""), cb)
+}
 
-	// Fetch all pages, several media items at once
-	for {
-		mediaItems, nextPageToken, err = ListMediaItems(credentials, before, nextPageToken)
-		if cb != nil {
-			cb(mediaItems, err)
-		}
-		if err != nil {
-			return allMediaItems, err
-		}
-		allMediaItems = append(allMediaItems, mediaItems...)
-		if nextPageToken == nil || nextPageToken == "" {
-			// Return result
-			return allMediaItems, nil
-		}
-	}
+// Iterate over the media items before a date, starting from the given page
+func IterateMediaItemsBefore(credentials auth.CookieCredentials, before interface{}, start PageToken) *Iterator[MediaItem] {
+	return NewIterator(func(pageToken PageToken) ([]MediaItem, PageToken, error) {
+		return ListMediaItems(credentials, before, pageToken)
+	}, start)
 }
 
 // List media items by page
-func ListMediaItems(credentials auth.CookieCredentials, before interface{}, pageToken interface{}) ([]MediaItem, interface{}, error) {
+func ListMediaItems(credentials auth.CookieCredentials, before interface{}, pageToken PageToken) ([]MediaItem, PageToken, error) {
 	innerJson := []interface{}{
 		pageToken, // Page token
 		before,    // Before this date (in ms)
@@ -76,7 +71,7 @@ func ListMediaItems(credentials auth.CookieCredentials, before interface{}, page
 	}
 	innerJsonString, err := json.Marshal(innerJson)
 	if err != nil {
-		return nil, nil, err
+		return nil, "", err
 	}
 	jsonReq := []interface{}{
 		[]interface{}{
@@ -90,7 +85,7 @@ func ListMediaItems(credentials auth.CookieCredentials, before interface{}, page
 	}
 	innerJsonRes, err := doRequest(credentials, jsonReq)
 	if err != nil {
-		return nil, nil, err
+		return nil, "", err
 	}
 
 	mediaItems := []MediaItem{}
@@ -98,81 +93,94 @@ func ListMediaItems(credentials auth.CookieCredentials, before interface{}, page
 		if err != nil {
 			return
 		}
-		var mediaItem MediaItem
-		mediaItem.MediaItemId, err = jsonparser.GetString(value, "[0]")
+		mediaItem, err := parseMediaItem(value)
 		if err != nil {
 			return
 		}
-		mediaItem.ContentUrl, err = jsonparser.GetString(value, "[1]", "[0]")
-		if err != nil {
-			return
-		}
-		mediaItem.ContentWidth, err = jsonparser.GetInt(value, "[1]", "[1]")
-		if err != nil {
-			return
-		}
-		mediaItem.ContentHeight, err = jsonparser.GetInt(value, "[1]", "[2]")
-		if err != nil {
-			return
-		}
-		mediaItem.StartDate, err = jsonparser.GetInt(value, "[2]")
-		if err != nil {
-			return
-		}
-		mediaItem.EndDate, err = jsonparser.GetInt(value, "[5]")
-		if err != nil {
-			return
-		}
-		// This data is not always present (2025-10-25: last array index is 9)
-		// As this is not used by this tool, we just ignore the potential error
-		mediaItem.MediaItemSn, err = jsonparser.GetInt(value, "[14]")
-//		if err != nil {
-//			return
-//		}
 		mediaItems = append(mediaItems, mediaItem)
 	}, "[0]")
 
 	nextPageToken, err := jsonparser.GetString(innerJsonRes, "[1]")
 	if err != nil {
-		return mediaItems, nil, nil
+		return mediaItems, "", nil
 	}
-	return mediaItems, nextPageToken, nil
+	return mediaItems, PageToken(nextPageToken), nil
 }
 
-// List all unsupported media items
-func ListAllUnsupportedMediaItemsBefore(credentials auth.CookieCredentials, cb func([]MediaItem, error)) ([]MediaItem, error) {
+// Parse a media item as returned by the library and album listings
+func parseMediaItem(value []byte) (MediaItem, error) {
 	var (
-		nextPageToken interface{}
-		allMediaItems = []MediaItem{}
-		mediaItems    []MediaItem
-		err           error
+		mediaItem MediaItem
+		err       error
 	)
+	mediaItemId, err := jsonparser.GetString(value, "[0]")
+	if err != nil {
+		return mediaItem, err
+	}
+	mediaItem.MediaItemId = MediaKey(mediaItemId)
+	mediaItem.ContentUrl, err = jsonparser.GetString(value, "[1]", "[0]")
+	if err != nil {
+		return mediaItem, err
+	}
+	mediaItem.ContentWidth, err = jsonparser.GetInt(value, "[1]", "[1]")
+	if err != nil {
+		return mediaItem, err
+	}
+	mediaItem.ContentHeight, err = jsonparser.GetInt(value, "[1]", "[2]")
+	if err != nil {
+		return mediaItem, err
+	}
+	mediaItem.StartDate, err = jsonparser.GetInt(value, "[2]")
+	if err != nil {
+		return mediaItem, err
+	}
+	mediaItem.EndDate, err = jsonparser.GetInt(value, "[5]")
+	if err != nil {
+		return mediaItem, err
+	}
+	// This data is not always present (2025-10-25: last array index is 9)
+	// As this is not used by this tool, we just ignore the potential error
+	mediaItem.MediaItemSn, _ = jsonparser.GetInt(value, "[14]")
+	mediaItem.IsVideo = isVideoMediaItem(value)
+	return mediaItem, nil
+}
 
-	// Fetch all pages, several media items at once
-	for {
-		mediaItems, nextPageToken, err = ListUnsupportedMediaItems(credentials, nextPageToken)
-		if cb != nil {
-			cb(mediaItems, err)
-		}
-		if err != nil {
-			return allMediaItems, err
-		}
-		allMediaItems = append(allMediaItems, mediaItems...)
-		if nextPageToken == nil || nextPageToken == "" {
-			// Return result
-			return allMediaItems, nil
+// Videos have a video information object, stored in the object of additional information that ends the media item
+func isVideoMediaItem(value []byte) bool {
+	var info []byte
+	_, _ = jsonparser.ArrayEach(value, func(element []byte, dataType jsonparser.ValueType, offset int, err error) {
+		if dataType == jsonparser.Object {
+			info = element
 		}
+	})
+	if info == nil {
+		return false
 	}
+	_, _, _, err := jsonparser.Get(info, videoInfoKey)
+	return err == nil
+}
+
+// List all unsupported media items. The optional callback is called with each page of media items, and with the
+// error that stops the listing, if any
+func ListAllUnsupportedMediaItemsBefore(credentials auth.CookieCredentials, cb func([]MediaItem, error)) ([]MediaItem, error) {
+	return listAll(IterateUnsupportedMediaItems(credentials, ""), cb)
+}
+
+// Iterate over the unsupported media items, starting from the given page
+func IterateUnsupportedMediaItems(credentials auth.CookieCredentials, start PageToken) *Iterator[MediaItem] {
+	return NewIterator(func(pageToken PageToken) ([]MediaItem, PageToken, error) {
+		return ListUnsupportedMediaItems(credentials, pageToken)
+	}, start)
 }
 
 // List unsupported media items by page
-func ListUnsupportedMediaItems(credentials auth.CookieCredentials, pageToken interface{}) ([]MediaItem, interface{}, error) {
+func ListUnsupportedMediaItems(credentials auth.CookieCredentials, pageToken PageToken) ([]MediaItem, PageToken, error) {
 	innerJson := []interface{}{
 		pageToken, // Page token
 	}
 	innerJsonString, err := json.Marshal(innerJson)
 	if err != nil {
-		return nil, nil, err
+		return nil, "", err
 	}
 	jsonReq := []interface{}{
 		[]interface{}{
@@ -186,7 +194,7 @@ func ListUnsupportedMediaItems(credentials auth.CookieCredentials, pageToken int
 	}
 	innerJsonRes, err := doRequest(credentials, jsonReq)
 	if err != nil {
-		return nil, nil, err
+		return nil, "", err
 	}
 
 	mediaItems := []MediaItem{}
@@ -195,10 +203,11 @@ func ListUnsupportedMediaItems(credentials auth.CookieCredentials, pageToken int
 			return
 		}
 		var mediaItem MediaItem
-		mediaItem.MediaItemId, err = jsonparser.GetString(value, "[0]")
+		mediaItemId, err := jsonparser.GetString(value, "[0]")
 		if err != nil {
 			return
 		}
+		mediaItem.MediaItemId = MediaKey(mediaItemId)
 		mediaItem.Filename, err = jsonparser.GetString(value, "[1]")
 		if err != nil {
 			return
@@ -232,25 +241,25 @@ func ListUnsupportedMediaItems(credentials auth.CookieCredentials, pageToken int
 
 	nextPageToken, err := jsonparser.GetString(innerJsonRes, "[0]")
 	if err != nil {
-		return mediaItems, nil, nil
+		return mediaItems, "", nil
 	}
-	return mediaItems, nextPageToken, nil
+	return mediaItems, PageToken(nextPageToken), nil
 }
 
 // DeleteMediaItems a media item
 // kind=1 for Send to trash
 // kind=2 for Immediate deletion
 // kind=3 for Restore from trash
-func DeleteMediaItems(credentials auth.CookieCredentials, mediaItemIds []string, kind int) error {
+func DeleteMediaItems(credentials auth.CookieCredentials, mediaItemIds []MediaKey, kind int) error {
 	// 250 max at once
 	for len(mediaItemIds) > 0 {
-		var ids []string
+		var ids []MediaKey
 		if len(mediaItemIds) > 250 {
 			ids = mediaItemIds[0:250]
 			mediaItemIds = mediaItemIds[250:]
 		} else {
 			ids = mediaItemIds
-			mediaItemIds = []string{}
+			mediaItemIds = []MediaKey{}
 		}
 
 		innerJson := []interface{}{
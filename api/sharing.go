@@ -0,0 +1,299 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/GaPhi/gphotosuploader/auth"
+	"github.com/buger/jsonparser"
+)
+
+// AlbumMember represents a member of a shared album
+type AlbumMember struct {
+	// Google user identifier
+	UserId string
+
+	// Display name of the member
+	Name string
+
+	// True if the member owns the album
+	Owner bool
+}
+
+// Sharing options of a shared album
+type AlbumSharingOptions struct {
+	// Members can add their own photos and videos
+	Collaborate bool
+
+	// Members can comment and like
+	Comments bool
+}
+
+// Find the shared album id of an album owned by the user
+func FindSharedAlbumId(credentials auth.CookieCredentials, albumId AlbumID) (SharedAlbumID, error) {
+	albums, err := ListAllAlbums(credentials, nil)
+	if err != nil {
+		return "", err
+	}
+	for _, album := range albums {
+		if album.AlbumId == albumId && album.SharedAlbumId != "" {
+			return album.SharedAlbumId, nil
+		}
+	}
+	return "", fmt.Errorf("album '%v' is not shared", albumId)
+}
+
+// Error of FindAlbumId when the shared album is not one of the albums of the user
+var ErrAlbumNotOwned = errors.New("the shared album is not owned by the user")
+
+// Find the album id of a shared album owned by the user
+func FindAlbumId(credentials auth.CookieCredentials, sharedAlbumId SharedAlbumID) (AlbumID, error) {
+	albums, err := ListAllAlbums(credentials, nil)
+	if err != nil {
+		return "", err
+	}
+	for _, album := range albums {
+		if album.SharedAlbumId == sharedAlbumId && album.AlbumId != "" {
+			return album.AlbumId, nil
+		}
+	}
+	return "", fmt.Errorf("shared album '%v': %w", sharedAlbumId, ErrAlbumNotOwned)
+}
+
+// List the members of a shared album
+func ListSharedAlbumMembers(credentials auth.CookieCredentials, sharedAlbumId SharedAlbumID) ([]AlbumMember, error) {
+	innerJson := []interface{}{
+		sharedAlbumId,
+		nil,
+		nil,
+		nil,
+		1,
+	}
+	innerJsonString, err := json.Marshal(innerJson)
+	if err != nil {
+		return nil, err
+	}
+	jsonReq := []interface{}{
+		[]interface{}{
+			[]interface{}{
+				"fDcn4b",
+				string(innerJsonString),
+				nil,
+				"generic",
+			},
+		},
+	}
+	innerJsonRes, err := doRequest(credentials, jsonReq)
+	if err != nil {
+		return nil, err
+	}
+
+	ownerId, _ := jsonparser.GetString(innerJsonRes, "[0]", "[5]", "[0]")
+	members := []AlbumMember{}
+	_, err = jsonparser.ArrayEach(innerJsonRes, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+		if err != nil {
+			return
+		}
+		var member AlbumMember
+		member.UserId, err = jsonparser.GetString(value, "[0]")
+		if err != nil {
+			return
+		}
+		member.Name, _ = jsonparser.GetString(value, "[11]", "[0]")
+		member.Owner = member.UserId == ownerId
+		members = append(members, member)
+	}, "[0]", "[12]")
+	if err != nil {
+		return nil, unexpectedResponse(innerJsonRes)
+	}
+
+	return members, nil
+}
+
+// Remove a user from a shared album
+func AlbumShareRemoveUser(credentials auth.CookieCredentials, sharedAlbumId SharedAlbumID, userId string) error {
+	innerJson := []interface{}{
+		sharedAlbumId,
+		[]interface{}{
+			userId,
+		},
+	}
+	innerJsonString, err := json.Marshal(innerJson)
+	if err != nil {
+		return err
+	}
+	jsonReq := []interface{}{
+		[]interface{}{
+			[]interface{}{
+				"Ovn9Pd",
+				string(innerJsonString),
+				nil,
+				"generic",
+			},
+		},
+	}
+	_, err = doRequest(credentials, jsonReq)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Create a shareable link to an album, leaving its collaboration and comments options unchanged. It returns the shared
+// album id and the link
+func CreateAlbumShareLink(credentials auth.CookieCredentials, albumId AlbumID) (SharedAlbumID, string, error) {
+	innerJson := []interface{}{
+		nil,
+		nil,
+		[]interface{}{
+			nil,
+			true,
+			nil,
+			nil,
+			true,
+			nil,
+			[]interface{}{
+				[]interface{}{[]interface{}{3, 1}, true},
+			},
+		},
+		[]interface{}{
+			1,
+			[]interface{}{[]interface{}{albumId}, []interface{}{1, 2, 3}},
+			[]interface{}{},
+			nil,
+			nil,
+			[]interface{}{},
+			[]interface{}{1},
+			nil,
+			nil,
+			nil,
+			[]interface{}{},
+		},
+		nil,
+		nil,
+		nil,
+		nil,
+		[]interface{}{1, 2, 3},
+	}
+	innerJsonString, err := json.Marshal(innerJson)
+	if err != nil {
+		return "", "", err
+	}
+	jsonReq := []interface{}{
+		[]interface{}{
+			[]interface{}{
+				"SFKp8c",
+				string(innerJsonString),
+				nil,
+				"generic",
+			},
+		},
+	}
+	innerJsonRes, err := doRequest(credentials, jsonReq)
+	if err != nil {
+		return "", "", err
+	}
+
+	sharedAlbumId, err := jsonparser.GetString(innerJsonRes, "[0]")
+	if err != nil {
+		return "", "", unexpectedResponse(innerJsonRes)
+	}
+	link, err := jsonparser.GetString(innerJsonRes, "[1]")
+	if err != nil {
+		return "", "", unexpectedResponse(innerJsonRes)
+	}
+
+	return SharedAlbumID(sharedAlbumId), link, nil
+}
+
+// Revoke the shareable link of a shared album. Members keep their access
+func RevokeAlbumShareLink(credentials auth.CookieCredentials, sharedAlbumId SharedAlbumID) error {
+	return setSharedAlbumSettings(credentials, sharedAlbumId, []interface{}{
+		[]interface{}{[]interface{}{3, 1}, false},
+	})
+}
+
+// Set the collaboration and comments options of a shared album
+func SetAlbumSharingOptions(credentials auth.CookieCredentials, sharedAlbumId SharedAlbumID, options AlbumSharingOptions) error {
+	return setSharedAlbumSettings(credentials, sharedAlbumId, sharingOptionsInterface(options, false)[:4])
+}
+
+// Set the collaboration option of a shared album, leaving the comments option unchanged
+func SetAlbumCollaboration(credentials auth.CookieCredentials, sharedAlbumId SharedAlbumID, collaborate bool) error {
+	options := AlbumSharingOptions{Collaborate: collaborate}
+	return setSharedAlbumSettings(credentials, sharedAlbumId, sharingOptionsInterface(options, false)[0:2])
+}
+
+// Set the comments option of a shared album, leaving the collaboration option unchanged
+func SetAlbumComments(credentials auth.CookieCredentials, sharedAlbumId SharedAlbumID, comments bool) error {
+	options := AlbumSharingOptions{Comments: comments}
+	return setSharedAlbumSettings(credentials, sharedAlbumId, sharingOptionsInterface(options, false)[2:4])
+}
+
+// Leave an album shared by someone else
+func LeaveSharedAlbum(credentials auth.CookieCredentials, sharedAlbumId SharedAlbumID) error {
+	innerJson := []interface{}{
+		sharedAlbumId,
+	}
+	innerJsonString, err := json.Marshal(innerJson)
+	if err != nil {
+		return err
+	}
+	jsonReq := []interface{}{
+		[]interface{}{
+			[]interface{}{
+				"qC5K1",
+				string(innerJsonString),
+				nil,
+				"generic",
+			},
+		},
+	}
+	_, err = doRequest(credentials, jsonReq)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func setSharedAlbumSettings(credentials auth.CookieCredentials, sharedAlbumId SharedAlbumID, settings []interface{}) error {
+	innerJson := []interface{}{
+		sharedAlbumId,
+		settings,
+	}
+	innerJsonString, err := json.Marshal(innerJson)
+	if err != nil {
+		return err
+	}
+	jsonReq := []interface{}{
+		[]interface{}{
+			[]interface{}{
+				"UD0V5",
+				string(innerJsonString),
+				nil,
+				"generic",
+			},
+		},
+	}
+	_, err = doRequest(credentials, jsonReq)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Sharing options as sent by the web app: [1, x] are the collaboration options, [2, x] the comments options and
+// [3, 1] the link sharing
+func sharingOptionsInterface(options AlbumSharingOptions, link bool) []interface{} {
+	return []interface{}{
+		[]interface{}{[]interface{}{1, 1}, options.Collaborate},
+		[]interface{}{[]interface{}{1, 2}, options.Collaborate},
+		[]interface{}{[]interface{}{2, 1}, options.Comments},
+		[]interface{}{[]interface{}{2, 2}, options.Comments},
+		[]interface{}{[]interface{}{3, 1}, link},
+	}
+}
@@ -9,6 +9,11 @@ import (
 
 // Create Album
 func QueryStorage(credentials auth.CookieCredentials) (int64, int64, error) {
+	return queryStorage(credentials, true)
+}
+
+// QueryStorage, scraping a new at token when Google refuses the current one only if refresh is true
+func queryStorage(credentials auth.CookieCredentials, refresh bool) (int64, int64, error) {
 	innerJson := []interface{}{
 		[]interface{}{
 			[]interface{}{
@@ -97,7 +102,7 @@ func QueryStorage(credentials auth.CookieCredentials) (int64, int64, error) {
 			},
 		},
 	}
-	innerJsonRes, err := doRequest(credentials, jsonReq)
+	innerJsonRes, err := doRequestRefreshing(credentials, jsonReq, refresh)
 	if err != nil {
 		return -1, -1, err
 	}
@@ -6,43 +6,32 @@ import (
 	"github.com/GaPhi/gphotosuploader/auth"
 )
 
-// TimelineEntry represents an entry of the timeline
+// TimelineEntry represents an entry of the timeline: the number of media items taken during a period
 type TimelineEntry struct {
-	// From
-	from int64
+	// Start of the period (Unix timestamp in ms)
+	From int64
 
-	// To
-	to int64
+	// End of the period (Unix timestamp in ms)
+	To int64
 
 	// Media Items Count
-	mediaCount int64
+	MediaCount int64
 }
 
 // Get whole timeline
 func GetWholeTimeline(credentials auth.CookieCredentials) ([]TimelineEntry, error) {
-	var (
-		nextPageToken interface{}
-		allEntries    = []TimelineEntry{}
-		entries       []TimelineEntry
-		err           error
-	)
+	return listAll(IterateTimeline(credentials, ""), nil)
+}
 
-	// Fetch all pages, 100 entries at once
-	for {
-		entries, nextPageToken, err = GetTimelineEntries(credentials, nextPageToken)
-		if err != nil {
-			return allEntries, err
-		}
-		allEntries = append(allEntries, entries...)
-		if nextPageToken == nil || nextPageToken == "" {
-			// Return result
-			return allEntries, nil
-		}
-	}
+// Iterate over the timeline entries, starting from the given page
+func IterateTimeline(credentials auth.CookieCredentials, start PageToken) *Iterator[TimelineEntry] {
+	return NewIterator(func(pageToken PageToken) ([]TimelineEntry, PageToken, error) {
+		return GetTimelineEntries(credentials, pageToken)
+	}, start)
 }
 
 // Get timeline entries by page
-func GetTimelineEntries(credentials auth.CookieCredentials, pageToken interface{}) ([]TimelineEntry, interface{}, error) {
+func GetTimelineEntries(credentials auth.CookieCredentials, pageToken PageToken) ([]TimelineEntry, PageToken, error) {
 	innerJson := []interface{}{
 		pageToken, // Page token
 		nil,
@@ -50,7 +39,7 @@ func GetTimelineEntries(credentials auth.CookieCredentials, pageToken interface{
 	}
 	innerJsonString, err := json.Marshal(innerJson)
 	if err != nil {
-		return nil, nil, err
+		return nil, "", err
 	}
 	jsonReq := []interface{}{
 		[]interface{}{
@@ -64,7 +53,7 @@ func GetTimelineEntries(credentials auth.CookieCredentials, pageToken interface{
 	}
 	innerJsonRes, err := doRequest(credentials, jsonReq)
 	if err != nil {
-		return nil, nil, err
+		return nil, "", err
 	}
 
 	entries := []TimelineEntry{}
@@ -73,15 +62,15 @@ func GetTimelineEntries(credentials auth.CookieCredentials, pageToken interface{
 			return
 		}
 		var entry TimelineEntry
-		entry.from, err = jsonparser.GetInt(value, "[0]")
+		entry.From, err = jsonparser.GetInt(value, "[0]")
 		if err != nil {
 			return
 		}
-		entry.to, err = jsonparser.GetInt(value, "[1]")
+		entry.To, err = jsonparser.GetInt(value, "[1]")
 		if err != nil {
 			return
 		}
-		entry.mediaCount, err = jsonparser.GetInt(value, "[2]")
+		entry.MediaCount, err = jsonparser.GetInt(value, "[2]")
 		if err != nil {
 			return
 		}
@@ -90,7 +79,7 @@ func GetTimelineEntries(credentials auth.CookieCredentials, pageToken interface{
 
 	nextPageToken, err := jsonparser.GetString(innerJsonRes, "[2]")
 	if err != nil {
-		return entries, nil, nil
+		return entries, "", nil
 	}
-	return entries, nextPageToken, nil
+	return entries, PageToken(nextPageToken), nil
 }
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Source of the timestamp of an uploaded file
+type TimestampSource int
+
+const (
+	// EXIF date of the picture (JPEG, HEIC, AVIF and raw files)
+	TimestampFromExif TimestampSource = iota + 1
+
+	// Creation time of the movie header (QuickTime and MP4 videos)
+	TimestampFromVideo
+
+	// Modification time of the file
+	TimestampFromModTime
+)
+
+// Precedence used when the caller doesn't choose one
+var DefaultTimestampSources = []TimestampSource{TimestampFromExif, TimestampFromVideo, TimestampFromModTime}
+
+// Parse a list of timestamp sources separated by commas, like "exif,video,mtime"
+func ParseTimestampSources(value string) ([]TimestampSource, error) {
+	var sources []TimestampSource
+	for _, name := range strings.Split(value, ",") {
+		switch strings.TrimSpace(name) {
+		case "exif":
+			sources = append(sources, TimestampFromExif)
+		case "video":
+			sources = append(sources, TimestampFromVideo)
+		case "mtime":
+			sources = append(sources, TimestampFromModTime)
+		default:
+			return nil, fmt.Errorf("unknown timestamp source '%v' (exif, video or mtime)", name)
+		}
+	}
+	return sources, nil
+}
+
+func (s TimestampSource) String() string {
+	switch s {
+	case TimestampFromExif:
+		return "exif"
+	case TimestampFromVideo:
+		return "video"
+	case TimestampFromModTime:
+		return "mtime"
+	}
+	return "unknown"
+}
+
+// Get the timestamp of a file from the first source that has one. The modification time is used if none of the
+// sources has a timestamp
+func FileTimestamp(file *os.File, sources ...TimestampSource) (time.Time, TimestampSource, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("can't read file information (%v)", err)
+	}
+	if len(sources) == 0 {
+		sources = DefaultTimestampSources
+	}
+
+	for _, source := range sources {
+		var (
+			date time.Time
+			err  error
+		)
+		switch source {
+		case TimestampFromExif:
+			date, err = exifDateTimeOriginal(file, info.Size())
+		case TimestampFromVideo:
+			date, err = videoCreationTime(file, info.Size())
+		case TimestampFromModTime:
+			date = info.ModTime()
+		}
+		if err == nil && !date.IsZero() {
+			return date, source, nil
+		}
+	}
+	return info.ModTime(), TimestampFromModTime, nil
+}
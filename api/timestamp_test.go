@@ -0,0 +1,154 @@
+package api
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// The files of testdata are minimal: they only have the structure needed to find their dates
+var (
+	exifOriginal = time.Date(2021, 6, 15, 10, 20, 30, 0, time.FixedZone("", 2*60*60))
+	exifDateTime = time.Date(2020, 1, 2, 3, 4, 5, 0, time.Local)
+	cr3Original  = time.Date(2022, 3, 4, 5, 6, 7, 0, time.Local)
+)
+
+func TestExifDateTimeOriginal(t *testing.T) {
+	tests := []struct {
+		file string
+		date time.Time
+	}{
+		{"exif-le.tif", exifOriginal},
+		{"datetime-be.tif", exifDateTime},
+		{"exif.jpg", exifOriginal},
+		{"exif.raf", exifOriginal},
+		{"exif.cr3", cr3Original},
+		{"exif.heic", exifOriginal},
+		{"video.mp4", time.Time{}},
+	}
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", test.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			date, err := exifDateTimeOriginal(bytes.NewReader(data), int64(len(data)))
+			if test.date.IsZero() {
+				if err == nil {
+					t.Errorf("got %v, want an error", date)
+				}
+				return
+			}
+			if err != nil || !date.Equal(test.date) {
+				t.Errorf("got %v, %v, want %v", date, err, test.date)
+			}
+		})
+	}
+}
+
+func TestVideoCreationTime(t *testing.T) {
+	tests := []struct {
+		file string
+		date time.Time
+	}{
+		{"video.mp4", time.Date(2021, 6, 15, 8, 20, 30, 0, time.UTC)},
+		{"video.mov", time.Date(2019, 7, 15, 12, 20, 30, 0, time.UTC)},
+		{"no-date.mp4", time.Time{}},
+		{"exif.heic", time.Time{}},
+	}
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", test.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			date, err := videoCreationTime(bytes.NewReader(data), int64(len(data)))
+			if test.date.IsZero() {
+				if err == nil {
+					t.Errorf("got %v, want an error", date)
+				}
+				return
+			}
+			if err != nil || !date.Equal(test.date) {
+				t.Errorf("got %v, %v, want %v", date, err, test.date)
+			}
+		})
+	}
+}
+
+// The truncated and corrupt files must be refused, without panic
+func TestTimestampCorruptFiles(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for size := 0; size < len(data); size++ {
+			_, _ = exifDateTimeOriginal(bytes.NewReader(data[:size]), int64(size))
+			_, _ = videoCreationTime(bytes.NewReader(data[:size]), int64(size))
+		}
+		for i := range data {
+			corrupt := append([]byte{}, data...)
+			corrupt[i] ^= 0xff
+			_, _ = exifDateTimeOriginal(bytes.NewReader(corrupt), int64(len(corrupt)))
+			_, _ = videoCreationTime(bytes.NewReader(corrupt), int64(len(corrupt)))
+		}
+	}
+}
+
+func TestFileTimestamp(t *testing.T) {
+	modTime := time.Date(2010, 5, 6, 7, 8, 9, 0, time.UTC)
+	tests := []struct {
+		file    string
+		sources []TimestampSource
+		date    time.Time
+		source  TimestampSource
+	}{
+		{"exif.jpg", nil, exifOriginal, TimestampFromExif},
+		{"video.mp4", nil, time.Date(2021, 6, 15, 8, 20, 30, 0, time.UTC), TimestampFromVideo},
+		{"no-date.mp4", nil, modTime, TimestampFromModTime},
+		{"exif.jpg", []TimestampSource{TimestampFromModTime, TimestampFromExif}, modTime, TimestampFromModTime},
+		{"video.mp4", []TimestampSource{TimestampFromExif}, modTime, TimestampFromModTime},
+	}
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), test.file)
+		data, err := os.ReadFile(filepath.Join("testdata", test.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		date, source, err := FileTimestamp(file, test.sources...)
+		_ = file.Close()
+		if err != nil || !date.Equal(test.date) || source != test.source {
+			t.Errorf("FileTimestamp(%v, %v) = %v, %v, %v, want %v, %v", test.file, test.sources, date, source, err,
+				test.date, test.source)
+		}
+	}
+}
+
+func TestParseTimestampSources(t *testing.T) {
+	sources, err := ParseTimestampSources("exif, mtime,video")
+	want := []TimestampSource{TimestampFromExif, TimestampFromModTime, TimestampFromVideo}
+	if err != nil || !reflect.DeepEqual(sources, want) {
+		t.Errorf("got %v, %v, want %v", sources, err, want)
+	}
+	if _, err := ParseTimestampSources("exif,ctime"); err == nil {
+		t.Error("no error for an unknown source")
+	}
+}
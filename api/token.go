@@ -0,0 +1,63 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/GaPhi/gphotosuploader/auth"
+)
+
+var (
+	// Optional function called each time a new at token has been scraped, for example to save the cookies refreshed
+	// by the request to the Google Photos homepage
+	OnAtTokenRefreshed func(credentials auth.CookieCredentials)
+)
+
+// Scrape a new at token and set it in the runtime parameters of the credentials. The request to the Google Photos
+// homepage also refreshes the cookies of the credentials, which keeps the session alive
+func RefreshAtToken(credentials auth.CookieCredentials) error {
+	credentials.RuntimeParameters.AtTokenMutex.Lock()
+	defer credentials.RuntimeParameters.AtTokenMutex.Unlock()
+	return refreshAtToken(credentials)
+}
+
+// Scrape a new at token after an authentication failure with the stale token, unless another goroutine already did it
+func refreshStaleAtToken(credentials auth.CookieCredentials, staleToken string) error {
+	credentials.RuntimeParameters.AtTokenMutex.Lock()
+	defer credentials.RuntimeParameters.AtTokenMutex.Unlock()
+	if credentials.RuntimeParameters.AtToken != staleToken {
+		return nil
+	}
+	return refreshAtToken(credentials)
+}
+
+func refreshAtToken(credentials auth.CookieCredentials) error {
+	token, err := scrapeAtToken(credentials)
+	if err != nil {
+		return err
+	}
+	credentials.RuntimeParameters.AtToken = token
+	if OnAtTokenRefreshed != nil {
+		OnAtTokenRefreshed(credentials)
+	}
+	return nil
+}
+
+// Scrape a new at token, without changing the credentials
+func scrapeAtToken(credentials auth.CookieCredentials) (string, error) {
+	token, err := NewAtTokenScraper(credentials).ScrapeNewAtToken()
+	if err != nil {
+		return "", fmt.Errorf("can't scrape a new at token (%v)", err)
+	}
+	if token == "" {
+		return "", errors.New("can't scrape a new at token, the cookies may have expired")
+	}
+	return token, nil
+}
+
+// Current at token of the credentials
+func atToken(credentials auth.CookieCredentials) string {
+	credentials.RuntimeParameters.AtTokenMutex.Lock()
+	defer credentials.RuntimeParameters.AtTokenMutex.Unlock()
+	return credentials.RuntimeParameters.AtToken
+}
@@ -18,6 +18,10 @@ import (
 
 var (
 	RegexUploadedImageURL = regexp.MustCompile(`^https://(?:lh3\.googleusercontent\.com|photos\.fife\.usercontent\.google\.com)/([\w-/]+)$`)
+
+	// Optional function called with the duration of each step of the uploads: requestUploadURL, uploadFile,
+	// enablePhoto and moveToAlbum. It can be called by several goroutines at the same time
+	ObserveUploadStep func(step string, duration time.Duration)
 )
 
 // UploadOptions contains the Upload options
@@ -35,23 +39,32 @@ type UploadOptions struct {
 	// UNIX timestamp of the photo (optional)
 	Timestamp int64
 
+	// Where the timestamp comes from
+	TimestampSource TimestampSource
+
 	// Optional album id
-	AlbumId string
+	AlbumId AlbumID
 }
 
-// NewUploadOptionsFromFile creates a new UploadOptions from a file
-func NewUploadOptionsFromFile(file *os.File) (*UploadOptions, error) {
+// NewUploadOptionsFromFile creates a new UploadOptions from a file. The timestamp is taken from the first of the given
+// sources that has one (DefaultTimestampSources if none is given), falling back to the modification time of the file
+func NewUploadOptionsFromFile(file *os.File, sources ...TimestampSource) (*UploadOptions, error) {
 	info, err := file.Stat()
 	if err != nil {
 		return nil, fmt.Errorf("can't read file information (%v)", err)
 	}
+	timestamp, source, err := FileTimestamp(file, sources...)
+	if err != nil {
+		return nil, err
+	}
 
 	return &UploadOptions{
 		Stream:   file,
 		FileSize: info.Size(),
 
-		Name:      path.Base(file.Name()),
-		Timestamp: info.ModTime().Unix() * 1000,
+		Name:            path.Base(file.Name()),
+		Timestamp:       timestamp.Unix() * 1000,
+		TimestampSource: source,
 	}, nil
 }
 
@@ -67,7 +80,7 @@ type Upload struct {
 	url string
 
 	// Id of the image got from the response of the request that enables the image
-	idToMoveIntoAlbum string
+	idToMoveIntoAlbum MediaKey
 }
 
 // NewUpload creates a new Upload given an UploadOptions and a Credentials implementation. This method return an error if the
@@ -94,6 +107,12 @@ func NewUpload(options *UploadOptions, credentials auth.CookieCredentials) (*Upl
 	}, nil
 }
 
+func observeUploadStep(step string, start time.Time) {
+	if ObserveUploadStep != nil {
+		ObserveUploadStep(step, time.Since(start))
+	}
+}
+
 func getImageIDFromURL(URL string) (string, error) {
 	matches := RegexUploadedImageURL.FindStringSubmatch(URL)
 	if len(matches) != 2 {
@@ -115,19 +134,25 @@ func (ur *UploadResult) URLString() string {
 // Upload tries to upload an image, making multiple http requests. It returns a response event if there is an error
 func (u *Upload) Upload() (*UploadResult, error) {
 	// First request to get the upload url
+	start := time.Now()
 	err := u.requestUploadURL()
+	observeUploadStep("requestUploadURL", start)
 	if err != nil {
 		return &UploadResult{Uploaded: false}, errors.New("can't get an upload url. Try to wait about 24h before a new attempt or refer to this issue: https://github.com/simonedegiacomi/gphotosuploader/issues/31")
 	}
 
 	// Upload the real image file
+	start = time.Now()
 	token, err := u.uploadFile()
+	observeUploadStep("uploadFile", start)
 	if err != nil {
 		return &UploadResult{Uploaded: false}, errors.New("can't upload file to the url obtained from the previously request")
 	}
 
 	// Enable the photo
+	start = time.Now()
 	uploadedImageURL, err := u.enablePhoto(token)
+	observeUploadStep("enablePhoto", start)
 	if err != nil {
 		log.Println("[WARNING] The file has been uploaded, but the image URL in the reply was not found. The image may not appear.")
 		return &UploadResult{
@@ -137,7 +162,9 @@ func (u *Upload) Upload() (*UploadResult, error) {
 
 	// Add the image to an album if needed
 	if u.Options.AlbumId != "" {
+		start = time.Now()
 		err = u.moveToAlbum(u.Options.AlbumId)
+		observeUploadStep("moveToAlbum", start)
 		if err != nil {
 			log.Printf("[WARNING] the file has not been placed in the album: %v\n", err)
 		}
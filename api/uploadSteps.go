@@ -190,25 +190,26 @@ func (u *Upload) enablePhoto(uploadTokenBase64 string) (enabledUrl string, err e
 	if err != nil {
 		return "", unexpectedResponse(innerJsonRes)
 	}
-	u.idToMoveIntoAlbum, err = jsonparser.GetString(innerJsonRes, "[0]", "[0]", "[1]", "[0]")
+	idToMoveIntoAlbum, err := jsonparser.GetString(innerJsonRes, "[0]", "[0]", "[1]", "[0]")
 	if err != nil {
 		return "", unexpectedResponse(innerJsonRes)
 	}
+	u.idToMoveIntoAlbum = MediaKey(idToMoveIntoAlbum)
 
 	return eUrl, nil
 }
 
 // This method add the image to an existing album given the id
-func (u *Upload) moveToAlbum(albumId string) error {
+func (u *Upload) moveToAlbum(albumId AlbumID) error {
 	if u.idToMoveIntoAlbum == "" {
 		return errors.New("can't move image to album without the enabled image id")
 	}
 
-	return AlbumAddMediaItems(u.Credentials, albumId, []string{u.idToMoveIntoAlbum})
+	return AlbumAddMediaItems(u.Credentials, albumId, []MediaKey{u.idToMoveIntoAlbum})
 }
 
 // Create Album
-func (u *Upload) createAlbum(albumName string) (string, error) {
+func (u *Upload) createAlbum(albumName string) (AlbumID, error) {
 	if u.idToMoveIntoAlbum == "" {
 		return "", errors.New("can't create album without the enabled image id")
 	}
@@ -249,5 +250,5 @@ func (u *Upload) createAlbum(albumName string) (string, error) {
 		return "", unexpectedResponse(innerJsonRes)
 	}
 
-	return albumId, nil
+	return AlbumID(albumId), nil
 }
@@ -37,11 +37,47 @@ func responseFailure(errTxt string, jsonRes []byte) error {
 	return fmt.Errorf("failure: %v (%v)", errTxt, string(jsonRes))
 }
 
-// doRequest posts up to 3 times the request
+// Error returned when a request fails because the storage of the user is full
+type QuotaExceededError struct {
+	// Storage used and total storage, in bytes
+	Used  int64
+	Total int64
+
+	// Failure reported by Google
+	Failure string
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("failure: No space left: %v/%v (%v%%) (%v)", e.Used, e.Total, 100.0*e.Used/e.Total, e.Failure)
+}
+
+// Error returned when Google refuses a request (401 or 403), with a new at token or without refreshing it: the
+// cookies have expired
+type AuthError struct {
+	// Status of the refused request
+	Status string
+
+	// True if the request was refused again with a new at token
+	Refreshed bool
+}
+
+func (e *AuthError) Error() string {
+	if e.Refreshed {
+		return fmt.Sprintf("request refused with a new at token (%v), the cookies may have expired", e.Status)
+	}
+	return fmt.Sprintf("request refused (%v), the at token or the cookies may have expired", e.Status)
+}
+
+// doRequest posts up to 3 times the request, scraping a new at token once when Google refuses the current one
 // returns innerJson array of bytes if success
 // returns jsonRes array of bytes in case of unexpectedResponse
 // returns nil,error in case of any other error
 func doRequest(credentials auth.CookieCredentials, jsonReq []interface{}) ([]byte, error) {
+	return doRequestRefreshing(credentials, jsonReq, true)
+}
+
+// doRequest, scraping a new at token when Google refuses the current one only if refresh is true
+func doRequestRefreshing(credentials auth.CookieCredentials, jsonReq []interface{}, refresh bool) ([]byte, error) {
 	jsonString, err := json.Marshal(jsonReq)
 	if err != nil {
 		return nil, err
@@ -52,10 +88,12 @@ func doRequest(credentials auth.CookieCredentials, jsonReq []interface{}) ([]byt
 	if LogRequests {
 		log.Printf("Request: %v\n", string(jsonString))
 	}
-	form.Add("at", credentials.RuntimeParameters.AtToken)
 
 	var jsonRes []byte
+	refreshed := false
 	for i := 0; i < 3; i++ {
+		token := atToken(credentials)
+		form.Set("at", token)
 		req, err := http.NewRequest("POST", batchExecuteUrl, strings.NewReader(form.Encode()))
 		if err != nil {
 			return nil, fmt.Errorf("can't create the request: %v", err.Error())
@@ -77,8 +115,26 @@ func doRequest(credentials auth.CookieCredentials, jsonReq []interface{}) ([]byt
 			log.Printf("Response: %v\n", string(jsonRes))
 		}
 
+		// Authentication failure: the at token or the cookies have expired
+		if res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden {
+			if !refresh || refreshed {
+				return jsonRes, &AuthError{Status: res.Status, Refreshed: refreshed}
+			}
+			log.Printf("Request refused (%v), refreshing the at token\n", res.Status)
+			if err := refreshStaleAtToken(credentials, token); err != nil {
+				return jsonRes, err
+			}
+			refreshed = true
+			continue
+		}
+
+		// Invalid request, like an unknown album id: sending it again won't help
+		if res.StatusCode == http.StatusBadRequest {
+			return jsonRes, responseFailure(res.Status, jsonRes)
+		}
+
 		// Valid response?
-		if bytes.Equal(jsonRes[0:len(jsonHeader)], jsonHeader) {
+		if bytes.HasPrefix(jsonRes, jsonHeader) {
 			// Skip first characters
 			jsonRes = jsonRes[len(jsonHeader):]
 			innerJsonRes, err := jsonparser.GetString(jsonRes, "[0]", "[2]")
@@ -90,7 +146,7 @@ func doRequest(credentials auth.CookieCredentials, jsonReq []interface{}) ([]byt
 			spaceUsed, errSpaceUsed := jsonparser.GetInt(jsonRes, "[0]", "[5]", "[2]", "[0]", "[1]", "[1]", "[0]")
 			spaceAllowed, errSpaceAllowed := jsonparser.GetInt(jsonRes, "[0]", "[5]", "[2]", "[0]", "[1]", "[1]", "[1]")
 			if err == nil && errSpaceUsed == nil && errSpaceAllowed == nil && spaceUsed > spaceAllowed {
-				return jsonRes, responseFailure(fmt.Sprintf("No space left: %v/%v (%v%%) (%v)", spaceUsed, spaceAllowed, 100.0*spaceUsed/spaceAllowed, failure), jsonRes)
+				return jsonRes, &QuotaExceededError{Used: spaceUsed, Total: spaceAllowed, Failure: failure}
 			}
 			if err == nil {
 				return jsonRes, responseFailure(failure, jsonRes)
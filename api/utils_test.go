@@ -0,0 +1,53 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/GaPhi/gphotosuploader/auth"
+)
+
+// Transport refusing the requests, and answering the homepage with a new at token
+type refusingTransport struct {
+	requests int
+}
+
+func (t *refusingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == "GET" {
+		page := `<html><script data-id="_gd">window.WIZ_global_data = {"SNlM0e":"new-token","S06Grb":"12345"};</script></html>`
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(page)), Request: req}, nil
+	}
+	t.requests++
+	return &http.Response{StatusCode: http.StatusForbidden, Status: "403 Forbidden", Body: http.NoBody, Request: req}, nil
+}
+
+func TestDoRequestAuthError(t *testing.T) {
+	for _, refresh := range []bool{false, true} {
+		transport := &refusingTransport{}
+		credentials := auth.CookieCredentials{
+			Client:            &http.Client{Transport: transport},
+			RuntimeParameters: &auth.RuntimeParameters{AtToken: "stale-token"},
+		}
+
+		_, err := doRequestRefreshing(credentials, []interface{}{}, refresh)
+		var authErr *AuthError
+		if !errors.As(err, &authErr) {
+			t.Fatalf("refresh %v: got %v, want an AuthError", refresh, err)
+		}
+		if authErr.Refreshed != refresh || authErr.Status != "403 Forbidden" {
+			t.Errorf("refresh %v: got %+v", refresh, authErr)
+		}
+
+		// The request is sent again once, with the new at token
+		requests, token := 1, "stale-token"
+		if refresh {
+			requests, token = 2, "new-token"
+		}
+		if transport.requests != requests || credentials.RuntimeParameters.AtToken != token {
+			t.Errorf("refresh %v: %v requests, at token %q", refresh, transport.requests, credentials.RuntimeParameters.AtToken)
+		}
+	}
+}
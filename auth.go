@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/GaPhi/gphotosuploader/api"
+	"github.com/GaPhi/gphotosuploader/auth"
+	"github.com/GaPhi/gphotosuploader/utils"
+)
+
+const authUsage = `Usage: gphotosuploader auth <command> [arguments]
+
+Commands:
+  check                  Check the cookies of the auth file, the user id, the At token and a request
+  login                  Log in with the WebDriver wizard and write the auth file (see -browser, -webDriver,
+                         -chromeDriver, -browserProfile and -loginTimeout to script it)
+  copy -to STORE         Copy the credentials to another store (like encrypted:auth.enc)
+  import -from FILE      Import the cookies of a cookies.txt file or of a Firefox or Chromium profile
+`
+
+// Options of the WebDriver wizard, set by addLoginFlags
+var (
+	loginOptions        utils.WebDriverOptions
+	loginTimeoutSeconds int
+)
+
+// Register the arguments of the WebDriver wizard on the flag set
+func addLoginFlags(flags *flag.FlagSet) {
+	flags.StringVar(&loginOptions.BrowserName, "browser", "", "Name of the browser of the login wizard (like chrome or firefox, asked if not set)")
+	flags.StringVar(&loginOptions.DriverAddress, "webDriver", "", "Address of the WebDriver of the login wizard (like http://localhost:9515, asked if not set)")
+	flags.StringVar(&loginOptions.ChromeDriver, "chromeDriver", "", "Path of a chromedriver executable started by the login wizard, instead of connecting to a WebDriver")
+	flags.StringVar(&loginOptions.ProfileDir, "browserProfile", "", "Profile directory of the browser of the login wizard, to reuse a profile already logged in Google Photos")
+	flags.BoolVar(&loginOptions.Headless, "headless", false, "Run the browser of the login wizard without window (chrome and firefox only), with a browserProfile already logged in Google Photos")
+	flags.IntVar(&loginTimeoutSeconds, "loginTimeout", 0, "Maximum time to wait for the login in the wizard (seconds, 0: no limit)")
+}
+
+// Options of the WebDriver wizard, once the arguments are parsed
+func webDriverOptions() utils.WebDriverOptions {
+	options := loginOptions
+	options.LoginTimeout = time.Duration(loginTimeoutSeconds) * time.Second
+	return options
+}
+
+// Run the auth subcommand, returning the exit code
+func runAuthCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, authUsage)
+		return exitUsage
+	}
+
+	flags := flag.NewFlagSet("auth "+args[0], flag.ExitOnError)
+	flags.StringVar(&authFile, "auth", "auth.json", authUsageText)
+	flags.BoolVar(&api.LogRequests, "debug", false, "Log Google requests and responses")
+	addLoginFlags(flags)
+	configFile := flags.String("config", defaultConfigFile, "Configuration file (YAML), whose values are overridden by the CLI arguments")
+	profile := flags.String("profile", "", "Profile of the configuration file to use")
+	format := flags.String("format", "text", "Output format of the check command (text or json)")
+	to := flags.String("to", "", "Store to copy the credentials to (copy command)")
+	from := flags.String("from", "", "Cookies.txt file, or Firefox or Chromium cookie database or profile directory "+
+		"to import the cookies from (import command)")
+	_ = flags.Parse(args[1:])
+
+	// Use the configuration file for the arguments not given
+	configGiven := false
+	flags.Visit(func(f *flag.Flag) {
+		configGiven = configGiven || f.Name == "config"
+	})
+	settings, err := loadConfig(*configFile, *profile, configGiven)
+	if err == nil {
+		err = applyConfig(flags, settings)
+	}
+	if err != nil {
+		log.Printf("Invalid configuration: %v\n", err)
+		return exitUsage
+	}
+
+	store, err := auth.OpenStore(authFile)
+	if err != nil {
+		log.Println(err)
+		return exitUsage
+	}
+
+	switch args[0] {
+	case "check":
+		if *format != "text" && *format != "json" {
+			log.Printf("Unknown format '%v'\n", *format)
+			return exitUsage
+		}
+		credentials, err := store.Load()
+		if err != nil {
+			log.Printf("Can't use '%v' as auth file: %v\n", store, err)
+			return exitAuth
+		}
+		report := api.CheckCredentials(*credentials)
+		if *format == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			_ = encoder.Encode(report)
+		} else {
+			printCredentialsReport(report)
+		}
+		if !report.Valid {
+			return exitAuth
+		}
+		return exitOK
+
+	case "login":
+		credentials, err := utils.StartWebDriverCookieCredentialsWizard(webDriverOptions())
+		if err != nil {
+			log.Printf("Can't complete the login wizard, got: %v\n", err)
+			return exitFailure
+		}
+		if err := store.Save(credentials); err != nil {
+			log.Printf("Can't write auth file %v: %v\n", store, err)
+			return exitFailure
+		}
+		log.Printf("Auth file %v written\n", store)
+		return exitOK
+
+	case "copy":
+		if *to == "" {
+			log.Println("The copy command needs the store to copy the credentials to (-to)")
+			return exitUsage
+		}
+		target, err := auth.OpenStore(*to)
+		if err != nil {
+			log.Println(err)
+			return exitUsage
+		}
+		credentials, err := store.Load()
+		if err != nil {
+			log.Printf("Can't use '%v' as auth file: %v\n", store, err)
+			return exitAuth
+		}
+		if err := target.Save(credentials); err != nil {
+			log.Printf("Can't write auth file %v: %v\n", target, err)
+			return exitFailure
+		}
+		log.Printf("Credentials copied from %v to %v\n", store, target)
+		return exitOK
+
+	case "import":
+		if *from == "" {
+			log.Println("The import command needs the cookie file or browser profile to import (-from)")
+			return exitUsage
+		}
+		credentials, err := auth.NewCookieCredentialsFromCookieFile(*from)
+		if err != nil {
+			log.Printf("Can't import the cookies of %v: %v\n", *from, err)
+			return exitAuth
+		}
+		if err := store.Save(credentials); err != nil {
+			log.Printf("Can't write auth file %v: %v\n", store, err)
+			return exitFailure
+		}
+		log.Printf("Cookies of %v imported in %v for the user %v\n", *from, store, credentials.PersistentParameters.UserId)
+		return exitOK
+	}
+
+	fmt.Fprint(os.Stderr, authUsage)
+	return exitUsage
+}
+
+func printCredentialsReport(report *api.CredentialsReport) {
+	fmt.Printf("%-20v %-9v %v\n", "Cookie", "Present", "Expires")
+	for _, cookie := range report.Cookies {
+		name, expires := cookie.Name, "session or unknown"
+		if cookie.Required {
+			name += " (required)"
+		}
+		if !cookie.Expires.IsZero() {
+			expires = cookie.Expires.Format(time.RFC3339)
+		}
+		if !cookie.Present {
+			expires = ""
+		}
+		fmt.Printf("%-20v %-9v %v\n", name, yesNo(cookie.Present), expires)
+	}
+	fmt.Println()
+	fmt.Printf("User id:          %v\n", report.UserId)
+	fmt.Printf("Account user id:  %v\n", report.AccountUserId)
+	fmt.Printf("At token:         %v\n", yesNo(report.AtToken))
+	fmt.Printf("Request:          %v\n", yesNo(report.Rpc))
+	if report.SessionExpires.IsZero() {
+		fmt.Println("Session expires:  unknown")
+	} else {
+		fmt.Printf("Session expires:  %v (in %v days)\n", report.SessionExpires.Format(time.RFC3339),
+			int(time.Until(report.SessionExpires).Hours()/24))
+	}
+	fmt.Println()
+
+	if report.Valid {
+		fmt.Println("Credentials are valid")
+		return
+	}
+	fmt.Println("Credentials are not valid:")
+	for _, problem := range report.Problems {
+		fmt.Printf("  - %v\n", problem)
+	}
+}
+
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
@@ -2,6 +2,8 @@ package auth
 
 import (
 	"net/http"
+	"net/url"
+	"time"
 )
 
 const (
@@ -9,6 +11,19 @@ const (
 	HomeUrl  = "https://photos.google.com/"
 )
 
+// Cookies of a Google session, without which the requests are not authenticated
+var RequiredCookies = []string{"SID", "HSID", "SSID", "APISID", "SAPISID"}
+
+// Presence and expiration of a cookie of the credentials
+type CookieStatus struct {
+	Name     string `json:"name"`
+	Required bool   `json:"required"`
+	Present  bool   `json:"present"`
+
+	// Expiration time, zero for a session cookie or an unknown time (like the cookies of an old auth file)
+	Expires time.Time `json:"expires,omitzero"`
+}
+
 // Result of a credentials test
 type CredentialsTestResult struct {
 	// False if the cookies are not valid anymore
@@ -49,3 +64,41 @@ func (c *CookieCredentials) sendLoginRequest() (*http.Response, error) {
 		return c.Client.Do(req)
 	}
 }
+
+// Status of the required cookies, then of the other cookies sent to Google Photos
+func (c *CookieCredentials) CheckCookies() []CookieStatus {
+	cookiesUrl, _ := url.Parse(cookieDomainWithProtocol)
+	present := make(map[string]bool)
+	for _, cookie := range c.Client.Jar.Cookies(cookiesUrl) {
+		present[cookie.Name] = true
+	}
+
+	var statuses []CookieStatus
+	for _, name := range RequiredCookies {
+		statuses = append(statuses, CookieStatus{
+			Name:     name,
+			Required: true,
+			Present:  present[name],
+			Expires:  c.cookieExpiration(name),
+		})
+		delete(present, name)
+	}
+	for _, cookie := range c.Client.Jar.Cookies(cookiesUrl) {
+		if present[cookie.Name] {
+			statuses = append(statuses, CookieStatus{Name: cookie.Name, Present: true, Expires: c.cookieExpiration(cookie.Name)})
+			delete(present, cookie.Name)
+		}
+	}
+	return statuses
+}
+
+// Estimated expiration time of the session: the first expiration of the required cookies, zero if unknown
+func (c *CookieCredentials) SessionExpiration() time.Time {
+	var expiration time.Time
+	for _, name := range RequiredCookies {
+		if expires := c.cookieExpiration(name); !expires.IsZero() && (expiration.IsZero() || expires.Before(expiration)) {
+			expiration = expires
+		}
+	}
+	return expiration
+}
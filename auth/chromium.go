@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Difference between the Windows epoch (1601-01-01) used by Chromium and the Unix epoch, in seconds
+const chromiumEpochOffset = 11644473600
+
+// Passwords of the keys encrypting the Chromium cookies on Linux without keyring: v10 cookies use "peanuts", v11
+// cookies use the empty password when the keyring is not available
+var chromiumPasswords = map[string][]string{
+	"v10": {"peanuts", ""},
+	"v11": {""},
+}
+
+// Read the cookies table of a Chromium profile
+func readChromiumCookies(db *sqliteDb) ([]*http.Cookie, error) {
+	rows, err := db.readTable("cookies")
+	if err != nil {
+		return nil, err
+	}
+
+	// Since version 24 of the database, the encrypted values start with the SHA-256 of the domain
+	var version int64
+	if meta, err := db.readTable("meta"); err == nil {
+		for _, row := range meta {
+			if row.text("key") == "version" {
+				version = row.integer("value")
+			}
+		}
+	}
+
+	var cookies []*http.Cookie
+	for _, row := range rows {
+		// Only decrypt the Google cookies, the others may have been encrypted differently
+		if !isGoogleDomain(row.text("host_key")) {
+			continue
+		}
+		cookie := &http.Cookie{
+			Domain:   row.text("host_key"),
+			Path:     row.text("path"),
+			Secure:   row.integer("is_secure") != 0,
+			Name:     row.text("name"),
+			Value:    row.text("value"),
+			HttpOnly: row.integer("is_httponly") != 0,
+		}
+		if expires := row.integer("expires_utc"); expires > 0 {
+			cookie.Expires = time.Unix(expires/1000000-chromiumEpochOffset, 0)
+		}
+		if encrypted, _ := row["encrypted_value"].([]byte); cookie.Value == "" && len(encrypted) > 0 {
+			value, err := decryptChromiumValue(encrypted)
+			if err != nil {
+				return nil, err
+			}
+			if version >= 24 && len(value) >= 32 {
+				value = value[32:]
+			}
+			cookie.Value = string(value)
+		}
+		cookies = appendGoogleCookie(cookies, cookie)
+	}
+	return cookies, nil
+}
+
+// Decrypt a value encrypted by Chromium on Linux: AES-128-CBC with a key derived by PBKDF2 from the password
+func decryptChromiumValue(encrypted []byte) ([]byte, error) {
+	if len(encrypted) < 3 {
+		return nil, errors.New("invalid encrypted cookie")
+	}
+	passwords, found := chromiumPasswords[string(encrypted[:3])]
+	if !found {
+		return nil, errors.New("unsupported encryption of the cookies (not v10 or v11)")
+	}
+	ciphertext := encrypted[3:]
+	if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, errors.New("invalid encrypted cookie")
+	}
+
+	for _, password := range passwords {
+		key, err := pbkdf2.Key(sha1.New, password, []byte("saltysalt"), 1, 16)
+		if err != nil {
+			return nil, err
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		plaintext := make([]byte, len(ciphertext))
+		cipher.NewCBCDecrypter(block, bytes.Repeat([]byte{' '}, aes.BlockSize)).CryptBlocks(plaintext, ciphertext)
+		if value, ok := unpad(plaintext); ok {
+			return value, nil
+		}
+	}
+	return nil, errors.New("can't decrypt the cookies, encrypted with a keyring password (use --password-store=basic)")
+}
+
+// Remove the PKCS #7 padding, telling whether it was valid (which is unlikely with a wrong key)
+func unpad(data []byte) ([]byte, bool) {
+	padding := int(data[len(data)-1])
+	if padding == 0 || padding > aes.BlockSize || padding > len(data) {
+		return nil, false
+	}
+	for _, b := range data[len(data)-padding:] {
+		if int(b) != padding {
+			return nil, false
+		}
+	}
+	return data[:len(data)-padding], true
+}
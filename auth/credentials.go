@@ -5,9 +5,10 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"net/http/cookiejar"
 	"net/url"
 	"os"
+	"path/filepath"
+	"sync"
 )
 
 const (
@@ -22,6 +23,9 @@ type PersistentParameters struct {
 
 type RuntimeParameters struct {
 	AtToken string
+
+	// Protects the at token while it is refreshed, so that the credentials of other accounts are not blocked
+	AtTokenMutex sync.Mutex
 }
 
 type CookieCredentials struct {
@@ -37,8 +41,9 @@ type AuthFile struct {
 	PersistentParameters *PersistentParameters `json:"persistantParameters"`
 }
 
-// Restore an CookieCredentials object from a JSON file
+// Restore an CookieCredentials object from a JSON file. A warning is logged if other users can read the file
 func NewCookieCredentialsFromFile(fileName string) (*CookieCredentials, error) {
+	checkPermissions(fileName)
 	file, err := os.Open(fileName)
 	if err != nil {
 		return nil, fmt.Errorf("auth: Can't open %v", fileName)
@@ -70,8 +75,8 @@ func NewCookieCredentials(cookies []*http.Cookie, parameters *PersistentParamete
 	}
 }
 
-func createJarWithCookies(cookies []*http.Cookie) *cookiejar.Jar {
-	jar, _ := cookiejar.New(nil)
+func createJarWithCookies(cookies []*http.Cookie) *cookieJar {
+	jar := newCookieJar()
 	cookiesUrl, _ := url.Parse(cookieDomainWithProtocol)
 
 	jar.SetCookies(cookiesUrl, cookies)
@@ -80,17 +85,47 @@ func createJarWithCookies(cookies []*http.Cookie) *cookiejar.Jar {
 }
 
 // Serialize the CookieCredentials object into a JSON file, to be restored in the future using
-// NewCookieCredentialsFromJsonFile
+// NewCookieCredentialsFromJsonFile. The file is only readable by its owner and replaced atomically (a crash can't leave
+// it half written), while holding a lock so that two processes don't write it at the same time
 func (c *CookieCredentials) SerializeToFile(fileName string) error {
-	file, err := os.Create(fileName)
+	return writeFileAtomically(fileName, c.Serialize)
+}
+
+// Write a file only readable by its owner: the content is written in a temporary file which then replaces the file,
+// while holding the lock of the file
+func writeFileAtomically(fileName string, write func(out io.Writer) error) error {
+	unlock, err := lockFile(fileName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// Write a temporary file next to the file, then replace the file
+	file, err := os.CreateTemp(filepath.Dir(fileName), filepath.Base(fileName)+".*.tmp")
 	if err != nil {
 		return fmt.Errorf("auth: Can't create the file %v (%v)", fileName, err)
 	}
 	defer func(file *os.File) {
 		_ = file.Close()
+		_ = os.Remove(file.Name())
 	}(file)
 
-	return c.Serialize(file)
+	if err := file.Chmod(0600); err != nil {
+		return fmt.Errorf("auth: Can't set the permissions of %v (%v)", fileName, err)
+	}
+	if err := write(file); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("auth: Can't write the file %v (%v)", fileName, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("auth: Can't write the file %v (%v)", fileName, err)
+	}
+	if err := os.Rename(file.Name(), fileName); err != nil {
+		return fmt.Errorf("auth: Can't replace the file %v (%v)", fileName, err)
+	}
+	return nil
 }
 
 // Serialize the CookieCredentials object into a JSON object, to be restored in the future using
@@ -100,6 +135,9 @@ func (c *CookieCredentials) Serialize(out io.Writer) error {
 	cookies := c.Client.Jar.Cookies(cookiesUrl)
 
 	prepareCookiesForSerialization(cookies)
+	for _, cookie := range cookies {
+		cookie.Expires = c.cookieExpiration(cookie.Name)
+	}
 
 	return json.NewEncoder(out).Encode(&AuthFile{
 		Cookies:              cookies,
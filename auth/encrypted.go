@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Parameters of scrypt for the new encrypted files
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+
+	// Memory that scrypt can use for the parameters read from a file (128 * N * r bytes)
+	maxScryptMemory = 256 << 20
+)
+
+// JSON file holding the credentials encrypted with AES-256-GCM, with a key derived from a passphrase by scrypt
+type EncryptedFileStore struct {
+	Path       string
+	Passphrase string
+}
+
+// Content of an encrypted file
+type encryptedFile struct {
+	Version int    `json:"version"`
+	Kdf     string `json:"kdf"`
+	N       int    `json:"n"`
+	R       int    `json:"r"`
+	P       int    `json:"p"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+func (s EncryptedFileStore) Load() (*CookieCredentials, error) {
+	checkPermissions(s.Path)
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("auth: Can't open %v", s.Path)
+	}
+	var file encryptedFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("auth: Can't read the encrypted file %v (%v)", s.Path, err)
+	}
+	if file.Version != 1 || file.Kdf != "scrypt" {
+		return nil, fmt.Errorf("auth: Unsupported encrypted file %v (version %v, kdf %v)", s.Path, file.Version, file.Kdf)
+	}
+	if !validScryptParameters(file.N, file.R, file.P) {
+		return nil, fmt.Errorf("auth: Invalid scrypt parameters in %v (n %v, r %v, p %v)", s.Path, file.N, file.R, file.P)
+	}
+
+	gcm, err := newGcm(s.Passphrase, file.Salt, file.N, file.R, file.P)
+	if err != nil {
+		return nil, err
+	}
+	if len(file.Nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("auth: Invalid nonce in %v", s.Path)
+	}
+	plaintext, err := gcm.Open(nil, file.Nonce, file.Data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("auth: Can't decrypt %v, wrong passphrase?", s.Path)
+	}
+	return NewCookieCredentialsFromJson(bytes.NewReader(plaintext))
+}
+
+func (s EncryptedFileStore) Save(credentials *CookieCredentials) error {
+	var plaintext bytes.Buffer
+	if err := credentials.Serialize(&plaintext); err != nil {
+		return err
+	}
+
+	file := encryptedFile{Version: 1, Kdf: "scrypt", N: scryptN, R: scryptR, P: scryptP, Salt: make([]byte, 16)}
+	if _, err := rand.Read(file.Salt); err != nil {
+		return err
+	}
+	gcm, err := newGcm(s.Passphrase, file.Salt, file.N, file.R, file.P)
+	if err != nil {
+		return err
+	}
+	file.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return err
+	}
+	file.Data = gcm.Seal(nil, file.Nonce, plaintext.Bytes(), nil)
+
+	return writeFileAtomically(s.Path, func(out io.Writer) error {
+		return json.NewEncoder(out).Encode(&file)
+	})
+}
+
+func (s EncryptedFileStore) String() string {
+	return "encrypted:" + s.Path
+}
+
+// Check the scrypt parameters read from a file, which must not make scrypt use too much memory or time
+func validScryptParameters(n int, r int, p int) bool {
+	if n < 2 || n&(n-1) != 0 || r < 1 || r > 32 || p < 1 || p > 16 {
+		return false
+	}
+	return int64(n)*int64(r) <= maxScryptMemory/128
+}
+
+func newGcm(passphrase string, salt []byte, n int, r int, p int) (cipher.AEAD, error) {
+	if passphrase == "" {
+		return nil, errors.New("auth: Empty passphrase")
+	}
+	key, err := scrypt.Key([]byte(passphrase), salt, n, r, p, 32)
+	if err != nil {
+		return nil, fmt.Errorf("auth: Can't derive the key (%v)", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
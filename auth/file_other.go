@@ -0,0 +1,36 @@
+//go:build !unix
+
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Lock the auth file by creating its lock file, waiting for the other processes to remove it. A lock file older than a
+// minute is considered abandoned
+func lockFile(fileName string) (unlock func(), err error) {
+	lockName := fileName + ".lock"
+	for {
+		lock, err := os.OpenFile(lockName, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			_ = lock.Close()
+			return func() {
+				_ = os.Remove(lockName)
+			}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("auth: Can't create the lock file of %v (%v)", fileName, err)
+		}
+		if info, err := os.Stat(lockName); err == nil && time.Since(info.ModTime()) > time.Minute {
+			_ = os.Remove(lockName)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// The permissions of the files are not checked on this system
+func checkPermissions(string) {
+}
@@ -0,0 +1,35 @@
+//go:build unix
+
+package auth
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"syscall"
+)
+
+// Lock the lock file of the auth file, waiting for the other processes to release it
+func lockFile(fileName string) (unlock func(), err error) {
+	lock, err := os.OpenFile(fileName+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("auth: Can't open the lock file of %v (%v)", fileName, err)
+	}
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		_ = lock.Close()
+		return nil, fmt.Errorf("auth: Can't lock %v (%v)", fileName, err)
+	}
+	return func() {
+		_ = syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+		_ = lock.Close()
+	}, nil
+}
+
+// Warn if the auth file can be read by other users, since it holds the session cookies
+func checkPermissions(fileName string) {
+	info, err := os.Stat(fileName)
+	if err == nil && info.Mode().Perm()&0077 != 0 {
+		log.Printf("[WARNING] The auth file %v can be read by other users (%v), use 'chmod 600 %v'\n",
+			fileName, info.Mode().Perm(), fileName)
+	}
+}
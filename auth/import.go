@@ -0,0 +1,198 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Id of the user in the global data of the Google Photos homepage
+var userIdRegexp = regexp.MustCompile(`"S06Grb":"([^"]+)"`)
+
+// Create a CookieCredentials object from the cookies exported by a browser, then extract the user id from the Google
+// Photos homepage. The file can be:
+//   - a Netscape cookies.txt file, as written by curl or the "cookies.txt" browser extensions
+//   - the cookies.sqlite file or the profile directory of Firefox
+//   - the Cookies file or the profile directory of Chromium or Chrome on Linux, with cookies encrypted with the basic
+//     password (--password-store=basic, or no keyring)
+//
+// The browser should be closed first, so that the cookies are written in the database and not only in its log
+func NewCookieCredentialsFromCookieFile(fileName string) (*CookieCredentials, error) {
+	cookies, err := ReadCookieFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if len(cookies) == 0 {
+		return nil, fmt.Errorf("auth: No Google cookie in %v, log in Google Photos with the browser first", fileName)
+	}
+
+	credentials := NewCookieCredentials(cookies, &PersistentParameters{})
+	if credentials.PersistentParameters.UserId, err = credentials.ExtractUserId(); err != nil {
+		return nil, err
+	}
+	return credentials, nil
+}
+
+// Read the Google cookies of a cookies.txt file, or of a Firefox or Chromium cookie database or profile directory
+func ReadCookieFile(fileName string) ([]*http.Cookie, error) {
+	if info, err := os.Stat(fileName); err == nil && info.IsDir() {
+		fileName, err = findCookieDatabase(fileName)
+		if err != nil {
+			return nil, err
+		}
+	}
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("auth: Can't open %v", fileName)
+	}
+	if !bytes.HasPrefix(data, []byte(sqliteMagic)) {
+		return readNetscapeCookies(bytes.NewReader(data))
+	}
+
+	if info, err := os.Stat(fileName + "-wal"); err == nil && info.Size() > 0 {
+		log.Printf("[WARNING] The browser of %v seems to be running, the last cookies may be missing\n", fileName)
+	}
+	db, err := openSqlite(data)
+	if err != nil {
+		return nil, fmt.Errorf("auth: Can't read %v (%v)", fileName, err)
+	}
+	var cookies []*http.Cookie
+	switch {
+	case db.hasTable("moz_cookies"):
+		cookies, err = readFirefoxCookies(db)
+	case db.hasTable("cookies"):
+		cookies, err = readChromiumCookies(db)
+	default:
+		err = errors.New("neither a Firefox nor a Chromium cookie database")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("auth: Can't read the cookies of %v (%v)", fileName, err)
+	}
+	return cookies, nil
+}
+
+// Cookie database of a Firefox or Chromium profile directory
+func findCookieDatabase(dir string) (string, error) {
+	for _, name := range []string{"cookies.sqlite", filepath.Join("Network", "Cookies"), "Cookies"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return filepath.Join(dir, name), nil
+		}
+	}
+	return "", fmt.Errorf("auth: No cookie database in the profile directory %v", dir)
+}
+
+// Read a Netscape cookies.txt file: one cookie per line with the tab-separated domain, subdomains flag, path, secure
+// flag, expiration time, name and value. The HttpOnly cookies are prefixed by #HttpOnly_
+func readNetscapeCookies(in io.Reader) ([]*http.Cookie, error) {
+	var cookies []*http.Cookie
+	scanner := bufio.NewScanner(in)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		httpOnly := strings.HasPrefix(text, "#HttpOnly_")
+		text = strings.TrimPrefix(text, "#HttpOnly_")
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Split(text, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("auth: Invalid cookies.txt line %v (%v fields instead of 7)", line, len(fields))
+		}
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("auth: Invalid expiration time on cookies.txt line %v (%v)", line, err)
+		}
+		cookies = appendGoogleCookie(cookies, &http.Cookie{
+			Domain:   fields[0],
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			Expires:  unixTime(expires),
+			Name:     fields[5],
+			Value:    fields[6],
+			HttpOnly: httpOnly,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("auth: Can't read the cookies.txt file (%v)", err)
+	}
+	return cookies, nil
+}
+
+// Read the moz_cookies table of a Firefox profile
+func readFirefoxCookies(db *sqliteDb) ([]*http.Cookie, error) {
+	rows, err := db.readTable("moz_cookies")
+	if err != nil {
+		return nil, err
+	}
+	var cookies []*http.Cookie
+	for _, row := range rows {
+		// Recent versions of Firefox store the expiry in milliseconds
+		expires := row.integer("expiry")
+		if expires > 100000000000 {
+			expires /= 1000
+		}
+		cookies = appendGoogleCookie(cookies, &http.Cookie{
+			Domain:   row.text("host"),
+			Path:     row.text("path"),
+			Secure:   row.integer("isSecure") != 0,
+			Expires:  unixTime(expires),
+			Name:     row.text("name"),
+			Value:    row.text("value"),
+			HttpOnly: row.integer("isHttpOnly") != 0,
+		})
+	}
+	return cookies, nil
+}
+
+// Keep the cookies sent to Google Photos which have not expired
+func appendGoogleCookie(cookies []*http.Cookie, cookie *http.Cookie) []*http.Cookie {
+	if !isGoogleDomain(cookie.Domain) || !cookie.Expires.IsZero() && cookie.Expires.Before(time.Now()) {
+		return cookies
+	}
+	return append(cookies, cookie)
+}
+
+// Tell whether the cookies of the domain are sent to Google Photos
+func isGoogleDomain(domain string) bool {
+	domain = strings.TrimPrefix(domain, ".")
+	return domain == "google.com" || domain == cookiesDomain
+}
+
+// Time of a Unix timestamp, zero for the session cookies
+func unixTime(seconds int64) time.Time {
+	if seconds <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0)
+}
+
+// Extract the id of the user from the Google Photos homepage
+func (c *CookieCredentials) ExtractUserId() (string, error) {
+	res, err := c.Client.Get(HomeUrl)
+	if err != nil {
+		return "", fmt.Errorf("auth: Can't get the Google Photos homepage (%v)", err)
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	page, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", fmt.Errorf("auth: Can't read the Google Photos homepage (%v)", err)
+	}
+
+	match := userIdRegexp.FindSubmatch(page)
+	if res.Request.URL.String() != HomeUrl || match == nil {
+		return "", errors.New("auth: Can't find the user id in the Google Photos homepage, the cookies may have expired")
+	}
+	return string(match[1]), nil
+}
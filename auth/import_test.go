@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The databases of testdata were written by SQLite with 512-byte pages, so that the cookies tables have interior pages
+// and the LONG cookie has overflow pages. The Chromium cookies are encrypted with the "peanuts" password, and the
+// values of the version 24 database start with the SHA-256 of the domain
+
+var farExpiration = time.Unix(4102444800, 0)
+
+func TestReadCookieFile(t *testing.T) {
+	tests := []struct {
+		file    string
+		cookies []http.Cookie
+	}{
+		{"cookies.txt", []http.Cookie{
+			{Domain: ".google.com", Path: "/", Name: "SID", Value: "sid-value", Secure: true, Expires: farExpiration},
+			{Domain: ".google.com", Path: "/", Name: "HSID", Value: "hsid-value", HttpOnly: true, Expires: farExpiration},
+			{Domain: "photos.google.com", Path: "/", Name: "SESSION", Value: "session-value", Secure: true},
+		}},
+		{"firefox.sqlite", []http.Cookie{
+			{Domain: ".google.com", Path: "/", Name: "SID", Value: "sid-value", Secure: true, Expires: farExpiration},
+			{Domain: ".google.com", Path: "/", Name: "HSID", Value: "hsid-value", HttpOnly: true, Expires: farExpiration},
+			{Domain: "photos.google.com", Path: "/", Name: "LONG", Value: strings.Repeat("L", 1500), Secure: true,
+				HttpOnly: true, Expires: farExpiration},
+		}},
+		{"chromium-v10", []http.Cookie{
+			{Domain: ".google.com", Path: "/", Name: "SID", Value: "sid-value", Secure: true, Expires: farExpiration},
+			{Domain: ".google.com", Path: "/", Name: "APISID", Value: "apisid-value", Expires: farExpiration},
+			{Domain: "photos.google.com", Path: "/", Name: "LONG", Value: strings.Repeat("L", 1500), Secure: true,
+				HttpOnly: true, Expires: farExpiration},
+		}},
+		{"chromium-v24", []http.Cookie{
+			{Domain: ".google.com", Path: "/", Name: "SID", Value: "sid-value", Secure: true, Expires: farExpiration},
+			{Domain: ".google.com", Path: "/", Name: "APISID", Value: "apisid-value", Expires: farExpiration},
+			{Domain: "photos.google.com", Path: "/", Name: "LONG", Value: strings.Repeat("L", 1500), Secure: true,
+				HttpOnly: true, Expires: farExpiration},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			cookies, err := ReadCookieFile(filepath.Join("testdata", test.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(cookies) != len(test.cookies) {
+				t.Fatalf("got %v cookies, want %v", len(cookies), len(test.cookies))
+			}
+			for i, want := range test.cookies {
+				got := cookies[i]
+				if got.Domain != want.Domain || got.Path != want.Path || got.Name != want.Name ||
+					got.Value != want.Value || got.Secure != want.Secure || got.HttpOnly != want.HttpOnly ||
+					!got.Expires.Equal(want.Expires) {
+					t.Errorf("cookie %v: got %+v, want %+v", i, *got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReadCookieFileProfileDirectory(t *testing.T) {
+	dir := t.TempDir()
+	data, err := os.ReadFile(filepath.Join("testdata", "chromium-v24"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "Network"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "Network", "Cookies"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	cookies, err := ReadCookieFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cookies) != 3 {
+		t.Errorf("got %v cookies, want 3", len(cookies))
+	}
+
+	if _, err := ReadCookieFile(t.TempDir()); err == nil {
+		t.Error("no error for a directory without cookie database")
+	}
+}
+
+// The truncated databases must be refused, without panic
+func TestReadCookieFileTruncated(t *testing.T) {
+	for _, file := range []string{"firefox.sqlite", "chromium-v10", "chromium-v24"} {
+		data, err := os.ReadFile(filepath.Join("testdata", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for size := 0; size < len(data); size += 37 {
+			name := filepath.Join(t.TempDir(), file)
+			if err := os.WriteFile(name, data[:size], 0600); err != nil {
+				t.Fatal(err)
+			}
+			cookies, err := ReadCookieFile(name)
+			if err == nil && size >= 100 {
+				t.Errorf("%v truncated to %v bytes: no error (%v cookies)", file, size, len(cookies))
+			}
+		}
+	}
+}
+
+func TestReadNetscapeCookiesInvalid(t *testing.T) {
+	tests := []string{
+		".google.com\tTRUE\t/\tTRUE\t4102444800\tSID\n",
+		".google.com\tTRUE\t/\tTRUE\tsoon\tSID\tsid-value\n",
+	}
+	for _, test := range tests {
+		if _, err := readNetscapeCookies(strings.NewReader(test)); err == nil {
+			t.Errorf("no error for %q", test)
+		}
+	}
+}
+
+func TestDecryptChromiumValueInvalid(t *testing.T) {
+	tests := [][]byte{
+		nil,
+		[]byte("v1"),
+		[]byte("v12" + strings.Repeat("x", 16)),
+		[]byte("v10"),
+		[]byte("v10" + strings.Repeat("x", 15)),
+		[]byte("v11" + strings.Repeat("x", 16)),
+	}
+	for _, test := range tests {
+		if _, err := decryptChromiumValue(test); err == nil {
+			t.Errorf("no error for %q", test)
+		}
+	}
+}
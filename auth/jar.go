@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cookie jar remembering the expiration time of the cookies, which the standard jar doesn't return
+type cookieJar struct {
+	*cookiejar.Jar
+
+	mutex   sync.Mutex
+	expires map[cookieKey]time.Time
+}
+
+// Identity of a cookie: Google sets cookies with the same name on several domains and paths
+type cookieKey struct {
+	domain string
+	path   string
+	name   string
+}
+
+func newCookieJar() *cookieJar {
+	jar, _ := cookiejar.New(nil)
+	return &cookieJar{Jar: jar, expires: make(map[cookieKey]time.Time)}
+}
+
+func (j *cookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.Jar.SetCookies(u, cookies)
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	for _, cookie := range cookies {
+		key := cookieKey{domain: cookie.Domain, path: cookie.Path, name: cookie.Name}
+		if key.domain == "" {
+			key.domain = u.Hostname()
+		}
+		key.domain = strings.ToLower(strings.TrimPrefix(key.domain, "."))
+		if key.path == "" || !strings.HasPrefix(key.path, "/") {
+			key.path = "/"
+		}
+		switch {
+		case cookie.MaxAge > 0:
+			j.expires[key] = time.Now().Add(time.Duration(cookie.MaxAge) * time.Second)
+		case cookie.MaxAge == 0 && cookie.Expires.After(time.Now()):
+			j.expires[key] = cookie.Expires
+		default:
+			// Session, expired or deleted cookie
+			delete(j.expires, key)
+		}
+	}
+}
+
+// Expiration time of a cookie sent to the URL, zero for a session cookie or an unknown time. When cookies with the same
+// name are sent, the one of the most specific domain, then path, is used
+func (j *cookieJar) expiration(u *url.URL, name string) time.Time {
+	host := strings.ToLower(u.Hostname())
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	var best cookieKey
+	var expiration time.Time
+	for key, expires := range j.expires {
+		if key.name != name || host != key.domain && !strings.HasSuffix(host, "."+key.domain) ||
+			!strings.HasPrefix(path, key.path) {
+			continue
+		}
+		if len(key.domain) > len(best.domain) || len(key.domain) == len(best.domain) && len(key.path) > len(best.path) {
+			best, expiration = key, expires
+		}
+	}
+	return expiration
+}
+
+// Expiration time of a cookie of the credentials sent to Google Photos, zero for a session cookie or an unknown time
+func (c *CookieCredentials) cookieExpiration(name string) time.Time {
+	if jar, ok := c.Client.Jar.(*cookieJar); ok {
+		cookiesUrl, _ := url.Parse(cookieDomainWithProtocol)
+		return jar.expiration(cookiesUrl, name)
+	}
+	return time.Time{}
+}
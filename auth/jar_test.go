@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestCookieJarExpiration(t *testing.T) {
+	soon, later := time.Now().Add(time.Hour).Truncate(time.Second), time.Now().Add(24*time.Hour).Truncate(time.Second)
+	jar := newCookieJar()
+	googleUrl, _ := url.Parse("https://www.google.com")
+	photosUrl, _ := url.Parse(cookieDomainWithProtocol)
+	jar.SetCookies(googleUrl, []*http.Cookie{
+		{Name: "NID", Value: "google", Domain: ".google.com", Path: "/", Expires: soon},
+		{Name: "SID", Value: "sid", Domain: ".google.com", Path: "/", Expires: later},
+		{Name: "OTHER", Value: "other", Domain: "www.google.com", Path: "/", Expires: later},
+	})
+	jar.SetCookies(photosUrl, []*http.Cookie{
+		{Name: "NID", Value: "photos", Domain: "photos.google.com", Path: "/", Expires: later},
+		{Name: "NID", Value: "path", Domain: "photos.google.com", Path: "/u/1", Expires: soon},
+		{Name: "SESSION", Value: "session", Path: "/"},
+	})
+
+	tests := []struct {
+		name    string
+		expires time.Time
+	}{
+		{"NID", later},
+		{"SID", later},
+		{"OTHER", time.Time{}},
+		{"SESSION", time.Time{}},
+		{"UNKNOWN", time.Time{}},
+	}
+	for _, test := range tests {
+		if expires := jar.expiration(photosUrl, test.name); !expires.Equal(test.expires) {
+			t.Errorf("expiration of %v: got %v, want %v", test.name, expires, test.expires)
+		}
+	}
+	if expires := jar.expiration(googleUrl, "NID"); !expires.Equal(soon) {
+		t.Errorf("expiration of NID on google.com: got %v, want %v", expires, soon)
+	}
+
+	// Deleting the cookie of a domain keeps the others
+	jar.SetCookies(photosUrl, []*http.Cookie{{Name: "NID", Domain: "photos.google.com", Path: "/", MaxAge: -1}})
+	if expires := jar.expiration(photosUrl, "NID"); !expires.Equal(soon) {
+		t.Errorf("expiration of NID after deletion: got %v, want %v", expires, soon)
+	}
+}
+
+func TestSerializeExpiration(t *testing.T) {
+	later := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	credentials := NewCookieCredentials([]*http.Cookie{
+		{Name: "SID", Value: "sid", Domain: ".google.com", Path: "/", Expires: later},
+		{Name: "HSID", Value: "hsid", Domain: ".google.com", Path: "/"},
+	}, &PersistentParameters{UserId: "42"})
+
+	var out bytes.Buffer
+	if err := credentials.Serialize(&out); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := NewCookieCredentialsFromJson(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expires := restored.cookieExpiration("SID"); !expires.Equal(later) {
+		t.Errorf("expiration of SID: got %v, want %v", expires, later)
+	}
+	if expires := restored.cookieExpiration("HSID"); !expires.IsZero() {
+		t.Errorf("expiration of HSID: got %v, want zero", expires)
+	}
+	if restored.PersistentParameters.UserId != "42" {
+		t.Errorf("user id: got %v, want 42", restored.PersistentParameters.UserId)
+	}
+}
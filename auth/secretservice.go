@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	secretServiceName = "org.freedesktop.secrets"
+	secretServicePath = "/org/freedesktop/secrets"
+
+	// Attribute identifying the items of the tool
+	secretServiceApplication = "gphotosuploader"
+)
+
+// Item of the freedesktop Secret Service (GNOME Keyring, KWallet, KeePassXC, ...), in the default collection. The
+// credentials are stored as the JSON of SerializeToFile
+type SecretServiceStore struct {
+	// Name of the item, to store several accounts
+	Account string
+
+	// Bus of the Secret Service, the session bus if nil (set it to use another service, like a mock)
+	Bus *dbus.Conn
+}
+
+// Secret, as defined by the Secret Service API
+type secret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+func (s *SecretServiceStore) Load() (*CookieCredentials, error) {
+	service, session, err := s.openSession()
+	if err != nil {
+		return nil, err
+	}
+	defer s.closeSession(session)
+
+	var unlocked, locked []dbus.ObjectPath
+	err = service.Call("org.freedesktop.Secret.Service.SearchItems", 0, s.attributes()).Store(&unlocked, &locked)
+	if err != nil {
+		return nil, fmt.Errorf("auth: Can't search the Secret Service (%v)", err)
+	}
+	if len(unlocked) == 0 && len(locked) > 0 {
+		if unlocked, err = s.unlock(service, locked); err != nil {
+			return nil, err
+		}
+	}
+	if len(unlocked) == 0 {
+		return nil, fmt.Errorf("auth: No credentials for '%v' in the Secret Service", s.Account)
+	}
+
+	var value secret
+	err = s.bus().Object(secretServiceName, unlocked[0]).
+		Call("org.freedesktop.Secret.Item.GetSecret", 0, session).Store(&value)
+	if err != nil {
+		return nil, fmt.Errorf("auth: Can't read the secret of '%v' (%v)", s.Account, err)
+	}
+	return NewCookieCredentialsFromJson(bytes.NewReader(value.Value))
+}
+
+func (s *SecretServiceStore) Save(credentials *CookieCredentials) error {
+	var value bytes.Buffer
+	if err := credentials.Serialize(&value); err != nil {
+		return err
+	}
+
+	service, session, err := s.openSession()
+	if err != nil {
+		return err
+	}
+	defer s.closeSession(session)
+
+	var collection dbus.ObjectPath
+	if err := service.Call("org.freedesktop.Secret.Service.ReadAlias", 0, "default").Store(&collection); err != nil {
+		return fmt.Errorf("auth: Can't find the default collection of the Secret Service (%v)", err)
+	}
+	if collection == "/" {
+		return errors.New("auth: The Secret Service has no default collection")
+	}
+
+	properties := map[string]dbus.Variant{
+		"org.freedesktop.Secret.Item.Label":      dbus.MakeVariant("G Photos Uploader (" + s.Account + ")"),
+		"org.freedesktop.Secret.Item.Attributes": dbus.MakeVariant(s.attributes()),
+	}
+	item := secret{Session: session, Parameters: []byte{}, Value: value.Bytes(), ContentType: "application/json"}
+	var created, prompt dbus.ObjectPath
+	err = s.bus().Object(secretServiceName, collection).
+		Call("org.freedesktop.Secret.Collection.CreateItem", 0, properties, item, true).Store(&created, &prompt)
+	if err != nil {
+		return fmt.Errorf("auth: Can't write the secret of '%v' (%v)", s.Account, err)
+	}
+	if prompt != "/" {
+		return errors.New("auth: The Secret Service collection is locked, unlock it first")
+	}
+	return nil
+}
+
+func (s *SecretServiceStore) String() string {
+	return "secret-service:" + s.Account
+}
+
+func (s *SecretServiceStore) bus() *dbus.Conn {
+	return s.Bus
+}
+
+func (s *SecretServiceStore) attributes() map[string]string {
+	return map[string]string{"application": secretServiceApplication, "account": s.Account}
+}
+
+// Open a session with the plain algorithm: the secret is not encrypted on the bus, which is only readable by the user
+func (s *SecretServiceStore) openSession() (dbus.BusObject, dbus.ObjectPath, error) {
+	if s.Bus == nil {
+		bus, err := dbus.SessionBus()
+		if err != nil {
+			return nil, "", fmt.Errorf("auth: Can't connect to the session bus (%v)", err)
+		}
+		s.Bus = bus
+	}
+
+	service := s.bus().Object(secretServiceName, secretServicePath)
+	var output dbus.Variant
+	var session dbus.ObjectPath
+	err := service.Call("org.freedesktop.Secret.Service.OpenSession", 0, "plain", dbus.MakeVariant("")).
+		Store(&output, &session)
+	if err != nil {
+		return nil, "", fmt.Errorf("auth: Can't open a Secret Service session (%v)", err)
+	}
+	return service, session, nil
+}
+
+func (s *SecretServiceStore) closeSession(session dbus.ObjectPath) {
+	_ = s.bus().Object(secretServiceName, session).Call("org.freedesktop.Secret.Session.Close", 0).Err
+}
+
+// Unlock items without prompt, which works when the keyring is unlocked at login
+func (s *SecretServiceStore) unlock(service dbus.BusObject, items []dbus.ObjectPath) ([]dbus.ObjectPath, error) {
+	var unlocked []dbus.ObjectPath
+	var prompt dbus.ObjectPath
+	if err := service.Call("org.freedesktop.Secret.Service.Unlock", 0, items).Store(&unlocked, &prompt); err != nil {
+		return nil, fmt.Errorf("auth: Can't unlock the Secret Service (%v)", err)
+	}
+	if len(unlocked) == 0 && prompt != "/" {
+		return nil, errors.New("auth: The Secret Service collection is locked, unlock it first")
+	}
+	return unlocked, nil
+}
@@ -0,0 +1,293 @@
+package auth
+
+import (
+	"bufio"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	mockCollectionPath = dbus.ObjectPath("/org/freedesktop/secrets/collection/login")
+	mockSessionPath    = dbus.ObjectPath("/org/freedesktop/secrets/session/1")
+)
+
+// Secret Service keeping its items in memory, in a single collection. The locked items are returned as locked by
+// SearchItems until they are unlocked
+type mockSecretService struct {
+	conn *dbus.Conn
+
+	mutex        sync.Mutex
+	items        []*mockItem
+	locked       bool
+	noCollection bool
+}
+
+type mockItem struct {
+	path       dbus.ObjectPath
+	attributes map[string]string
+	value      []byte
+	locked     bool
+}
+
+// Methods of org.freedesktop.Secret.Service
+type mockService struct{ *mockSecretService }
+
+// Methods of org.freedesktop.Secret.Collection
+type mockCollection struct{ *mockSecretService }
+
+// Methods of org.freedesktop.Secret.Session
+type mockSession struct{}
+
+func (mockService) OpenSession(algorithm string, _ dbus.Variant) (dbus.Variant, dbus.ObjectPath, *dbus.Error) {
+	if algorithm != "plain" {
+		return dbus.MakeVariant(""), "/", dbus.NewError("org.freedesktop.DBus.Error.NotSupported", nil)
+	}
+	return dbus.MakeVariant(""), mockSessionPath, nil
+}
+
+func (s mockService) SearchItems(attributes map[string]string) ([]dbus.ObjectPath, []dbus.ObjectPath, *dbus.Error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	unlocked, locked := []dbus.ObjectPath{}, []dbus.ObjectPath{}
+	for _, item := range s.items {
+		if !matches(item.attributes, attributes) {
+			continue
+		}
+		if item.locked {
+			locked = append(locked, item.path)
+		} else {
+			unlocked = append(unlocked, item.path)
+		}
+	}
+	return unlocked, locked, nil
+}
+
+func (s mockService) Unlock(objects []dbus.ObjectPath) ([]dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	unlocked := []dbus.ObjectPath{}
+	for _, item := range s.items {
+		for _, path := range objects {
+			if item.path == path {
+				item.locked = false
+				unlocked = append(unlocked, path)
+			}
+		}
+	}
+	return unlocked, "/", nil
+}
+
+func (s mockService) ReadAlias(name string) (dbus.ObjectPath, *dbus.Error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if name != "default" || s.noCollection {
+		return "/", nil
+	}
+	return mockCollectionPath, nil
+}
+
+func (s mockCollection) CreateItem(properties map[string]dbus.Variant, value secret,
+	replace bool) (dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.locked {
+		return "/", "/org/freedesktop/secrets/prompt/1", nil
+	}
+	if value.Session != mockSessionPath {
+		return "/", "/", dbus.NewError("org.freedesktop.Secret.Error.NoSession", nil)
+	}
+	var attributes map[string]string
+	if err := properties["org.freedesktop.Secret.Item.Attributes"].Store(&attributes); err != nil {
+		return "/", "/", dbus.MakeFailedError(err)
+	}
+
+	for _, item := range s.items {
+		if replace && matches(item.attributes, attributes) && len(item.attributes) == len(attributes) {
+			item.value = value.Value
+			return item.path, "/", nil
+		}
+	}
+	item := &mockItem{
+		path:       dbus.ObjectPath(fmt.Sprintf("%v/%v", mockCollectionPath, len(s.items)+1)),
+		attributes: attributes,
+		value:      value.Value,
+	}
+	s.items = append(s.items, item)
+	if err := s.conn.Export(mockItemMethods{item: item, service: s.mockSecretService}, item.path,
+		"org.freedesktop.Secret.Item"); err != nil {
+		return "/", "/", dbus.MakeFailedError(err)
+	}
+	return item.path, "/", nil
+}
+
+func (mockSession) Close() *dbus.Error {
+	return nil
+}
+
+// Methods of org.freedesktop.Secret.Item
+type mockItemMethods struct {
+	item    *mockItem
+	service *mockSecretService
+}
+
+func (m mockItemMethods) GetSecret(session dbus.ObjectPath) (secret, *dbus.Error) {
+	m.service.mutex.Lock()
+	defer m.service.mutex.Unlock()
+	if session != mockSessionPath {
+		return secret{}, dbus.NewError("org.freedesktop.Secret.Error.NoSession", nil)
+	}
+	if m.item.locked {
+		return secret{}, dbus.NewError("org.freedesktop.Secret.Error.IsLocked", nil)
+	}
+	return secret{Session: session, Parameters: []byte{}, Value: m.item.value, ContentType: "application/json"}, nil
+}
+
+// Tell whether the attributes contain all the searched ones
+func matches(attributes map[string]string, searched map[string]string) bool {
+	for key, value := range searched {
+		if attributes[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Start a private bus with dbus-daemon, and the mock Secret Service on it. It returns the connection of a client
+func startMockSecretService(t *testing.T) (*mockSecretService, *dbus.Conn) {
+	t.Helper()
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon is not installed")
+	}
+
+	address := "unix:path=" + filepath.Join(t.TempDir(), "bus")
+	cmd := exec.Command(daemon, "--session", "--nofork", "--nopidfile", "--print-address", "--address="+address)
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+	// The address is printed once the bus is ready
+	line, err := bufio.NewReader(out).ReadString('\n')
+	if err != nil {
+		t.Fatalf("dbus-daemon didn't start (%v)", err)
+	}
+	address = strings.TrimSpace(line)
+
+	serviceConn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = serviceConn.Close()
+	})
+	service := &mockSecretService{conn: serviceConn}
+	exports := []struct {
+		value interface{}
+		path  dbus.ObjectPath
+		iface string
+	}{
+		{mockService{service}, secretServicePath, "org.freedesktop.Secret.Service"},
+		{mockCollection{service}, mockCollectionPath, "org.freedesktop.Secret.Collection"},
+		{mockSession{}, mockSessionPath, "org.freedesktop.Secret.Session"},
+	}
+	for _, export := range exports {
+		if err := serviceConn.Export(export.value, export.path, export.iface); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reply, err := serviceConn.RequestName(secretServiceName, dbus.NameFlagDoNotQueue)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("can't own %v (%v, %v)", secretServiceName, reply, err)
+	}
+
+	clientConn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = clientConn.Close()
+	})
+	return service, clientConn
+}
+
+func TestSecretServiceStore(t *testing.T) {
+	service, bus := startMockSecretService(t)
+	alice := &SecretServiceStore{Account: "alice", Bus: bus}
+	bob := &SecretServiceStore{Account: "bob", Bus: bus}
+
+	if _, err := alice.Load(); err == nil {
+		t.Error("no error before saving")
+	}
+
+	// Round trip, with an item per account
+	aliceCredentials, bobCredentials := testCredentials(), testCredentials()
+	bobCredentials.PersistentParameters.UserId = "5678"
+	if err := alice.Save(aliceCredentials); err != nil {
+		t.Fatal(err)
+	}
+	if err := bob.Save(bobCredentials); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := alice.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCredentials(t, loaded, aliceCredentials)
+	if loaded, err = bob.Load(); err != nil {
+		t.Fatal(err)
+	}
+	checkCredentials(t, loaded, bobCredentials)
+
+	// Saving again replaces the item
+	aliceCredentials.PersistentParameters.UserId = "4321"
+	if err := alice.Save(aliceCredentials); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err = alice.Load(); err != nil {
+		t.Fatal(err)
+	}
+	checkCredentials(t, loaded, aliceCredentials)
+	service.mutex.Lock()
+	if len(service.items) != 2 {
+		t.Errorf("got %v items, want 2", len(service.items))
+	}
+	service.mutex.Unlock()
+
+	// Locked items are unlocked
+	service.mutex.Lock()
+	for _, item := range service.items {
+		item.locked = true
+	}
+	service.mutex.Unlock()
+	if loaded, err = bob.Load(); err != nil {
+		t.Fatal(err)
+	}
+	checkCredentials(t, loaded, bobCredentials)
+
+	// Locked collection, and no default collection
+	service.mutex.Lock()
+	service.locked = true
+	service.mutex.Unlock()
+	if err := alice.Save(aliceCredentials); err == nil {
+		t.Error("no error with a locked collection")
+	}
+	service.mutex.Lock()
+	service.locked, service.noCollection = false, true
+	service.mutex.Unlock()
+	if err := alice.Save(aliceCredentials); err == nil {
+		t.Error("no error without default collection")
+	}
+}
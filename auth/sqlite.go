@@ -0,0 +1,365 @@
+package auth
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Minimal read-only reader of SQLite 3 databases, enough to read the cookies tables of the browsers without a SQLite
+// driver. The changes still in the write-ahead log (-wal file) of a running browser are not read
+
+const sqliteMagic = "SQLite format 3\x00"
+
+type sqliteDb struct {
+	data []byte
+
+	pageSize   int
+	usableSize int
+}
+
+// Row of a table, by column name
+type sqliteRow map[string]interface{}
+
+// Value of a column as a string
+func (r sqliteRow) text(column string) string {
+	switch value := r[column].(type) {
+	case string:
+		return value
+	case []byte:
+		return string(value)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// Value of a column as an integer
+func (r sqliteRow) integer(column string) int64 {
+	switch value := r[column].(type) {
+	case int64:
+		return value
+	case float64:
+		return int64(value)
+	case string:
+		i, _ := strconv.ParseInt(value, 10, 64)
+		return i
+	}
+	return 0
+}
+
+func openSqlite(data []byte) (*sqliteDb, error) {
+	if len(data) < 100 || string(data[:16]) != sqliteMagic {
+		return nil, errors.New("not a SQLite 3 database")
+	}
+	pageSize := int(binary.BigEndian.Uint16(data[16:18]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 {
+		return nil, fmt.Errorf("invalid SQLite page size %v", pageSize)
+	}
+	usableSize := pageSize - int(data[20])
+	if usableSize < 480 {
+		return nil, fmt.Errorf("invalid SQLite usable page size %v", usableSize)
+	}
+	return &sqliteDb{data: data, pageSize: pageSize, usableSize: usableSize}, nil
+}
+
+// Tell whether the database has a table
+func (db *sqliteDb) hasTable(name string) bool {
+	_, _, err := db.tableSchema(name)
+	return err == nil
+}
+
+// Read all the rows of a table
+func (db *sqliteDb) readTable(name string) ([]sqliteRow, error) {
+	rootPage, columns, err := db.tableSchema(name)
+	if err != nil {
+		return nil, err
+	}
+	var rows []sqliteRow
+	err = db.walkTable(rootPage, func(values []interface{}) {
+		row := make(sqliteRow, len(columns))
+		for i, column := range columns {
+			if i < len(values) {
+				row[column] = values[i]
+			}
+		}
+		rows = append(rows, row)
+	})
+	return rows, err
+}
+
+// Root page and column names of a table, read from the sqlite_master table
+func (db *sqliteDb) tableSchema(name string) (int, []string, error) {
+	var rootPage int
+	var sql string
+	err := db.walkTable(1, func(values []interface{}) {
+		if len(values) == 5 && values[0] == "table" && strings.EqualFold(fmt.Sprint(values[1]), name) {
+			root, _ := values[3].(int64)
+			rootPage = int(root)
+			sql, _ = values[4].(string)
+		}
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	if rootPage == 0 {
+		return 0, nil, fmt.Errorf("no table '%v' in the database", name)
+	}
+	return rootPage, parseColumns(sql), nil
+}
+
+// Names of the columns of a CREATE TABLE statement
+func parseColumns(sql string) []string {
+	start, end := strings.Index(sql, "("), strings.LastIndex(sql, ")")
+	if start < 0 || end < start {
+		return nil
+	}
+
+	// Split the definitions on the commas that are not between parentheses
+	var definitions []string
+	depth, from := 0, start+1
+	for i := start + 1; i < end; i++ {
+		switch sql[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				definitions = append(definitions, sql[from:i])
+				from = i + 1
+			}
+		}
+	}
+	definitions = append(definitions, sql[from:end])
+
+	var columns []string
+	for _, definition := range definitions {
+		fields := strings.Fields(definition)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "PRIMARY", "UNIQUE", "CHECK", "FOREIGN", "CONSTRAINT":
+			continue
+		}
+		columns = append(columns, strings.Trim(fields[0], "\"'`[]"))
+	}
+	return columns
+}
+
+// Call the function with the values of each row of the table b-tree starting at the page
+func (db *sqliteDb) walkTable(page int, fn func(values []interface{})) error {
+	return db.walkPage(page, make(map[int]bool), fn)
+}
+
+// Walk a page of a table b-tree, and its children. The visited pages are remembered to detect the loops of a corrupt
+// database
+func (db *sqliteDb) walkPage(page int, visited map[int]bool, fn func(values []interface{})) error {
+	offset, end, err := db.page(page)
+	if err != nil {
+		return err
+	}
+	if visited[page] {
+		return fmt.Errorf("SQLite page %v is referenced twice", page)
+	}
+	visited[page] = true
+	header := offset
+	if page == 1 {
+		header += 100
+	}
+
+	pageType := db.data[header]
+	pointers := header + 8
+	if pageType == 0x05 {
+		pointers = header + 12
+	}
+	cells := int(binary.BigEndian.Uint16(db.data[header+3:]))
+	if pointers+2*cells > end {
+		return fmt.Errorf("invalid cell count of the SQLite page %v", page)
+	}
+	for i := 0; i < cells; i++ {
+		cell := offset + int(binary.BigEndian.Uint16(db.data[pointers+2*i:]))
+		if cell < pointers+2*cells || cell >= end {
+			return fmt.Errorf("invalid cell of the SQLite page %v", page)
+		}
+		switch pageType {
+		case 0x05: // Interior page: pointer to the left child, then the key
+			if cell+4 > end {
+				return fmt.Errorf("invalid cell of the SQLite page %v", page)
+			}
+			if err := db.walkPage(int(binary.BigEndian.Uint32(db.data[cell:])), visited, fn); err != nil {
+				return err
+			}
+		case 0x0d: // Leaf page: payload size, rowid, then the record
+			payload, err := db.readPayload(cell, end)
+			if err != nil {
+				return err
+			}
+			values, err := parseRecord(payload)
+			if err != nil {
+				return err
+			}
+			fn(values)
+		default:
+			return fmt.Errorf("unexpected SQLite page type %v", pageType)
+		}
+	}
+	if pageType == 0x05 {
+		return db.walkPage(int(binary.BigEndian.Uint32(db.data[header+8:])), visited, fn)
+	}
+	return nil
+}
+
+// Offsets of the start and of the end of the usable part of a page
+func (db *sqliteDb) page(page int) (int, int, error) {
+	offset := (page - 1) * db.pageSize
+	if page < 1 || offset+db.pageSize > len(db.data) {
+		return 0, 0, fmt.Errorf("invalid SQLite page %v", page)
+	}
+	return offset, offset + db.usableSize, nil
+}
+
+// Payload of a table leaf cell ending before the end of its page, with its overflow pages
+func (db *sqliteDb) readPayload(cell int, end int) ([]byte, error) {
+	size, n := readVarint(db.data[cell:end])
+	if n == 0 {
+		return nil, errors.New("invalid SQLite payload")
+	}
+	cell += n
+	_, n = readVarint(db.data[cell:end])
+	if n == 0 {
+		return nil, errors.New("invalid SQLite payload")
+	}
+	cell += n
+	if size < 0 || size > int64(len(db.data)) {
+		return nil, errors.New("invalid SQLite payload size")
+	}
+
+	// Size of the payload stored in the page
+	payloadSize := int(size)
+	maxLocal := db.usableSize - 35
+	local := payloadSize
+	if payloadSize > maxLocal {
+		minLocal := (db.usableSize-12)*32/255 - 23
+		local = minLocal + (payloadSize-minLocal)%(db.usableSize-4)
+		if local > maxLocal {
+			local = minLocal
+		}
+	}
+	if cell+local > end || local < payloadSize && cell+local+4 > end {
+		return nil, errors.New("invalid SQLite payload")
+	}
+	payload := append([]byte{}, db.data[cell:cell+local]...)
+	if local == payloadSize {
+		return payload, nil
+	}
+
+	// Follow the overflow pages
+	next := int(binary.BigEndian.Uint32(db.data[cell+local:]))
+	visited := make(map[int]bool)
+	for len(payload) < payloadSize && next != 0 {
+		offset, end, err := db.page(next)
+		if err != nil || visited[next] {
+			return nil, errors.New("invalid SQLite overflow page")
+		}
+		visited[next] = true
+		chunk := db.data[offset+4 : end]
+		if remaining := payloadSize - len(payload); len(chunk) > remaining {
+			chunk = chunk[:remaining]
+		}
+		payload = append(payload, chunk...)
+		next = int(binary.BigEndian.Uint32(db.data[offset:]))
+	}
+	if len(payload) < payloadSize {
+		return nil, errors.New("truncated SQLite payload")
+	}
+	return payload, nil
+}
+
+// Values of a record: nil, int64, float64, string or []byte
+func parseRecord(payload []byte) ([]interface{}, error) {
+	headerSize, n := readVarint(payload)
+	if n == 0 || headerSize < int64(n) || headerSize > int64(len(payload)) {
+		return nil, errors.New("invalid SQLite record")
+	}
+	var types []int64
+	for i := n; i < int(headerSize); {
+		serialType, n := readVarint(payload[i:headerSize])
+		if n == 0 {
+			return nil, errors.New("invalid SQLite record")
+		}
+		types = append(types, serialType)
+		i += n
+	}
+
+	values := make([]interface{}, 0, len(types))
+	data := payload[headerSize:]
+	for _, serialType := range types {
+		var size int
+		switch {
+		case serialType == 0 || serialType == 8 || serialType == 9:
+			size = 0
+		case serialType >= 1 && serialType <= 4:
+			size = int(serialType)
+		case serialType == 5:
+			size = 6
+		case serialType == 6 || serialType == 7:
+			size = 8
+		case serialType >= 12:
+			size = int((serialType - 12) / 2)
+		default:
+			return nil, fmt.Errorf("invalid SQLite serial type %v", serialType)
+		}
+		if size > len(data) {
+			return nil, errors.New("truncated SQLite record")
+		}
+		value := data[:size]
+		data = data[size:]
+
+		switch {
+		case serialType == 0:
+			values = append(values, nil)
+		case serialType == 7:
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(value)))
+		case serialType == 8:
+			values = append(values, int64(0))
+		case serialType == 9:
+			values = append(values, int64(1))
+		case serialType >= 12 && serialType%2 == 0:
+			values = append(values, value)
+		case serialType >= 13:
+			values = append(values, string(value))
+		default:
+			// Big-endian signed integer
+			integer := int64(int8(value[0]))
+			for _, b := range value[1:] {
+				integer = integer<<8 | int64(b)
+			}
+			values = append(values, integer)
+		}
+	}
+	return values, nil
+}
+
+// Read a SQLite varint, returning its value and its size, 0 if the data is truncated
+func readVarint(data []byte) (int64, int) {
+	var value int64
+	for i := 0; i < 9 && i < len(data); i++ {
+		if i == 8 {
+			return value<<8 | int64(data[i]), 9
+		}
+		value = value<<7 | int64(data[i]&0x7f)
+		if data[i] < 0x80 {
+			return value, i + 1
+		}
+	}
+	return 0, 0
+}
@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadVarint(t *testing.T) {
+	tests := []struct {
+		data  []byte
+		value int64
+		size  int
+	}{
+		{[]byte{0x00}, 0, 1},
+		{[]byte{0x7f}, 127, 1},
+		{[]byte{0x81, 0x00}, 128, 2},
+		{[]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, -1, 9},
+		{[]byte{}, 0, 0},
+		{[]byte{0x81}, 0, 0},
+	}
+	for _, test := range tests {
+		value, size := readVarint(test.data)
+		if value != test.value || size != test.size {
+			t.Errorf("readVarint(%x) = %v, %v, want %v, %v", test.data, value, size, test.value, test.size)
+		}
+	}
+}
+
+func TestParseRecord(t *testing.T) {
+	tests := []struct {
+		payload []byte
+		values  []interface{}
+		valid   bool
+	}{
+		{[]byte{4, 0, 1, 0x17, 0xff, 'h', 'e', 'l', 'l', 'o'}, []interface{}{nil, int64(-1), "hello"}, true},
+		{[]byte{3, 8, 9}, []interface{}{int64(0), int64(1)}, true},
+		{[]byte{2, 0x10, 'a', 'b'}, []interface{}{[]byte("ab")}, true},
+		{[]byte{}, nil, false},
+		{[]byte{5, 0}, nil, false},
+		{[]byte{0}, nil, false},
+		{[]byte{2, 0x81}, nil, false},
+		{[]byte{2, 10}, nil, false},
+		{[]byte{2, 11}, nil, false},
+		{[]byte{2, 6, 1, 2}, nil, false},
+		{[]byte{2, 0x17, 'a'}, nil, false},
+	}
+	for _, test := range tests {
+		values, err := parseRecord(test.payload)
+		if (err == nil) != test.valid {
+			t.Errorf("parseRecord(%x): error %v", test.payload, err)
+			continue
+		}
+		if len(values) != len(test.values) {
+			t.Errorf("parseRecord(%x) = %v, want %v", test.payload, values, test.values)
+			continue
+		}
+		for i := range values {
+			if b, ok := values[i].([]byte); ok {
+				if string(b) != string(test.values[i].([]byte)) {
+					t.Errorf("parseRecord(%x) = %v, want %v", test.payload, values, test.values)
+				}
+			} else if values[i] != test.values[i] {
+				t.Errorf("parseRecord(%x) = %v, want %v", test.payload, values, test.values)
+			}
+		}
+	}
+}
+
+// The corrupt databases must be refused, without panic nor endless loop
+func TestReadTableCorrupt(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "firefox.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := openSqlite(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _, err := db.tableSchema("moz_cookies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[(root-1)*db.pageSize] != 0x05 {
+		t.Fatal("the root page of moz_cookies is not an interior page")
+	}
+	rootOffset := (root - 1) * db.pageSize
+
+	tests := []struct {
+		name    string
+		corrupt func(data []byte)
+	}{
+		{"page size", func(data []byte) {
+			binary.BigEndian.PutUint16(data[16:], 1000)
+		}},
+		{"reserved size", func(data []byte) {
+			data[20] = 100
+		}},
+		{"root page loop", func(data []byte) {
+			binary.BigEndian.PutUint32(data[rootOffset+8:], uint32(root))
+		}},
+		{"child page out of the file", func(data []byte) {
+			binary.BigEndian.PutUint32(data[rootOffset+8:], 1000000)
+		}},
+		{"cell count", func(data []byte) {
+			binary.BigEndian.PutUint16(data[rootOffset+3:], 0xffff)
+		}},
+		{"cell pointer", func(data []byte) {
+			binary.BigEndian.PutUint16(data[rootOffset+12:], 0xfffe)
+		}},
+		{"page type", func(data []byte) {
+			data[rootOffset] = 0x02
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			corrupt := append([]byte{}, data...)
+			test.corrupt(corrupt)
+			db, err := openSqlite(corrupt)
+			if err == nil {
+				_, err = db.readTable("moz_cookies")
+			}
+			if err == nil {
+				t.Error("no error")
+			}
+		})
+	}
+}
+
+// Each byte after the header is changed in turn: the reader may return wrong values, but must not panic
+func TestReadTableFlippedBytes(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "chromium-v24"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 100; i < len(data); i++ {
+		corrupt := append([]byte{}, data...)
+		corrupt[i] ^= 0xff
+		if db, err := openSqlite(corrupt); err == nil {
+			_, _ = readChromiumCookies(db)
+		}
+	}
+}
+
+func TestParseColumns(t *testing.T) {
+	columns := parseColumns("CREATE TABLE t (id INTEGER PRIMARY KEY, \"name\" TEXT, value DECIMAL(10, 2), " +
+		"UNIQUE (name, value), CONSTRAINT c CHECK (id > 0))")
+	want := []string{"id", "name", "value"}
+	if len(columns) != len(want) {
+		t.Fatalf("got %v, want %v", columns, want)
+	}
+	for i := range want {
+		if columns[i] != want[i] {
+			t.Errorf("got %v, want %v", columns, want)
+		}
+	}
+}
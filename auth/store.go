@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Environment variable holding the passphrase of the encrypted stores
+const PassphraseEnv = "GPHOTOSUPLOADER_PASSPHRASE"
+
+// Storage of the credentials (cookies and persistent parameters)
+type Store interface {
+	// Read the credentials
+	Load() (*CookieCredentials, error)
+
+	// Write the credentials, replacing the previous ones
+	Save(credentials *CookieCredentials) error
+
+	// Description of the store, for the logs
+	String() string
+}
+
+// Open the store of a URI:
+//   - file:PATH or PATH: plaintext JSON file, as written by SerializeToFile
+//   - encrypted:PATH[?passphraseFile=FILE]: JSON file encrypted with a passphrase, read from the file or from the
+//     GPHOTOSUPLOADER_PASSPHRASE environment variable
+//   - secret-service:[NAME]: item of the freedesktop Secret Service (like GNOME Keyring or KWallet), NAME being the
+//     account name of the item (default: default)
+func OpenStore(uri string) (Store, error) {
+	scheme, rest, found := strings.Cut(uri, ":")
+	if !found || len(scheme) == 1 {
+		// Plain path, or Windows path with a drive letter
+		return FileStore{Path: uri}, nil
+	}
+
+	switch scheme {
+	case "file":
+		return FileStore{Path: rest}, nil
+
+	case "encrypted":
+		path, query, _ := strings.Cut(rest, "?")
+		params, err := url.ParseQuery(query)
+		if err != nil {
+			return nil, fmt.Errorf("auth: Invalid store '%v' (%v)", uri, err)
+		}
+		passphrase, err := readPassphrase(params.Get("passphraseFile"))
+		if err != nil {
+			return nil, err
+		}
+		return EncryptedFileStore{Path: path, Passphrase: passphrase}, nil
+
+	case "secret-service":
+		if rest == "" {
+			rest = "default"
+		}
+		return &SecretServiceStore{Account: rest}, nil
+	}
+	return nil, fmt.Errorf("auth: Unknown store '%v' (file:, encrypted: or secret-service:)", uri)
+}
+
+func readPassphrase(fileName string) (string, error) {
+	if fileName != "" {
+		data, err := os.ReadFile(fileName)
+		if err != nil {
+			return "", fmt.Errorf("auth: Can't read the passphrase file %v (%v)", fileName, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	if passphrase := os.Getenv(PassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	return "", fmt.Errorf("auth: No passphrase for the encrypted store (set %v or passphraseFile)", PassphraseEnv)
+}
+
+// Plaintext JSON file
+type FileStore struct {
+	Path string
+}
+
+func (s FileStore) Load() (*CookieCredentials, error) {
+	return NewCookieCredentialsFromFile(s.Path)
+}
+
+func (s FileStore) Save(credentials *CookieCredentials) error {
+	return credentials.SerializeToFile(s.Path)
+}
+
+func (s FileStore) String() string {
+	return s.Path
+}
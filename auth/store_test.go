@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Credentials with the required cookies, used by the tests of the stores
+func testCredentials() *CookieCredentials {
+	expires := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	var cookies []*http.Cookie
+	for _, name := range RequiredCookies {
+		cookies = append(cookies, &http.Cookie{Name: name, Value: name + "-value", Domain: ".google.com", Path: "/",
+			Expires: expires})
+	}
+	return NewCookieCredentials(cookies, &PersistentParameters{UserId: "1234"})
+}
+
+// Check that the loaded credentials are the saved ones
+func checkCredentials(t *testing.T, got *CookieCredentials, want *CookieCredentials) {
+	t.Helper()
+	if got.PersistentParameters.UserId != want.PersistentParameters.UserId {
+		t.Errorf("user id: got %v, want %v", got.PersistentParameters.UserId, want.PersistentParameters.UserId)
+	}
+	cookiesUrl, _ := url.Parse(cookieDomainWithProtocol)
+	values := make(map[string]string)
+	for _, cookie := range got.Client.Jar.Cookies(cookiesUrl) {
+		values[cookie.Name] = cookie.Value
+	}
+	for _, cookie := range want.Client.Jar.Cookies(cookiesUrl) {
+		if values[cookie.Name] != cookie.Value {
+			t.Errorf("cookie %v: got %q, want %q", cookie.Name, values[cookie.Name], cookie.Value)
+		}
+		if got, want := got.cookieExpiration(cookie.Name), want.cookieExpiration(cookie.Name); !got.Equal(want) {
+			t.Errorf("expiration of %v: got %v, want %v", cookie.Name, got, want)
+		}
+	}
+}
+
+func TestOpenStore(t *testing.T) {
+	passphraseFile := filepath.Join(t.TempDir(), "passphrase")
+	if err := os.WriteFile(passphraseFile, []byte("from file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(PassphraseEnv, "from env")
+
+	tests := []struct {
+		uri   string
+		store Store
+	}{
+		{"auth.json", FileStore{Path: "auth.json"}},
+		{"/etc/gphotosuploader/auth.json", FileStore{Path: "/etc/gphotosuploader/auth.json"}},
+		{`C:\Users\bob\auth.json`, FileStore{Path: `C:\Users\bob\auth.json`}},
+		{"file:auth.json", FileStore{Path: "auth.json"}},
+		{"encrypted:auth.enc", EncryptedFileStore{Path: "auth.enc", Passphrase: "from env"}},
+		{"encrypted:auth.enc?passphraseFile=" + passphraseFile, EncryptedFileStore{Path: "auth.enc",
+			Passphrase: "from file"}},
+		{"secret-service:", &SecretServiceStore{Account: "default"}},
+		{"secret-service:bob", &SecretServiceStore{Account: "bob"}},
+		{"keyring:bob", nil},
+		{"encrypted:auth.enc?passphraseFile=" + filepath.Join(t.TempDir(), "missing"), nil},
+		{"encrypted:auth.enc?%zz", nil},
+	}
+	for _, test := range tests {
+		store, err := OpenStore(test.uri)
+		if test.store == nil {
+			if err == nil {
+				t.Errorf("OpenStore(%q): no error", test.uri)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("OpenStore(%q): %v", test.uri, err)
+			continue
+		}
+		switch want := test.store.(type) {
+		case *SecretServiceStore:
+			if got, ok := store.(*SecretServiceStore); !ok || got.Account != want.Account {
+				t.Errorf("OpenStore(%q) = %#v, want %#v", test.uri, store, want)
+			}
+		default:
+			if store != test.store {
+				t.Errorf("OpenStore(%q) = %#v, want %#v", test.uri, store, want)
+			}
+		}
+	}
+
+	t.Setenv(PassphraseEnv, "")
+	if _, err := OpenStore("encrypted:auth.enc"); err == nil {
+		t.Error("no error without passphrase")
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	store := FileStore{Path: filepath.Join(t.TempDir(), "auth.json")}
+	if _, err := store.Load(); err == nil {
+		t.Error("no error for a missing file")
+	}
+
+	credentials := testCredentials()
+	if err := store.Save(credentials); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(store.Path); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Errorf("permissions: got %v, want 0600", info.Mode().Perm())
+	}
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCredentials(t, loaded, credentials)
+}
+
+func TestEncryptedFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth.enc")
+	store := EncryptedFileStore{Path: path, Passphrase: "correct horse"}
+	credentials := testCredentials()
+	if err := store.Save(credentials); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cookie := range RequiredCookies {
+		if strings.Contains(string(data), cookie+"-value") {
+			t.Errorf("the value of %v is written in clear", cookie)
+		}
+	}
+
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCredentials(t, loaded, credentials)
+
+	if _, err := (EncryptedFileStore{Path: path, Passphrase: "wrong horse"}).Load(); err == nil {
+		t.Error("no error with a wrong passphrase")
+	}
+	if _, err := (EncryptedFileStore{Path: path}).Load(); err == nil {
+		t.Error("no error with an empty passphrase")
+	}
+
+	// Tampered files, refused without panic nor deriving a key with huge parameters
+	tests := []struct {
+		name   string
+		tamper func(file *encryptedFile)
+	}{
+		{"data", func(file *encryptedFile) { file.Data[0] ^= 1 }},
+		{"truncated nonce", func(file *encryptedFile) { file.Nonce = file.Nonce[:4] }},
+		{"no nonce", func(file *encryptedFile) { file.Nonce = nil }},
+		{"long nonce", func(file *encryptedFile) { file.Nonce = append(file.Nonce, 0) }},
+		{"huge n", func(file *encryptedFile) { file.N = 1 << 40 }},
+		{"n not a power of two", func(file *encryptedFile) { file.N = 1000 }},
+		{"zero r", func(file *encryptedFile) { file.R = 0 }},
+		{"huge r", func(file *encryptedFile) { file.R = 1 << 20 }},
+		{"huge p", func(file *encryptedFile) { file.P = 1 << 20 }},
+		{"negative p", func(file *encryptedFile) { file.P = -1 }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var file encryptedFile
+			if err := json.Unmarshal(data, &file); err != nil {
+				t.Fatal(err)
+			}
+			test.tamper(&file)
+			tampered, err := json.Marshal(&file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, tampered, 0600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.Load(); err == nil {
+				t.Error("no error")
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/GaPhi/gphotosuploader/api"
+	"github.com/GaPhi/gphotosuploader/auth"
+)
+
+const cleanUsage = `Usage: gphotosuploader clean <command> [arguments]
+
+Commands:
+  unsupported            Delete the unsupported media items
+  trash                  Empty the trash
+  before -date DATE      Delete the media items created before a date (YYYY-MM-DD or Unix timestamp in ms)
+  empty-albums           Delete the empty albums
+`
+
+// Run the clean subcommand, returning the exit code
+func runCleanCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, cleanUsage)
+		return exitUsage
+	}
+
+	flags := flag.NewFlagSet("clean "+args[0], flag.ExitOnError)
+	flags.StringVar(&authFile, "auth", "auth.json", authUsageText)
+	flags.BoolVar(&api.LogRequests, "debug", false, "Log Google requests and responses")
+	date := flags.String("date", "", "Delete the media items created before this date (YYYY-MM-DD or Unix timestamp in ms)")
+	output := flags.String("output", outputText, "Format of the standard output: text, or json for one event per line")
+	_ = flags.Parse(args[1:])
+	if err := setOutputFormat(*output); err != nil {
+		log.Println(err)
+		return exitUsage
+	}
+
+	// Check arguments before authenticating
+	var before int64
+	switch args[0] {
+	case "unsupported", "trash", "empty-albums":
+	case "before":
+		var err error
+		if before, err = parseDate(*date); err != nil {
+			log.Println(err)
+			return exitUsage
+		}
+	default:
+		fmt.Fprint(os.Stderr, cleanUsage)
+		return exitUsage
+	}
+
+	credentials := initAuthentication()
+
+	var err error
+	switch args[0] {
+	case "unsupported":
+		err = cleanUnsupported(credentials)
+	case "trash":
+		err = cleanTrash(credentials)
+	case "before":
+		err = cleanBefore(credentials, before)
+	case "empty-albums":
+		err = cleanEmptyAlbums(credentials)
+	}
+	if err != nil {
+		log.Println(err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// Parse a date written as YYYY-MM-DD (local time) or as a Unix timestamp in ms, returning the timestamp in ms
+func parseDate(value string) (int64, error) {
+	var timestamp int64
+	if date, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		timestamp = date.UnixMilli()
+	} else if timestamp, err = strconv.ParseInt(value, 10, 64); err != nil {
+		return 0, fmt.Errorf("invalid date '%v' (YYYY-MM-DD or Unix timestamp in ms)", value)
+	}
+	if timestamp > time.Now().UnixMilli() {
+		return 0, fmt.Errorf("invalid date '%v' (after now)", value)
+	}
+	return timestamp, nil
+}
+
+// Delete unsupported media items
+func cleanUnsupported(credentials auth.CookieCredentials) error {
+	log.Printf("Deleting unsupported media items...\n")
+	unsupported, err := api.ListAllUnsupportedMediaItemsBefore(credentials, nil)
+	if err != nil {
+		return fmt.Errorf("can't get unsupported media items: %v", err)
+	}
+	log.Printf("Got unsupported media items: %v\n", len(unsupported))
+
+	// No item?
+	if len(unsupported) > 0 {
+		// Get ids as an array
+		ids := make([]api.MediaKey, len(unsupported))
+		for i, mediaItem := range unsupported {
+			ids[i] = mediaItem.MediaItemId
+		}
+
+		// Immediately delete (kind=2) too old media items
+		err = api.DeleteMediaItems(credentials, ids, 2)
+		if err != nil {
+			log.Printf("Media items deletion FAILED: %v\n", err)
+			emitError(err)
+		} else {
+			log.Printf("%v media items deleted\n", len(ids))
+			emitDeleted(ids)
+		}
+	}
+	return nil
+}
+
+// Empty trash
+func cleanTrash(credentials auth.CookieCredentials) error {
+	log.Printf("Empty trash...\n")
+	if err := api.EmptyTrash(credentials); err != nil {
+		return fmt.Errorf("can't empty trash: %v", err)
+	}
+	log.Printf("Trash emptied\n")
+	return nil
+}
+
+// Delete the media items created before a date (Unix timestamp in ms)
+func cleanBefore(credentials auth.CookieCredentials, before int64) error {
+	log.Printf("Deleting media items before %v...\n", time.Unix(0, before*1000000).Local())
+	mediaItems, err := api.ListAllMediaItemsBefore(credentials, before, func(mediaItemsPart []api.MediaItem, err error) {
+		// No item?
+		if len(mediaItemsPart) == 0 {
+			return
+		}
+
+		// Get ids as an array
+		ids := make([]api.MediaKey, len(mediaItemsPart))
+		for i, mediaItem := range mediaItemsPart {
+			ids[i] = mediaItem.MediaItemId
+		}
+
+		// Immediately delete (kind=2) too old media items
+		err = api.DeleteMediaItems(credentials, ids, 2)
+		if err != nil {
+			log.Printf("Media items deletion FAILED: %v\n", err)
+			emitError(err)
+		} else {
+			emitDeleted(ids)
+			log.Printf("%v media items deleted between %v and %v\n",
+				len(ids),
+				time.Unix(0, mediaItemsPart[len(mediaItemsPart)-1].StartDate*1000000).Local(),
+				time.Unix(0, mediaItemsPart[0].StartDate*1000000).Local())
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("can't delete old media items: %v", err)
+	}
+	log.Printf("Media items deleted: %v\n", len(mediaItems))
+	return nil
+}
+
+// Delete empty albums
+func cleanEmptyAlbums(credentials auth.CookieCredentials) error {
+	log.Printf("Deleting empty albums...\n")
+	albums, deleted, notDeleted, err := api.DeleteEmptyAlbums(credentials)
+	for _, album := range deleted {
+		log.Printf("Empty album %v (%v) deleted\n", album.AlbumName, album.AlbumId)
+		emitAlbumDeleted(album)
+	}
+	for _, album := range notDeleted {
+		log.Printf("Empty album %v (%v) deletion FAILED\n", album.AlbumName, album.AlbumId)
+	}
+	log.Printf("Album listed: %v\n", len(albums))
+	if err != nil {
+		log.Printf("Can't list albums: %v\n", err)
+	}
+	return nil
+}
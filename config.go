@@ -0,0 +1,391 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GaPhi/gphotosuploader/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// Default configuration file, read if it exists
+const defaultConfigFile = "gphotosuploader.yaml"
+
+// Log file opened by initLogFile
+var logFileHandle *os.File
+
+// Content of the configuration file: the default settings and named profiles overriding them
+type Config struct {
+	Settings `yaml:",inline"`
+
+	Profiles map[string]Settings `yaml:"profiles"`
+}
+
+// Settings of the configuration file. Empty values are left to the CLI arguments. The booleans are pointers, so that a
+// profile can set them to false
+type Settings struct {
+	Auth          string `yaml:"auth"`
+	UploadedList  string `yaml:"uploadedList"`
+	AlbumCache    string `yaml:"albumCache"`
+	MaxConcurrent int    `yaml:"maxConcurrent"`
+	Album         string `yaml:"album"`
+	Quota         string `yaml:"quota"`
+	Control       string `yaml:"control"`
+	ControlToken  string `yaml:"controlToken"`
+	Metrics       string `yaml:"metrics"`
+
+	// Files uploaded once and directories watched
+	Upload []string      `yaml:"upload"`
+	Watch  []WatchConfig `yaml:"watch"`
+
+	// Other Google accounts, uploading the files of their directories
+	Accounts []AccountConfig `yaml:"accounts"`
+
+	// Filters of all the files
+	FilterConfig `yaml:",inline"`
+
+	Schedule ScheduleConfig `yaml:"schedule"`
+	Log      LogConfig      `yaml:"log"`
+	Login    LoginConfig    `yaml:"login"`
+}
+
+// Watched directory, with its own album and filter settings
+type WatchConfig struct {
+	Path      string `yaml:"path"`
+	Album     string `yaml:"album"`
+	AlbumRule string `yaml:"albumRule"`
+
+	FilterConfig `yaml:",inline"`
+}
+
+// Google account uploading the files of its directories, with its own auth store, list of uploaded files, album cache
+// and number of concurrent uploads
+type AccountConfig struct {
+	Name          string   `yaml:"name"`
+	Auth          string   `yaml:"auth"`
+	Directories   []string `yaml:"directories"`
+	UploadedList  string   `yaml:"uploadedList"`
+	AlbumCache    string   `yaml:"albumCache"`
+	MaxConcurrent int      `yaml:"maxConcurrent"`
+}
+
+type FilterConfig struct {
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+	MinSize string   `yaml:"minSize"`
+	MaxSize string   `yaml:"maxSize"`
+
+	// Maximum age, in days
+	MaxAge int `yaml:"maxAge"`
+}
+
+type ScheduleConfig struct {
+	EventDelay      time.Duration `yaml:"eventDelay"`
+	QuotaInterval   time.Duration `yaml:"quotaInterval"`
+	Rescan          time.Duration `yaml:"rescan"`
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+	TokenRefresh    time.Duration `yaml:"tokenRefresh"`
+}
+
+// Options of the WebDriver login wizard
+type LoginConfig struct {
+	Browser        string        `yaml:"browser"`
+	WebDriver      string        `yaml:"webDriver"`
+	ChromeDriver   string        `yaml:"chromeDriver"`
+	BrowserProfile string        `yaml:"browserProfile"`
+	Headless       *bool         `yaml:"headless"`
+	Timeout        time.Duration `yaml:"timeout"`
+}
+
+type LogConfig struct {
+	File  string `yaml:"file"`
+	Debug *bool  `yaml:"debug"`
+}
+
+// Read the configuration file and return its settings, overridden by the profile if any. A missing file is only an
+// error when it has been explicitly given
+func loadConfig(fileName string, profile string, required bool) (Settings, error) {
+	data, err := os.ReadFile(fileName)
+	if errors.Is(err, os.ErrNotExist) && !required && profile == "" {
+		return Settings{}, nil
+	} else if err != nil {
+		return Settings{}, fmt.Errorf("can't read configuration file (%v)", err)
+	}
+
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return Settings{}, fmt.Errorf("can't parse configuration file '%v' (%v)", fileName, err)
+	}
+	if profile == "" {
+		return config.Settings, nil
+	}
+	override, found := config.Profiles[profile]
+	if !found {
+		return Settings{}, fmt.Errorf("unknown profile '%v' in configuration file '%v'", profile, fileName)
+	}
+	return config.Settings.merge(override), nil
+}
+
+// Settings overridden by the values given by other settings. A list given by the other settings, even empty, replaces
+// the list of the settings: a profile excluding "*.raw" doesn't keep the default exclude patterns
+func (s Settings) merge(other Settings) Settings {
+	mergeString := func(value *string, override string) {
+		if override != "" {
+			*value = override
+		}
+	}
+	mergeBool := func(value **bool, override *bool) {
+		if override != nil {
+			*value = override
+		}
+	}
+	mergeString(&s.Auth, other.Auth)
+	mergeString(&s.UploadedList, other.UploadedList)
+	mergeString(&s.AlbumCache, other.AlbumCache)
+	mergeString(&s.Album, other.Album)
+	mergeString(&s.Quota, other.Quota)
+	mergeString(&s.Control, other.Control)
+	mergeString(&s.ControlToken, other.ControlToken)
+	mergeString(&s.Metrics, other.Metrics)
+	mergeString(&s.MinSize, other.MinSize)
+	mergeString(&s.MaxSize, other.MaxSize)
+	mergeString(&s.Log.File, other.Log.File)
+	mergeString(&s.Login.Browser, other.Login.Browser)
+	mergeString(&s.Login.WebDriver, other.Login.WebDriver)
+	mergeString(&s.Login.ChromeDriver, other.Login.ChromeDriver)
+	mergeString(&s.Login.BrowserProfile, other.Login.BrowserProfile)
+	if other.MaxConcurrent != 0 {
+		s.MaxConcurrent = other.MaxConcurrent
+	}
+	if other.MaxAge != 0 {
+		s.MaxAge = other.MaxAge
+	}
+	if other.Upload != nil {
+		s.Upload = other.Upload
+	}
+	if other.Watch != nil {
+		s.Watch = other.Watch
+	}
+	if other.Accounts != nil {
+		s.Accounts = other.Accounts
+	}
+	if other.Include != nil {
+		s.Include = other.Include
+	}
+	if other.Exclude != nil {
+		s.Exclude = other.Exclude
+	}
+	if other.Schedule.EventDelay != 0 {
+		s.Schedule.EventDelay = other.Schedule.EventDelay
+	}
+	if other.Schedule.QuotaInterval != 0 {
+		s.Schedule.QuotaInterval = other.Schedule.QuotaInterval
+	}
+	if other.Schedule.Rescan != 0 {
+		s.Schedule.Rescan = other.Schedule.Rescan
+	}
+	if other.Schedule.ShutdownTimeout != 0 {
+		s.Schedule.ShutdownTimeout = other.Schedule.ShutdownTimeout
+	}
+	if other.Schedule.TokenRefresh != 0 {
+		s.Schedule.TokenRefresh = other.Schedule.TokenRefresh
+	}
+	if other.Login.Timeout != 0 {
+		s.Login.Timeout = other.Login.Timeout
+	}
+	mergeBool(&s.Log.Debug, other.Log.Debug)
+	mergeBool(&s.Login.Headless, other.Login.Headless)
+	return s
+}
+
+// Use the settings as the values of the CLI arguments that have not been given. The arguments that the command doesn't
+// have are skipped
+func applyConfig(flags *flag.FlagSet, settings Settings) error {
+	given := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	set := func(name string, value string) error {
+		if given[name] || value == "" || flags.Lookup(name) == nil {
+			return nil
+		}
+		if err := flags.Set(name, value); err != nil {
+			return fmt.Errorf("invalid '%v' in configuration file (%v)", name, err)
+		}
+		return nil
+	}
+	setDuration := func(name string, value time.Duration, unit time.Duration) error {
+		if value == 0 {
+			return nil
+		}
+		return set(name, strconv.FormatInt(int64(value/unit), 10))
+	}
+	setAll := func(name string, values []string) error {
+		if given[name] || flags.Lookup(name) == nil {
+			return nil
+		}
+		for _, value := range values {
+			if err := flags.Set(name, value); err != nil {
+				return fmt.Errorf("invalid '%v' in configuration file (%v)", name, err)
+			}
+		}
+		return nil
+	}
+
+	errs := []error{
+		set("auth", settings.Auth),
+		set("uploadedList", settings.UploadedList),
+		set("albumCache", settings.AlbumCache),
+		set("album", settings.Album),
+		set("quota", settings.Quota),
+		set("control", settings.Control),
+		set("controlToken", settings.ControlToken),
+		set("metrics", settings.Metrics),
+		set("minSize", settings.MinSize),
+		set("maxSize", settings.MaxSize),
+		set("logFile", settings.Log.File),
+		set("browser", settings.Login.Browser),
+		set("webDriver", settings.Login.WebDriver),
+		set("chromeDriver", settings.Login.ChromeDriver),
+		set("browserProfile", settings.Login.BrowserProfile),
+		setAll("include", settings.Include),
+		setAll("exclude", settings.Exclude),
+		setDuration("eventDelay", settings.Schedule.EventDelay, time.Second),
+		setDuration("quotaInterval", settings.Schedule.QuotaInterval, time.Minute),
+		setDuration("rescanInterval", settings.Schedule.Rescan, time.Minute),
+		setDuration("shutdownTimeout", settings.Schedule.ShutdownTimeout, time.Second),
+		setDuration("tokenRefresh", settings.Schedule.TokenRefresh, time.Minute),
+		setDuration("loginTimeout", settings.Login.Timeout, time.Second),
+	}
+	if settings.MaxConcurrent != 0 {
+		errs = append(errs, set("maxConcurrent", strconv.Itoa(settings.MaxConcurrent)))
+	}
+	if settings.MaxAge != 0 {
+		errs = append(errs, set("maxAge", strconv.Itoa(settings.MaxAge)))
+	}
+	if settings.Log.Debug != nil {
+		errs = append(errs, set("debug", strconv.FormatBool(*settings.Log.Debug)))
+	}
+	if settings.Login.Headless != nil {
+		errs = append(errs, set("headless", strconv.FormatBool(*settings.Login.Headless)))
+	}
+	return errors.Join(errs...)
+}
+
+// Upload the files of the configuration file, if no file has been given
+func useConfigUploads(settings Settings) error {
+	if len(filesToUpload) > 0 {
+		return nil
+	}
+	for _, name := range settings.Upload {
+		if err := filesToUpload.Set(name); err != nil {
+			return fmt.Errorf("invalid file to upload (%v)", err)
+		}
+	}
+	return nil
+}
+
+// Watch the directories of the configuration file with their own settings, if no directory has been given
+func useConfigWatch(settings Settings) error {
+	if len(directoriesToWatch) > 0 {
+		return nil
+	}
+	for _, watch := range settings.Watch {
+		if err := directoriesToWatch.Set(watch.Path); err != nil {
+			return fmt.Errorf("invalid watched directory (%v)", err)
+		}
+		watchSettings = append(watchSettings, watch)
+		watchFromConfig = true
+	}
+	return nil
+}
+
+// Use the accounts of the configuration file, if no account has been given
+func useConfigAccounts(settings Settings) error {
+	if len(accountConfigs) > 0 {
+		return nil
+	}
+	for _, config := range settings.Accounts {
+		if err := accountConfigs.add(config); err != nil {
+			return fmt.Errorf("invalid account (%v)", err)
+		}
+	}
+	return nil
+}
+
+// Log to a file too. Calling it again reopens the file (after a log rotation)
+func initLogFile(fileName string) {
+	if fileName == "" {
+		return
+	}
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
+	if err != nil {
+		log.Printf("Can't open log file '%v' (%v)\n", fileName, err)
+		return
+	}
+	log.SetOutput(io.MultiWriter(os.Stderr, file))
+	if logFileHandle != nil {
+		_ = logFileHandle.Close()
+	}
+	logFileHandle = file
+}
+
+// Create the filters of the watched directories that have their own settings, based on the global filter
+func initDirectoryFilters() error {
+	for _, watch := range watchSettings {
+		filter := utils.NewFileFilter(false)
+		filter.Include = fileFilter.Include
+		filter.Exclude = append(append(utils.Patterns{}, fileFilter.Exclude...), watch.Exclude...)
+		filter.MinSize, filter.MaxSize, filter.MaxAge = fileFilter.MinSize, fileFilter.MaxSize, fileFilter.MaxAge
+
+		var err error
+		if watch.Include != nil {
+			filter.Include = watch.Include
+		}
+		if watch.MinSize != "" {
+			if filter.MinSize, err = utils.ParseSize(watch.MinSize); err != nil {
+				return fmt.Errorf("invalid minSize of '%v' (%v)", watch.Path, err)
+			}
+		}
+		if watch.MaxSize != "" {
+			if filter.MaxSize, err = utils.ParseSize(watch.MaxSize); err != nil {
+				return fmt.Errorf("invalid maxSize of '%v' (%v)", watch.Path, err)
+			}
+		}
+		if watch.MaxAge != 0 {
+			filter.MaxAge = time.Duration(watch.MaxAge) * 24 * time.Hour
+		}
+
+		path, err := filepath.Abs(watch.Path)
+		if err != nil {
+			return fmt.Errorf("can't get the absolute path of '%v' (%v)", watch.Path, err)
+		}
+		filter.AddRoot(path)
+		directoryFilters[path] = filter
+	}
+	return nil
+}
+
+// Filter of the deepest watched directory with its own settings containing the path, or the global filter
+func filterOf(path string) *utils.FileFilter {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	filtersMutex.RLock()
+	defer filtersMutex.RUnlock()
+	filter, deepest := fileFilter, ""
+	for dir, f := range directoryFilters {
+		if (path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))) && len(dir) > len(deepest) {
+			filter, deepest = f, dir
+		}
+	}
+	return filter
+}
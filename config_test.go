@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testConfig = `
+auth: auth.json
+exclude: ["*.tmp", "*.raw"]
+include: ["*.jpg"]
+log:
+  debug: true
+login:
+  headless: true
+profiles:
+  replace:
+    exclude: ["*.xcf"]
+    log:
+      debug: false
+  clear:
+    exclude: []
+    auth: other.json
+  keep:
+    maxConcurrent: 4
+`
+
+func TestLoadConfigProfiles(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(fileName, []byte(testConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		profile  string
+		auth     string
+		exclude  []string
+		debug    bool
+		headless bool
+	}{
+		{"", "auth.json", []string{"*.tmp", "*.raw"}, true, true},
+		{"replace", "auth.json", []string{"*.xcf"}, false, true},
+		{"clear", "other.json", []string{}, true, true},
+		{"keep", "auth.json", []string{"*.tmp", "*.raw"}, true, true},
+	}
+	for _, test := range tests {
+		settings, err := loadConfig(fileName, test.profile, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if settings.Auth != test.auth || !reflect.DeepEqual(settings.Exclude, test.exclude) {
+			t.Errorf("profile %q: got auth %q, exclude %q", test.profile, settings.Auth, settings.Exclude)
+		}
+		if !reflect.DeepEqual(settings.Include, []string{"*.jpg"}) {
+			t.Errorf("profile %q: got include %q", test.profile, settings.Include)
+		}
+		if *settings.Log.Debug != test.debug || *settings.Login.Headless != test.headless {
+			t.Errorf("profile %q: got debug %v, headless %v", test.profile, *settings.Log.Debug, *settings.Login.Headless)
+		}
+	}
+
+	if _, err := loadConfig(fileName, "unknown", true); err == nil {
+		t.Error("unknown profile accepted")
+	}
+}
+
+// A boolean set to false by the configuration file overrides the default value of its argument, but not the argument
+func TestApplyConfigBooleans(t *testing.T) {
+	disabled := false
+	settings := Settings{Log: LogConfig{Debug: &disabled}, Login: LoginConfig{Headless: &disabled}}
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	debug := flags.Bool("debug", true, "")
+	headless := flags.Bool("headless", true, "")
+	if err := flags.Parse([]string{"-headless"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyConfig(flags, settings); err != nil {
+		t.Fatal(err)
+	}
+	if *debug || !*headless {
+		t.Errorf("got debug %v, headless %v", *debug, *headless)
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/GaPhi/gphotosuploader/api"
+	"github.com/GaPhi/gphotosuploader/utils"
+)
+
+// Number of recent uploads and errors kept for the status
+const recentEventsCount = 50
+
+var (
+	// Address of the control server (host:port on the loopback interface, or unix:path), empty to disable it
+	controlAddress string
+
+	// Bearer token required by the control server, empty to accept the requests without token
+	controlToken string
+
+	// Protects the statistics, the failed files and the recent events, read by the control server
+	statusMutex   sync.Mutex
+	recentUploads []outputEvent
+	recentErrors  []outputEvent
+)
+
+// Status returned by GET /status
+type controlStatus struct {
+	Paused   bool `json:"paused"`
+	Stopped  bool `json:"stopped"`
+	Uploaded int  `json:"uploaded"`
+	Ignored  int  `json:"ignored"`
+	Errors   int  `json:"errors"`
+
+	Queued        []utils.QueuedUpload   `json:"queued"`
+	InFlight      []utils.InFlightUpload `json:"inFlight"`
+	Failed        []string               `json:"failed"`
+	RecentUploads []outputEvent          `json:"recentUploads"`
+	RecentErrors  []outputEvent          `json:"recentErrors"`
+
+	// State of each account
+	Accounts []accountStatus `json:"accounts"`
+}
+
+// State of the uploader of an account
+type accountStatus struct {
+	Name     string `json:"name"`
+	Paused   bool   `json:"paused"`
+	Stopped  bool   `json:"stopped"`
+	Queued   int    `json:"queued"`
+	InFlight int    `json:"inFlight"`
+}
+
+// Append an event, keeping the last recentEventsCount events
+func appendRecent(events []outputEvent, event outputEvent) []outputEvent {
+	events = append(events, event)
+	if len(events) > recentEventsCount {
+		events = events[len(events)-recentEventsCount:]
+	}
+	return events
+}
+
+// Start the control server on the controlAddress. Only the loopback interface and unix sockets are accepted. The web
+// pages opened in a browser can't use it: the Host must be a loopback name or address (against DNS rebinding), the
+// POST requests must be JSON (so that browsers send a preflight request first), and the controlToken is required
+func startControlServer() (*http.Server, error) {
+	listener, err := listenControl(controlAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", getOnly(handleStatus))
+	mux.HandleFunc("/credentials", getOnly(handleCredentials))
+	mux.HandleFunc("/enqueue", postOnly(handleEnqueue))
+	mux.HandleFunc("/pause", postOnly(func(w http.ResponseWriter, r *http.Request) {
+		for _, acc := range accounts {
+			acc.uploader.Pause()
+		}
+		log.Println("Uploads paused")
+		writeJson(w, http.StatusOK, map[string]bool{"paused": true})
+	}))
+	mux.HandleFunc("/resume", postOnly(func(w http.ResponseWriter, r *http.Request) {
+		for _, acc := range accounts {
+			acc.uploader.Resume()
+		}
+		log.Println("Uploads resumed")
+		writeJson(w, http.StatusOK, map[string]bool{"paused": false})
+	}))
+	mux.HandleFunc("/retry", postOnly(handleRetry))
+	mux.HandleFunc("/metrics", getOnly(handleMetrics))
+	mux.HandleFunc("/rescan", postOnly(func(w http.ResponseWriter, r *http.Request) {
+		go rescanWatchedDirectories()
+		writeJson(w, http.StatusAccepted, map[string]bool{"rescanning": true})
+	}))
+
+	server := &http.Server{Handler: protectControl(mux, !strings.HasPrefix(controlAddress, "unix:"))}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("Control server stopped: %v\n", err)
+		}
+	}()
+	log.Printf("Control server listening on %v\n", controlAddress)
+	return server, nil
+}
+
+func listenControl(address string) (net.Listener, error) {
+	if !strings.HasPrefix(address, "unix:") {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address '%v' (%v)", address, err)
+		}
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			return nil, fmt.Errorf("the control address '%v' must be on localhost or a unix socket", address)
+		}
+	}
+	return listen(address)
+}
+
+// Refuse the requests of other hosts when listening on TCP, the POST requests which are not JSON, and the requests
+// without the control token
+func protectControl(handler http.Handler, checkHost bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if checkHost && !isLoopbackHost(r.Host) {
+			writeJson(w, http.StatusForbidden, map[string]string{"error": "the host must be localhost"})
+			return
+		}
+		if r.Method == http.MethodPost {
+			if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+				writeJson(w, http.StatusUnsupportedMediaType, map[string]string{"error": "use Content-Type: application/json"})
+				return
+			}
+		}
+		if controlToken != "" {
+			token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !found || subtle.ConstantTimeCompare([]byte(token), []byte(controlToken)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeJson(w, http.StatusUnauthorized, map[string]string{"error": "invalid or missing token"})
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Tell whether the Host header is localhost or a loopback address, with or without port
+func isLoopbackHost(host string) bool {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	host = strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Listen on a TCP address (host:port) or on a unix socket (unix:path)
+func listen(address string) (net.Listener, error) {
+	if path, found := strings.CutPrefix(address, "unix:"); found {
+		// Remove the socket of a previous run
+		if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+			_ = os.Remove(path)
+		}
+		return net.Listen("unix", path)
+	}
+	return net.Listen("tcp", address)
+}
+
+// Status of all the accounts: the uploads are paused or stopped when they are for all the accounts
+func handleStatus(w http.ResponseWriter, _ *http.Request) {
+	statusMutex.Lock()
+	status := controlStatus{
+		Paused:        true,
+		Stopped:       true,
+		Uploaded:      uploadedFilesCount,
+		Ignored:       ignoredCount,
+		Errors:        errorsCount,
+		Queued:        []utils.QueuedUpload{},
+		InFlight:      []utils.InFlightUpload{},
+		Failed:        append([]string{}, failedFiles...),
+		RecentUploads: append([]outputEvent{}, recentUploads...),
+		RecentErrors:  append([]outputEvent{}, recentErrors...),
+	}
+	statusMutex.Unlock()
+	for _, acc := range accounts {
+		queued, inFlight := acc.uploader.QueuedUploads(), acc.uploader.InFlightUploads()
+		status.Paused = status.Paused && acc.uploader.Paused()
+		status.Stopped = status.Stopped && acc.uploader.Stopped()
+		status.Queued = append(status.Queued, queued...)
+		status.InFlight = append(status.InFlight, inFlight...)
+		status.Accounts = append(status.Accounts, accountStatus{
+			Name:     acc.Name,
+			Paused:   acc.uploader.Paused(),
+			Stopped:  acc.uploader.Stopped(),
+			Queued:   len(queued),
+			InFlight: len(inFlight),
+		})
+	}
+	writeJson(w, http.StatusOK, status)
+}
+
+// Check the credentials of the account of the account parameter, the default account if not set
+func handleCredentials(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("account")
+	if name == "" {
+		name = defaultAccountName
+	}
+	acc := accountNamed(name)
+	if acc == nil {
+		writeJson(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("unknown account '%v'", name)})
+		return
+	}
+	writeJson(w, http.StatusOK, api.CheckCredentials(acc.credentials))
+}
+
+// Enqueue the files and directories of the request body ({"paths": [...]}), walking them with the file filter. Only
+// the paths in the watched directories are accepted
+func handleEnqueue(w http.ResponseWriter, r *http.Request) {
+	if shuttingDown.Load() {
+		writeJson(w, http.StatusServiceUnavailable, map[string]string{"error": "stopping"})
+		return
+	}
+	var request struct {
+		Paths []string `json:"paths"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&request); err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid request (%v)", err)})
+		return
+	}
+
+	enqueued, errs := 0, []string{}
+	for _, name := range request.Paths {
+		if !isInWatchedDirectory(name) {
+			errs = append(errs, fmt.Sprintf("'%v' is not in a watched directory", name))
+			continue
+		}
+		err := filterOf(name).Walk(name, func(path string, file os.FileInfo) {
+			if err := accountOf(path).uploader.EnqueueUpload(path); err != nil {
+				errs = append(errs, err.Error())
+			} else {
+				enqueued++
+			}
+		})
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	writeJson(w, http.StatusOK, map[string]interface{}{"enqueued": enqueued, "errors": errs})
+}
+
+// Tell whether the path is a watched directory or is in one
+func isInWatchedDirectory(path string) bool {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	for _, name := range watchedDirectories() {
+		root, err := filepath.Abs(name)
+		if err == nil && (path == root || strings.HasPrefix(path, root+string(filepath.Separator))) {
+			return true
+		}
+	}
+	return false
+}
+
+// Restart the uploads stopped by an error, and enqueue the failed files again
+func handleRetry(w http.ResponseWriter, _ *http.Request) {
+	if shuttingDown.Load() {
+		writeJson(w, http.StatusServiceUnavailable, map[string]string{"error": "stopping"})
+		return
+	}
+	statusMutex.Lock()
+	files := failedFiles
+	failedFiles = []string{}
+	retriesCount += len(files)
+	statusMutex.Unlock()
+
+	for _, acc := range accounts {
+		acc.uploader.RestartUploads()
+	}
+	for _, path := range files {
+		_ = accountOf(path).uploader.EnqueueUpload(path)
+	}
+	log.Printf("Retrying %v failed uploads\n", len(files))
+	writeJson(w, http.StatusOK, map[string]int{"retried": len(files)})
+}
+
+func getOnly(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJson(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET"})
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func postOnly(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJson(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST"})
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func writeJson(w http.ResponseWriter, code int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/GaPhi/gphotosuploader/utils"
+	"github.com/fsnotify/fsnotify"
+)
+
+// Wait for a signal or for the first error with failOnError. In daemon mode, systemd is notified that the service is
+// ready, its watchdog is pinged and the configuration is reloaded on SIGHUP
+func waitWhileWatching(fsWatcher *fsnotify.Watcher) {
+	c := make(chan os.Signal, 2)
+	if !daemonMode {
+		log.Println("Watching 👀\nPress CTRL + C to stop")
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	} else {
+		log.Printf("Watching %v directories\n", len(directoriesToWatch))
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+		stopWatchdog := make(chan struct{})
+		defer close(stopWatchdog)
+		utils.StartSdWatchdog(stopWatchdog)
+		notifySystemd("READY=1")
+	}
+
+	for {
+		select {
+		case sig := <-c:
+			if sig != syscall.SIGHUP {
+				log.Printf("Stopping (%v)\n", sig)
+				notifySystemd("STOPPING=1")
+				return
+			}
+			notifySystemd("RELOADING=1")
+			reloadConfig(fsWatcher)
+			notifySystemd("READY=1")
+
+		case err := <-failed:
+			log.Printf("Stop watching after the error: %v\n", err)
+			notifySystemd("STOPPING=1")
+			return
+		}
+	}
+}
+
+func notifySystemd(state string) {
+	if err := utils.SdNotify(state); err != nil {
+		log.Printf("Can't notify systemd (%v)\n", err)
+	}
+}
+
+// Let the started uploads finish, for at most the timeout: the queued uploads are not attempted. It returns false if
+// some uploads are still running
+func drainUploads(timeout time.Duration) bool {
+	for _, timer := range timers {
+		timer.Stop()
+	}
+	shuttingDown.Store(true)
+	for _, acc := range accounts {
+		acc.uploader.StopUploads()
+		acc.uploader.Resume()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for _, acc := range accounts {
+			acc.uploader.WaitUploadsCompleted()
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Read the configuration file again: reopen the log file, and when the watched directories come from the configuration
+// file, update their filters and start to watch the new ones (unless they have an album). The other settings, and the
+// albums of the watched directories, need a restart
+func reloadConfig(fsWatcher *fsnotify.Watcher) {
+	initLogFile(logFile)
+	settings, err := loadConfig(configFileName, configProfile, configRequired)
+	if err != nil {
+		log.Printf("Can't reload the configuration: %v\n", err)
+		return
+	}
+	if !watchFromConfig {
+		log.Println("Configuration reloaded (the watched directories are given as arguments)")
+		return
+	}
+
+	filtersMutex.Lock()
+	previousSettings, previousFilters := watchSettings, directoryFilters
+	watchSettings, directoryFilters = settings.Watch, make(map[string]*utils.FileFilter)
+	err = initDirectoryFilters()
+	if err != nil {
+		watchSettings, directoryFilters = previousSettings, previousFilters
+	}
+	filtersMutex.Unlock()
+	if err != nil {
+		log.Printf("Can't reload the configuration: %v\n", err)
+		return
+	}
+
+	// Watch the new directories. The albums are chosen when the uploads start: the album settings of the watched
+	// directories need a restart, and the new directories with album settings are not watched until then
+	watched := make(map[string]bool)
+	for _, name := range watchedDirectories() {
+		path, _ := filepath.Abs(name)
+		watched[path] = true
+	}
+	previousAlbums := make(map[string][2]string)
+	for _, watch := range previousSettings {
+		path, _ := filepath.Abs(watch.Path)
+		previousAlbums[path] = [2]string{watch.Album, watch.AlbumRule}
+	}
+	for _, watch := range settings.Watch {
+		path, _ := filepath.Abs(watch.Path)
+		if watched[path] {
+			if previousAlbums[path] != [2]string{watch.Album, watch.AlbumRule} {
+				log.Printf("[WARNING] The new album of '%v' needs a restart\n", watch.Path)
+			}
+			continue
+		}
+		if watch.Album != "" || watch.AlbumRule != "" {
+			log.Printf("[WARNING] Not watching '%v' until a restart: its album needs a restart\n", watch.Path)
+			continue
+		}
+		filtersMutex.Lock()
+		err := directoriesToWatch.Set(watch.Path)
+		filtersMutex.Unlock()
+		if err != nil {
+			log.Printf("Can't watch '%v': %v\n", watch.Path, err)
+			continue
+		}
+		if err := startToWatch(watch.Path, fsWatcher); err != nil {
+			log.Printf("Can't watch '%v': %v\n", watch.Path, err)
+			continue
+		}
+		log.Printf("Watching '%v' (its existing files are uploaded by the rescans)\n", watch.Path)
+	}
+	log.Println("Configuration reloaded")
+}
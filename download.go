@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/GaPhi/gphotosuploader/api"
+	"github.com/GaPhi/gphotosuploader/auth"
+)
+
+// Run the download subcommand, returning the exit code
+func runDownloadCommand(args []string) int {
+	flags := flag.NewFlagSet("download", flag.ExitOnError)
+	flags.StringVar(&authFile, "auth", "auth.json", authUsageText)
+	flags.BoolVar(&api.LogRequests, "debug", false, "Log Google requests and responses")
+	albumArg := flags.String("album", "", "Album to download (album id, shared album id or URL), the whole library if not set")
+	dir := flags.String("dir", ".", "Directory in which the media items are written")
+	maxItems := flags.Int("max", 0, "Maximum number of media items to download (0: no limit)")
+	downloadedList := flags.String("downloadedList", "",
+		"List of the downloaded media items, which are not downloaded again (default: downloaded.txt in the directory)")
+	_ = flags.Parse(args)
+
+	// Check arguments before authenticating
+	var (
+		album api.AlbumRef
+		err   error
+	)
+	if *albumArg != "" {
+		if album, err = api.ResolveAlbumRef(*albumArg); err != nil {
+			log.Println(err)
+			return exitUsage
+		}
+	}
+	if info, err := os.Stat(*dir); err != nil || !info.IsDir() {
+		log.Printf("'%v' is not a directory\n", *dir)
+		return exitUsage
+	}
+	if *downloadedList == "" {
+		*downloadedList = filepath.Join(*dir, "downloaded.txt")
+	}
+	downloadedItems, err := loadDownloadedItems(*downloadedList)
+	if err != nil {
+		log.Printf("Can't read the downloaded list: %v\n", err)
+		return exitUsage
+	}
+
+	credentials := initAuthentication()
+
+	var it *api.Iterator[api.MediaItem]
+	if *albumArg != "" {
+		albumId, err := albumIdOf(credentials, album)
+		if err != nil {
+			log.Println(err)
+			return exitFailure
+		}
+		it = api.IterateAlbumMediaItems(credentials, albumId, "")
+	} else {
+		it = api.IterateMediaItemsBefore(credentials, nil, "")
+	}
+	defer it.Close()
+
+	downloaded, skipped, failed := 0, 0, 0
+	for it.Next() && (*maxItems <= 0 || downloaded+failed < *maxItems) {
+		mediaItem := it.Item()
+		if downloadedItems[mediaItem.MediaItemId] {
+			skipped++
+			continue
+		}
+		fileName, err := downloadMediaItem(credentials, mediaItem, *dir)
+		if err == nil {
+			err = appendDownloadedItem(*downloadedList, mediaItem.MediaItemId, fileName)
+		}
+		if err != nil {
+			log.Printf("Can't download media item %v: %v\n", mediaItem.MediaItemId, err)
+			failed++
+			continue
+		}
+		log.Printf("Media item %v downloaded to '%v'\n", mediaItem.MediaItemId, fileName)
+		downloadedItems[mediaItem.MediaItemId] = true
+		downloaded++
+	}
+	if err := it.Err(); err != nil {
+		log.Printf("Can't list media items: %v\n", err)
+		return exitFailure
+	}
+
+	log.Printf("Done (%v media items downloaded, %v already downloaded, %v errors)\n", downloaded, skipped, failed)
+	if failed > 0 {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// Download a media item into the directory, returning the name of the written file. Existing files are not
+// overwritten: the media key is added to the name of the media items named like an existing file
+func downloadMediaItem(credentials auth.CookieCredentials, mediaItem api.MediaItem, dir string) (string, error) {
+	content, fileName, err := api.DownloadMediaItem(credentials, mediaItem)
+	if err != nil {
+		return "", err
+	}
+	defer func(content io.ReadCloser) {
+		_ = content.Close()
+	}(content)
+
+	file, err := createDownloadFile(dir, fileName, mediaItem.MediaItemId)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(file, content); err != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return "", fmt.Errorf("can't write '%v' (%v)", file.Name(), err)
+	}
+	return file.Name(), file.Close()
+}
+
+// Create the file of a media item in the directory. When a file already has the name, for instance because cameras
+// reuse the names, the media key is added to the name (IMG_0001-KEY.JPG)
+func createDownloadFile(dir string, fileName string, key api.MediaKey) (*os.File, error) {
+	if fileName == "" {
+		fileName = string(key)
+	}
+	fileName = filepath.Join(dir, filepath.Base(fileName))
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666)
+	if os.IsExist(err) {
+		ext := filepath.Ext(fileName)
+		fileName = fmt.Sprintf("%v-%v%v", strings.TrimSuffix(fileName, ext), key, ext)
+		file, err = os.OpenFile(fileName, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666)
+	}
+	return file, err
+}
+
+// Read the media keys of the list of downloaded media items, which has a line per media item with its key and the
+// name of its file
+func loadDownloadedItems(fileName string) (map[api.MediaKey]bool, error) {
+	items := make(map[api.MediaKey]bool)
+	file, err := os.Open(fileName)
+	if os.IsNotExist(err) {
+		return items, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if key, _, _ := strings.Cut(scanner.Text(), "\t"); key != "" {
+			items[api.MediaKey(key)] = true
+		}
+	}
+	return items, scanner.Err()
+}
+
+// Add a media item to the list of downloaded media items
+func appendDownloadedItem(fileName string, key api.MediaKey, downloadedFile string) error {
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(file, "%v\t%v\n", key, downloadedFile); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/GaPhi/gphotosuploader/api"
+)
+
+func TestCreateDownloadFile(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		fileName string
+		key      api.MediaKey
+		want     string
+	}{
+		{"IMG_0001.JPG", "AF1QipOne", "IMG_0001.JPG"},
+		{"IMG_0001.JPG", "AF1QipTwo", "IMG_0001-AF1QipTwo.JPG"},
+		{"../IMG_0002.JPG", "AF1QipThree", "IMG_0002.JPG"},
+		{"", "AF1QipFour", "AF1QipFour"},
+		{"README", "AF1QipFive", "README"},
+		{"README", "AF1QipSix", "README-AF1QipSix"},
+	}
+	for _, test := range tests {
+		file, err := createDownloadFile(dir, test.fileName, test.key)
+		if err != nil {
+			t.Errorf("createDownloadFile(%q, %v): %v", test.fileName, test.key, err)
+			continue
+		}
+		_ = file.Close()
+		if want := filepath.Join(dir, test.want); file.Name() != want {
+			t.Errorf("createDownloadFile(%q, %v) = %v, want %v", test.fileName, test.key, file.Name(), want)
+		}
+	}
+
+	// The same media item with the same name is refused rather than overwritten
+	if _, err := createDownloadFile(dir, "IMG_0001.JPG", "AF1QipTwo"); !os.IsExist(err) {
+		t.Errorf("got %v, want an existing file error", err)
+	}
+}
+
+func TestDownloadedItems(t *testing.T) {
+	list := filepath.Join(t.TempDir(), "downloaded.txt")
+	items, err := loadDownloadedItems(list)
+	if err != nil || len(items) != 0 {
+		t.Fatalf("missing list: got %v, %v", items, err)
+	}
+	for _, key := range []api.MediaKey{"AF1QipOne", "AF1QipTwo"} {
+		if err := appendDownloadedItem(list, key, "IMG_0001.JPG"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if items, err = loadDownloadedItems(list); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || !items["AF1QipOne"] || !items["AF1QipTwo"] {
+		t.Errorf("got %v", items)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/GaPhi/gphotosuploader/api"
+	"github.com/GaPhi/gphotosuploader/utils"
+)
+
+// Output formats
+const (
+	outputText = "text"
+	outputJson = "json"
+)
+
+var (
+	// Format of the standard output. With the JSON format, one event is written per line and the logs are only written
+	// on the standard error
+	outputFormat = outputText
+	outputMutex  sync.Mutex
+)
+
+// Event written on the standard output with the JSON format
+type outputEvent struct {
+	Time time.Time `json:"time"`
+
+	// uploaded, ignored, error, deleted or albumCreated
+	Event string `json:"event"`
+
+	Path     string  `json:"path,omitempty"`
+	ImageID  string  `json:"imageId,omitempty"`
+	Url      string  `json:"url,omitempty"`
+	Bytes    int64   `json:"bytes,omitempty"`
+	Duration float64 `json:"durationSeconds,omitempty"`
+
+	// Why a file was ignored
+	Reason utils.IgnoreReason `json:"reason,omitempty"`
+
+	// What failed, and the error
+	Class utils.ErrorClass `json:"class,omitempty"`
+	Error string           `json:"error,omitempty"`
+
+	// Deleted media items or albums, created album
+	MediaItems []api.MediaKey `json:"mediaItems,omitempty"`
+	AlbumId    api.AlbumID    `json:"albumId,omitempty"`
+	AlbumName  string         `json:"albumName,omitempty"`
+}
+
+// Summary written at the end of the uploads with the JSON format
+type outputSummary struct {
+	Time     time.Time `json:"time"`
+	Event    string    `json:"event"`
+	Uploaded int       `json:"uploaded"`
+	Ignored  int       `json:"ignored"`
+	Errors   int       `json:"errors"`
+
+	// Bytes uploaded, duration of the uploads and bytes uploaded per second
+	Bytes      int64   `json:"bytes"`
+	Elapsed    float64 `json:"elapsedSeconds"`
+	Throughput int64   `json:"bytesPerSecond"`
+
+	// Files not uploaded because of an error
+	Failed []string `json:"failed"`
+
+	ExitCode int `json:"exitCode"`
+}
+
+// Check and set the output format
+func setOutputFormat(format string) error {
+	if format != outputText && format != outputJson {
+		return fmt.Errorf("unknown output format '%v' (text or json)", format)
+	}
+	outputFormat = format
+	return nil
+}
+
+// Write an event or a summary on the standard output, if the output format is JSON
+func emit(value interface{}) {
+	if outputFormat != outputJson {
+		return
+	}
+	switch v := value.(type) {
+	case outputEvent:
+		v.Time = time.Now()
+		value = v
+	case outputSummary:
+		v.Time, v.Event = time.Now(), "summary"
+		value = v
+	}
+
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	_ = json.NewEncoder(os.Stdout).Encode(value)
+}
+
+func emitUploaded(upload utils.CompletedUpload) {
+	emit(uploadedEvent(upload))
+}
+
+func uploadedEvent(upload utils.CompletedUpload) outputEvent {
+	return outputEvent{
+		Time:     time.Now(),
+		Event:    "uploaded",
+		Path:     upload.Path,
+		ImageID:  upload.ImageID,
+		Url:      upload.ImageUrl,
+		Bytes:    upload.Bytes,
+		Duration: upload.Duration.Seconds(),
+	}
+}
+
+func emitIgnored(ignored utils.IgnoredUpload) {
+	emit(outputEvent{Event: "ignored", Path: ignored.Path, Reason: ignored.Reason})
+}
+
+func emitError(err error) {
+	emit(errorEvent(err))
+}
+
+func errorEvent(err error) outputEvent {
+	event := outputEvent{Time: time.Now(), Event: "error", Error: err.Error()}
+	var uploadErr *utils.UploadError
+	if errors.As(err, &uploadErr) {
+		event.Path, event.Class, event.Error = uploadErr.Path, uploadErr.Class, uploadErr.Err.Error()
+	}
+	return event
+}
+
+func emitDeleted(mediaItems []api.MediaKey) {
+	emit(outputEvent{Event: "deleted", MediaItems: mediaItems})
+}
+
+func emitAlbumDeleted(album api.Album) {
+	emit(outputEvent{Event: "deleted", AlbumId: album.AlbumId, AlbumName: album.AlbumName})
+}
+
+func emitAlbumCreated(albumName string, albumId api.AlbumID) {
+	emit(outputEvent{Event: "albumCreated", AlbumId: albumId, AlbumName: albumName})
+}
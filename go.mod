@@ -5,9 +5,12 @@ go 1.24.0
 require (
 	github.com/buger/jsonparser v1.1.1
 	github.com/fsnotify/fsnotify v1.9.0
+	github.com/godbus/dbus/v5 v5.1.0
 	github.com/tebeka/selenium v0.9.9
+	golang.org/x/crypto v0.43.0
 	golang.org/x/net v0.46.0
 	gopkg.in/headzoo/surf.v1 v1.0.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -2,14 +2,15 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
-	"os/signal"
 	"path/filepath"
 	"strings"
-	"syscall"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/GaPhi/gphotosuploader/api"
@@ -21,6 +22,30 @@ import (
 
 const noDeleteBefore = -1 << 63
 
+// Usage of the auth argument
+const authUsageText = "Authentication store: json file (auth.json or file:auth.json), encrypted json file (encrypted:auth.enc, with the " +
+	auth.PassphraseEnv + " environment variable or encrypted:auth.enc?passphraseFile=FILE) or Secret Service item (secret-service:NAME)"
+
+// Exit codes
+const (
+	exitOK = 0
+
+	// Fatal error of the command
+	exitFailure = 1
+
+	// Invalid arguments or configuration
+	exitUsage = 2
+
+	// Some files could not be uploaded
+	exitPartialFailure = 3
+
+	// The credentials are missing or not valid
+	exitAuth = 4
+
+	// The storage of the user is full, or too small for the files to upload
+	exitQuota = 5
+)
+
 var (
 	// CLI arguments
 	authFile             string
@@ -33,274 +58,260 @@ var (
 	directoriesToWatch   utils.DirectoriesToWatch
 	albumId              string
 	albumName            string
+	albumRules           utils.AlbumRules
+	albumCacheFile       string
 	albumSortKind        int
 	shareWithUser        string
-	sharedAlbumId        string
 	uploadedListFile     string
 	watchRecursively     bool
 	maxConcurrentUploads int
+	compressionRules     utils.CompressionRules
+	includedExtensions   utils.Extensions
+	includePatterns      utils.Patterns
+	excludePatterns      utils.Patterns
+	fileFilter           *utils.FileFilter
+	rescanInterval       time.Duration
+	logFile              string
+	excludedExtensions   utils.Extensions
+	timestampSources     []api.TimestampSource
+	quotaPolicy          utils.QuotaPolicy
+	quotaInterval        time.Duration
+	tokenRefreshInterval time.Duration
 	eventDelay           time.Duration
 	printVersion         bool
+	daemonMode           bool
+	shutdownTimeout      time.Duration
+
+	// Configuration file, read again on SIGHUP in daemon mode
+	configFileName  string
+	configProfile   string
+	configRequired  bool
+	watchFromConfig bool
 
-	// Uploader
-	uploader *utils.ConcurrentUploader
-	timers   = make(map[string]*time.Timer)
+	// Watched directories of the configuration file and their filters. The filtersMutex also protects the
+	// directoriesToWatch, extended when the configuration is reloaded
+	watchSettings    []WatchConfig
+	directoryFilters = make(map[string]*utils.FileFilter)
+	filtersMutex     sync.RWMutex
+
+	// Timers of the file events, by path
+	timers = make(map[string]*time.Timer)
 
 	// Statistics
 	uploadedFilesCount = 0
 	ignoredCount       = 0
 	errorsCount        = 0
+	uploadedBytes      int64
+	failedFiles        = []string{}
+	quotaExhausted     = false
+	authRefused        = false
+	ignoredByReason    = make(map[utils.IgnoreReason]int)
+	errorsByClass      = make(map[utils.ErrorClass]int)
+	lastUploadTime     time.Time
+	retriesCount       = 0
+	tokenRefreshCount  atomic.Int64
+
+	// Stop the uploads at the first error, and receive the error
+	failOnError bool
+	failed      = make(chan error, 1)
+
+	// Set once the watch is stopped: the queued uploads are not attempted
+	shuttingDown atomic.Bool
 )
 
+const usage = `Usage: gphotosuploader <command> [arguments]
+
+Commands:
+  upload FILE...         Upload files and directories
+  watch DIRECTORY...     Watch directories and upload their new files
+  albums <command>       Manage albums
+  share <command>        Manage the sharing of albums
+  clean <command>        Delete unsupported or old media items, empty the trash or delete empty albums
+  storage                Show the storage used and left
+  stats                  Show statistics about the library
+  auth <command>         Check the credentials or log in
+  download               Download media items
+  version                Print version and commit date
+
+Use "gphotosuploader <command> -h" for the arguments of a command.
+The arguments without command (like -upload or -watch) are deprecated.
+`
+
+// Subcommands, by name
+var commands = map[string]func(args []string) int{
+	"upload":   runUploadCommand,
+	"watch":    runWatchCommand,
+	"albums":   runAlbumsCommand,
+	"share":    runShareCommand,
+	"clean":    runCleanCommand,
+	"storage":  runStorageCommand,
+	"stats":    runStatsCommand,
+	"auth":     runAuthCommand,
+	"download": runDownloadCommand,
+	"version":  runVersionCommand,
+}
+
 func main() {
-	parseCliArguments()
-	if printVersion {
-		fmt.Printf("Hash:\t%s\nCommit date:\t%s\n", version.Hash, version.Date)
-		os.Exit(0)
+	if len(os.Args) > 1 {
+		if command, found := commands[os.Args[1]]; found {
+			os.Exit(command(os.Args[2:]))
+		}
+		if os.Args[1] == "help" {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(exitOK)
+		}
 	}
 
-	credentials := initAuthentication()
+	// Deprecated: arguments without command
+	os.Exit(runDeprecatedCommand(os.Args[1:]))
+}
 
-	var err error
+// Run the version subcommand
+func runVersionCommand([]string) int {
+	fmt.Printf("Hash:\t%s\nCommit date:\t%s\n", version.Hash, version.Date)
+	return exitOK
+}
 
-	// Get timeline
-	if false {
-		timeline, err := api.GetWholeTimeline(credentials)
-		if err != nil {
-			log.Fatalf("Can't get timeline: %v\n", err)
-		}
-		log.Printf("Got timeline: %v\n", len(timeline))
+// Run the requested operations in a fixed order, as before the subcommands: query storage, delete unsupported, empty
+// trash, delete old, delete empty albums, create album, sort, share, upload and watch. It returns the exit code
+func runDeprecatedCommand(args []string) int {
+	flags := flag.NewFlagSet("gphotosuploader", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		fmt.Fprintln(os.Stderr, "\nDeprecated arguments:")
+		flags.PrintDefaults()
+	}
+	flags.BoolVar(&queryStorage, "queryStorage", false, "Query storage (used/left), deprecated: use the storage command")
+	flags.BoolVar(&deleteUnsupported, "deleteUnsupported", false, "Delete unsupported media items, deprecated: use the clean unsupported command")
+	flags.Int64Var(&deleteBefore, "deleteBefore", noDeleteBefore, "Use this parameter to delete existing media items created before this date (Unix timestamp in ms), deprecated: use the clean before command")
+	flags.BoolVar(&emptyTrash, "emptyTrash", false, "Empty trash, deprecated: use the clean trash command")
+	flags.BoolVar(&deleteEmptyAlbums, "deleteEmptyAlbums", false, "Delete empty albums, deprecated: use the clean empty-albums command")
+	flags.Var(&filesToUpload, "upload", "File or directory to upload, deprecated: use the upload command")
+	flags.Var(&directoriesToWatch, "watch", "Directory to watch, deprecated: use the watch command")
+	flags.IntVar(&albumSortKind, "albumSortKind", 0, "Use this parameter to set sort kind of the album (1: Newest first, 2: Oldest first, 3: Last added first), deprecated: use the albums sort command")
+	flags.StringVar(&shareWithUser, "shareWithUser", "", "Use this parameter to share a specific album with a Google userId or userEmail, deprecated: use the share add command")
+	flags.BoolVar(&printVersion, "version", false, "Print version and commit date, deprecated: use the version command")
+	checkArguments := addUploadFlags(flags, uploadFiles|watchDirectories)
+	_ = flags.Parse(args)
+
+	if printVersion {
+		return runVersionCommand(nil)
+	}
+	if err := checkArguments(); err != nil {
+		log.Println(err)
+		return exitUsage
 	}
+	if deleteBefore != noDeleteBefore && deleteBefore > time.Now().UnixNano()/1000000 {
+		log.Printf("Invalid delteBefore date (after now)\n")
+		return exitUsage
+	}
+	if !queryStorage && !deleteUnsupported && !emptyTrash && deleteBefore == noDeleteBefore && !deleteEmptyAlbums &&
+		albumName == "" && albumSortKind == 0 && shareWithUser == "" && len(filesToUpload) == 0 && len(directoriesToWatch) == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	log.Println("[WARNING] The arguments without command are deprecated, see 'gphotosuploader help'")
+
+	credentials := initAuthentication()
 
 	// Query storage
 	if queryStorage {
 		log.Printf("Querying storage...\n")
 		used, total, err := api.QueryStorage(credentials)
 		if err != nil {
-			log.Fatalf("Can't get storage data: %v\n", err)
+			log.Printf("Can't get storage data: %v\n", err)
+			return exitFailure
 		}
 		log.Printf("Storage: %v/%v (%v%%)\n", used, total, 100.0*used/total)
 	}
 
-	// Delete unsupported media items
+	var err error
 	if deleteUnsupported {
-		log.Printf("Deleting unsupported media items...\n")
-		unsupported, err := api.ListAllUnsupportedMediaItemsBefore(credentials, nil)
-		if err != nil {
-			log.Fatalf("Can't get unsupported media items: %v\n", err)
-		}
-		log.Printf("Got unsupported media items: %v\n", len(unsupported))
-
-		// No item?
-		if len(unsupported) > 0 {
-			// Get ids as an array
-			ids := make([]string, len(unsupported))
-			for i, mediaItem := range unsupported {
-				ids[i] = mediaItem.MediaItemId
-			}
-
-			// Immediately delete (kind=2) too old media items
-			err = api.DeleteMediaItems(credentials, ids, 2)
-			if err != nil {
-				log.Printf("Media items deletion FAILED: %v\n", err)
-			} else {
-				log.Printf("%v media items deleted\n", len(ids))
-			}
-		}
+		err = cleanUnsupported(credentials)
 	}
-
-	// Empty trash
-	if emptyTrash {
-		log.Printf("Empty trash...\n")
-		err = api.EmptyTrash(credentials)
-		if err != nil {
-			log.Fatalf("Can't empty trash: %v\n", err)
-		}
-		log.Printf("Trash emptied\n")
+	if err == nil && emptyTrash {
+		err = cleanTrash(credentials)
 	}
-
-	// Delete too old media items
-	if deleteBefore != noDeleteBefore {
-		log.Printf("Deleting media items before %v...\n", time.Unix(0, deleteBefore*1000000).Local())
-		mediaItems, err := api.ListAllMediaItemsBefore(credentials, deleteBefore, func(mediaItemsPart []api.MediaItem, err error) {
-			// No item?
-			if len(mediaItemsPart) == 0 {
-				return
-			}
-
-			// Get ids as an array
-			ids := make([]string, len(mediaItemsPart))
-			for i, mediaItem := range mediaItemsPart {
-				ids[i] = mediaItem.MediaItemId
-			}
-
-			// Immediately delete (kind=2) too old media items
-			err = api.DeleteMediaItems(credentials, ids, 2)
-			if err != nil {
-				log.Printf("Media items deletion FAILED: %v\n", err)
-			} else {
-				log.Printf("%v media items deleted between %v and %v\n",
-					len(ids),
-					time.Unix(0, mediaItemsPart[len(mediaItemsPart)-1].StartDate*1000000).Local(),
-					time.Unix(0, mediaItemsPart[0].StartDate*1000000).Local())
-			}
-		})
-		if err != nil {
-			log.Fatalf("Can't delete old media items: %v\n", err)
-		}
-		log.Printf("Media items deleted: %v\n", len(mediaItems))
+	if err == nil && deleteBefore != noDeleteBefore {
+		err = cleanBefore(credentials, deleteBefore)
 	}
-
-	// Delete empty albums
-	if deleteEmptyAlbums {
-		log.Printf("Deleting empty albums...\n")
-		albums, deleted, notDeleted, err := api.DeleteEmptyAlbums(credentials)
-		for _, album := range deleted {
-			log.Printf("Empty album %v (%v) deleted\n", album.AlbumName, album.AlbumId)
-		}
-		for _, album := range notDeleted {
-			log.Printf("Empty album %v (%v) deletion FAILED\n", album.AlbumName, album.AlbumId)
-		}
-		log.Printf("Album listed: %v\n", len(albums))
-		if err != nil {
-			log.Printf("Can't list albums: %v\n", err)
-		}
+	if err == nil && deleteEmptyAlbums {
+		err = cleanEmptyAlbums(credentials)
+	}
+	if err != nil {
+		log.Println(err)
+		return exitFailure
 	}
 
-	// Create Album first to get albumId
-	if albumName != "" {
-		albumId, err = api.CreateAlbum(credentials, albumName)
-		if err != nil {
-			log.Fatalf("Can't create album: %v\n", err)
-		}
-		log.Printf("New album with ID '%v' created\n", albumId)
+	album, err := resolveUploadAlbum(credentials)
+	if err != nil {
+		log.Println(err)
+		return exitFailure
 	}
 
 	// Set album sort kind
 	if albumSortKind != 0 {
-		err = api.AlbumSortMediaItems(credentials, albumId, albumSortKind)
+		albumId, err := albumIdOf(credentials, album)
+		if err == nil {
+			err = api.AlbumSortMediaItems(credentials, albumId, albumSortKind)
+		}
 		if err != nil {
-			log.Fatalf("Can't set album sort kind %v: %v\n", albumSortKind, err)
+			log.Printf("Can't set album sort kind %v: %v\n", albumSortKind, err)
+			return exitFailure
 		}
 		log.Printf("Album sort kind set to %v\n", albumSortKind)
 	}
 
 	// Share Album with a Google user
 	if shareWithUser != "" {
-		if len(albumId) == 44 {
-			sharedAlbumId, err = api.AlbumShareWithUser(credentials, albumId, shareWithUser)
+		if album.IsShared() {
+			err = api.AlbumShareAddUser(credentials, album.SharedAlbumId, shareWithUser)
 			if err != nil {
-				log.Fatalf("Can't share album: %v\n", err)
+				log.Printf("Can't add user to shared album: %v\n", err)
+				return exitFailure
 			}
-			log.Printf("Sharing album '%v' with user '%v' as '%v'\n", albumId, shareWithUser, sharedAlbumId)
-		} else if len(albumId) == 70 {
-			err = api.AlbumShareAddUser(credentials, albumId, shareWithUser)
+			log.Printf("User '%v' added to shared album '%v'\n", shareWithUser, album)
+		} else if album.AlbumId != "" {
+			sharedAlbumId, err := api.AlbumShareWithUser(credentials, album.AlbumId, shareWithUser)
 			if err != nil {
-				log.Fatalf("Can't add user to shared album: %v\n", err)
+				log.Printf("Can't share album: %v\n", err)
+				return exitFailure
 			}
-			log.Printf("User '%v' added to shared album '%v'\n", shareWithUser, albumId)
+			log.Printf("Sharing album '%v' with user '%v' as '%v'\n", album, shareWithUser, sharedAlbumId)
 		} else {
-			log.Fatalf("Album Id length unrecognized: %v\n", albumId)
+			log.Printf("Can't share album: no album\n")
+			return exitFailure
 		}
 	}
 
-	uploader, err = utils.NewUploader(credentials, albumId, maxConcurrentUploads)
-	if err != nil {
-		log.Fatalf("Can't create uploader: %v\n", err)
-	}
-
-	stopHandler := make(chan bool)
-	go handleUploaderEvents(stopHandler)
-
-	loadAlreadyUploadedFiles()
-
-	// Upload files passed as arguments
-	uploadArgumentsFiles()
-
-	// Wait until all the uploads are completed
-	uploader.WaitUploadsCompleted()
-
-	// Start to watch all the directories if needed
-	if len(directoriesToWatch) > 0 {
-		watcher, err := fsnotify.NewWatcher()
-		if err != nil {
-			panic(err)
-		}
-		defer func(watcher *fsnotify.Watcher) {
-			_ = watcher.Close()
-		}(watcher)
-		go handleFileSystemEvents(watcher, stopHandler)
-
-		// Add all the directories passed as argument to the watcher
-		for _, name := range directoriesToWatch {
-			if err := startToWatch(name, watcher); err != nil {
-				panic(err)
-			}
-		}
-
-		log.Println("Watching 👀\nPress CTRL + C to stop")
-
-		// Wait for CTRL + C
-		c := make(chan os.Signal, 2)
-		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-		<-c
+	if len(filesToUpload) > 0 || len(directoriesToWatch) > 0 {
+		return runUploads(credentials, album)
 	}
-
-	stopHandler <- true
-	<-stopHandler
-	stopHandler <- true
-	<-stopHandler
-
-	log.Printf("Done (%v files uploaded, %v files ignored, %v errors)", uploadedFilesCount, ignoredCount, errorsCount)
-	os.Exit(0)
+	log.Printf("Done\n")
+	return exitOK
 }
 
-// Parse CLI arguments
-func parseCliArguments() {
-	flag.StringVar(&authFile, "auth", "auth.json", "Authentication json file")
-	flag.BoolVar(&queryStorage, "queryStorage", false, "Query storage (used/left)")
-	flag.BoolVar(&deleteUnsupported, "deleteUnsupported", false, "Delete unsupported media items")
-	flag.Int64Var(&deleteBefore, "deleteBefore", noDeleteBefore, "Use this parameter to delete existing media items created before this date (Unix timestamp in ms)")
-	flag.BoolVar(&emptyTrash, "emptyTrash", false, "Empty trash")
-	flag.BoolVar(&deleteEmptyAlbums, "deleteEmptyAlbums", false, "Delete empty albums")
-	flag.Var(&filesToUpload, "upload", "File or directory to upload")
-	flag.StringVar(&albumId, "album", "", "Use this parameter to move new images to a specific album")
-	flag.StringVar(&albumName, "albumName", "", "Use this parameter to move new images to a new album")
-	flag.IntVar(&albumSortKind, "albumSortKind", 0, "Use this parameter to set sort kind of the album (1: Newest first, 2: Oldest first, 3: Last added first)")
-	flag.StringVar(&shareWithUser, "shareWithUser", "", "Use this parameter to share a specific album with a Google userId or userEmail")
-	flag.StringVar(&uploadedListFile, "uploadedList", "uploaded.txt", "List to already uploaded files")
-	flag.IntVar(&maxConcurrentUploads, "maxConcurrent", 1, "Number of max concurrent uploads")
-	flag.Var(&directoriesToWatch, "watch", "Directory to watch")
-	flag.BoolVar(&watchRecursively, "watchRecursively", true, "Start watching new directories in currently watched directories")
-	delay := flag.Int("eventDelay", 3, "Distance of time to wait to consume different events of the same file (seconds)")
-	flag.BoolVar(&api.LogRequests, "debug", false, "Log Google requests and responses")
-	flag.BoolVar(&printVersion, "version", false, "Print version and commit date")
-
-	flag.Parse()
-
-	// Check flags
-	if deleteBefore > time.Now().UnixNano()/1000000 {
-		log.Fatalf("Invalid delteBefore date (after now)\n")
-	}
-	if albumId != "" && albumName != "" {
-		log.Fatalf("Can't use album and albumName at the same time\n")
-	}
-
-	// Convert delay as int into duration
-	eventDelay = time.Duration(*delay) * time.Second
+func initAuthentication() auth.CookieCredentials {
+	return authenticate(authFile)
 }
 
-func initAuthentication() auth.CookieCredentials {
+// Load the credentials of an auth store, running the wizard if they are not valid, and get an At token. It exits if
+// there are no valid credentials
+func authenticate(storeUri string) auth.CookieCredentials {
 	// Load authentication parameters
-	credentials, err := auth.NewCookieCredentialsFromFile(authFile)
+	store, err := auth.OpenStore(storeUri)
 	if err != nil {
-		log.Printf("Can't use '%v' as auth file\n", authFile)
+		exitWithAuthError("Can't use '%v' as auth store (%v)\n", storeUri, err)
+	}
+	credentials, err := store.Load()
+	if err != nil {
+		log.Printf("Can't use '%v' as auth file\n", store)
 		credentials = nil
 	} else {
 		log.Println("Auth file loaded, checking validity ...")
 		validity, err := credentials.CheckCredentials()
 		if err != nil {
-			log.Fatalf("Can't check validity of credentials (%v)\n", err)
+			exitWithAuthError("Can't check validity of credentials (%v)\n", err)
 		} else if !validity.Valid {
 			log.Printf("Credentials are not valid! %v\n", validity.Reason)
 			credentials = nil
@@ -308,89 +319,225 @@ func initAuthentication() auth.CookieCredentials {
 			log.Println("Auth file seems to be valid")
 
 			// Try to update auth file
-			err = credentials.SerializeToFile(authFile)
+			err = store.Save(credentials)
 			if err != nil {
-				log.Printf("Can't update auth file %v: %v\n", authFile, err)
+				log.Printf("Can't update auth file %v: %v\n", store, err)
 			}
 		}
 	}
 
+	if credentials == nil && daemonMode && !webDriverOptions().Scripted() {
+		exitWithAuthError("The uploader can't continue without valid authentication tokens, use 'gphotosuploader auth login'\n")
+	}
 	if credentials == nil {
 		fmt.Println("The uploader can't continue without valid authentication tokens ...")
-		fmt.Println("Would you like to run the WebDriver CookieCredentials Wizard ? [Yes/No]")
-		fmt.Println("(If you don't know what it is, refer to the README)")
 
-		var answer string
-		_, _ = fmt.Scanln(&answer)
-		startWizard := len(answer) > 0 && strings.ToLower(answer)[0] == 'y'
+		// Don't ask when the wizard has been configured
+		startWizard := webDriverOptions().Scripted()
+		if !startWizard {
+			fmt.Println("Would you like to run the WebDriver CookieCredentials Wizard ? [Yes/No]")
+			fmt.Println("(If you don't know what it is, refer to the README)")
+
+			var answer string
+			_, _ = fmt.Scanln(&answer)
+			startWizard = len(answer) > 0 && strings.ToLower(answer)[0] == 'y'
+		}
 
 		if !startWizard {
-			log.Fatalln("It's not possible to continue, sorry!")
+			exitWithAuthError("It's not possible to continue, sorry!\n")
 		} else {
-			credentials, err = utils.StartWebDriverCookieCredentialsWizard()
+			credentials, err = utils.StartWebDriverCookieCredentialsWizard(webDriverOptions())
 			if err != nil {
-				log.Fatalf("Can't complete the login wizard, got: %v\n", err)
+				exitWithAuthError("Can't complete the login wizard, got: %v\n", err)
 			} else {
 				// Write auth file
-				err = credentials.SerializeToFile(authFile)
+				err = store.Save(credentials)
 				if err != nil {
-					log.Fatalf("Can't write auth file %v: %v\n", authFile, err)
+					exitWithAuthError("Can't write auth file %v: %v\n", store, err)
 				}
 			}
 		}
 	}
 
-	// Get a new At token
+	// Get a new At token. It is scraped again, and the refreshed cookies are saved, when Google refuses it
+	registerStore(*credentials, store)
+	api.OnAtTokenRefreshed = onAtTokenRefreshed
 	log.Println("Getting a new At token ...")
-	token, err := api.NewAtTokenScraper(*credentials).ScrapeNewAtToken()
-	if err != nil {
-		log.Fatalf("Can't scrape a new At token (%v)\n", err)
+	if err := api.RefreshAtToken(*credentials); err != nil {
+		exitWithAuthError("Can't get a new At token (%v)\n", err)
 	}
-	credentials.RuntimeParameters.AtToken = token
 	log.Println("At token taken")
 
 	return *credentials
 }
 
-// Upload all the file and directories passed as arguments, calling filepath.Walk on each name
-func uploadArgumentsFiles() {
+// Save the cookies refreshed with the At token in the auth file of the credentials
+func onAtTokenRefreshed(credentials auth.CookieCredentials) {
+	tokenRefreshCount.Add(1)
+	store := storeOf(credentials)
+	if store == nil {
+		return
+	}
+	if err := store.Save(&credentials); err != nil {
+		log.Printf("Can't update auth file %v: %v\n", store, err)
+	}
+}
+
+// Scrape a new At token from time to time, until the stop channel is closed, to keep the session alive
+func startTokenRefresh(credentials auth.CookieCredentials, interval time.Duration, stop chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := api.RefreshAtToken(credentials); err != nil {
+					log.Printf("Can't refresh the At token: %v\n", err)
+				} else {
+					log.Println("At token refreshed")
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Upload the files missed by the watcher at each interval, until the stop channel is closed
+func startRescans(interval time.Duration, stop chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				rescanWatchedDirectories()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Log the authentication error and exit with the exitAuth code
+func exitWithAuthError(format string, v ...interface{}) {
+	log.Printf(format, v...)
+	os.Exit(exitAuth)
+}
+
+// Total size of the files passed as arguments that have not been uploaded yet, by account
+func sizeOfArgumentsFiles() map[*account]int64 {
+	sizes := make(map[*account]int64)
 	for _, name := range filesToUpload {
-		_ = filepath.Walk(name, func(path string, file os.FileInfo, err error) error {
-			if !file.IsDir() {
-				_ = uploader.EnqueueUpload(path)
+		_ = filterOf(name).Walk(name, func(path string, file os.FileInfo) {
+			if owner := accountOf(path); !owner.uploader.WasFileUploaded(path) {
+				sizes[owner] += file.Size()
 			}
+		})
+	}
+	return sizes
+}
+
+// Upload all the file and directories passed as arguments, walking each name with the file filter
+func uploadArgumentsFiles() {
+	for _, name := range filesToUpload {
+		_ = filterOf(name).Walk(name, func(path string, file os.FileInfo) {
+			_ = accountOf(path).uploader.EnqueueUpload(path)
+		})
+	}
+}
+
+// Copy of the watched directories, which can be extended by reloading the configuration while iterating
+func watchedDirectories() []string {
+	filtersMutex.RLock()
+	defer filtersMutex.RUnlock()
+	return append([]string{}, directoriesToWatch...)
+}
 
-			return nil
+// Upload the files of the watched directories that have not been uploaded or queued yet, until the uploads are
+// stopping
+func rescanWatchedDirectories() {
+	for _, name := range watchedDirectories() {
+		_ = filterOf(name).Walk(name, func(path string, file os.FileInfo) {
+			if shuttingDown.Load() {
+				return
+			}
+			if owner := accountOf(path); !owner.uploader.WasFileUploaded(path) && !owner.uploader.IsFileQueued(path) {
+				_ = owner.uploader.EnqueueUpload(path)
+			}
 		})
 	}
 }
 
-func handleUploaderEvents(exiting chan bool) {
+func handleUploaderEvents(acc *account, exiting chan bool) {
+	uploader := acc.uploader
 	for {
 		select {
 		case info := <-uploader.CompletedUploads:
+			statusMutex.Lock()
 			uploadedFilesCount++
-			log.Printf("Upload of '%v' completed\n", info)
+			uploadedBytes += info.Bytes
+			lastUploadTime = time.Now()
+			recentUploads = appendRecent(recentUploads, uploadedEvent(info))
+			statusMutex.Unlock()
+			log.Printf("Upload of '%v' completed%v\n", info.Path, acc.logSuffix())
+			emitUploaded(info)
 
 			// Update the upload completed file
-			if file, err := os.OpenFile(uploadedListFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666); err != nil {
+			if file, err := os.OpenFile(acc.UploadedList, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666); err != nil {
 				log.Println("Can't update the uploaded file list")
 			} else {
-				_, _ = file.WriteString(info + "\n")
+				_, _ = file.WriteString(info.Path + "\n")
 				_ = file.Close()
 			}
 
 		case info := <-uploader.IgnoredUploads:
+			statusMutex.Lock()
 			ignoredCount++
-			log.Printf("Not uploading '%v', it's already been uploaded or it's not a image/video!\n", info)
+			ignoredByReason[info.Reason]++
+			statusMutex.Unlock()
+			log.Printf("Not uploading '%v' (%v)\n", info.Path, info.Reason)
+			emitIgnored(info)
 
 		case err := <-uploader.Errors:
-			log.Printf("Upload error: %v\n", err)
+			var uploadErr *utils.UploadError
+			isUploadErr := errors.As(err, &uploadErr)
+			if isUploadErr && uploadErr.Class == utils.ErrorStopped && shuttingDown.Load() {
+				log.Printf("Not uploading '%v' (stopping)\n", uploadErr.Path)
+				continue
+			}
+			log.Printf("Upload error%v: %v\n", acc.logSuffix(), err)
+			emitError(err)
+
+			statusMutex.Lock()
 			errorsCount++
+			recentErrors = appendRecent(recentErrors, errorEvent(err))
+			if isUploadErr {
+				errorsByClass[uploadErr.Class]++
+				failedFiles = append(failedFiles, uploadErr.Path)
+				quotaExhausted = quotaExhausted || uploadErr.Class == utils.ErrorQuota
+				authRefused = authRefused || uploadErr.Class == utils.ErrorAuth
+			}
+			statusMutex.Unlock()
+			if failOnError {
+				for _, other := range accounts {
+					other.uploader.StopUploads()
+				}
+				select {
+				case failed <- err:
+				default:
+				}
+			}
+
+		case status := <-uploader.QuotaExceeded:
+			log.Printf("Storage quota exhausted%v: %v\n", acc.logSuffix(), status)
+			statusMutex.Lock()
+			quotaExhausted = true
+			statusMutex.Unlock()
 
 		case <-exiting:
 			exiting <- true
-			break
+			return
 		}
 	}
 }
@@ -398,10 +545,13 @@ func handleUploaderEvents(exiting chan bool) {
 func startToWatch(filePath string, fsWatcher *fsnotify.Watcher) error {
 	if watchRecursively {
 		return filepath.Walk(filePath, func(path string, file os.FileInfo, err error) error {
-			if file.IsDir() {
-				return fsWatcher.Add(path)
+			if err != nil || !file.IsDir() {
+				return nil
 			}
-			return nil
+			if !filterOf(path).AcceptsDir(path) {
+				return filepath.SkipDir
+			}
+			return fsWatcher.Add(path)
 		})
 	} else {
 		return fsWatcher.Add(filePath)
@@ -424,12 +574,17 @@ func handleFileChange(event fsnotify.Event, fsWatcher *fsnotify.Watcher) {
 		timer = time.AfterFunc(eventDelay, func() {
 			log.Printf("Finally consuming events for the %v file", event.Name)
 
-			if info, err := os.Stat(event.Name); err != nil {
+			if filepath.Base(event.Name) == utils.IgnoreFileName {
+				// Read the changed ignore file again
+				filterOf(event.Name).Forget(filepath.Dir(event.Name))
+			} else if info, err := os.Stat(event.Name); err != nil {
 				log.Println(err)
 			} else if !info.IsDir() {
 				// Upload file
-				_ = uploader.EnqueueUpload(event.Name)
-			} else if watchRecursively {
+				if filterOf(event.Name).Accepts(event.Name, info) {
+					_ = accountOf(event.Name).uploader.EnqueueUpload(event.Name)
+				}
+			} else if watchRecursively && filterOf(event.Name).AcceptsDir(event.Name) {
 				_ = startToWatch(event.Name, fsWatcher)
 			}
 		})
@@ -453,8 +608,8 @@ func handleFileSystemEvents(fsWatcher *fsnotify.Watcher, exiting chan bool) {
 	}
 }
 
-func loadAlreadyUploadedFiles() {
-	file, err := os.OpenFile(uploadedListFile, os.O_CREATE, 0666)
+func loadAlreadyUploadedFiles(acc *account) {
+	file, err := os.OpenFile(acc.UploadedList, os.O_CREATE, 0666)
 	if err != nil {
 		panic(err)
 	}
@@ -464,6 +619,6 @@ func loadAlreadyUploadedFiles() {
 
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
-		uploader.AddUploadedFiles(scanner.Text())
+		acc.uploader.AddUploadedFiles(scanner.Text())
 	}
 }
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/GaPhi/gphotosuploader/api"
+)
+
+// Upper bounds of the buckets of the upload step durations, in seconds
+var stepBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+var (
+	// Address of the Prometheus metrics server, empty to disable it. The metrics are also served by the control server
+	metricsAddress string
+
+	// Durations of the upload steps, by step
+	stepsMutex     sync.Mutex
+	stepHistograms = make(map[string]*histogram)
+)
+
+// Cumulative histogram, as exported to Prometheus
+type histogram struct {
+	counts []int64
+	count  int64
+	sum    float64
+}
+
+func (h *histogram) observe(value float64) {
+	if h.counts == nil {
+		h.counts = make([]int64, len(stepBuckets))
+	}
+	for i, bound := range stepBuckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+// Record the durations of the upload steps
+func initMetrics() {
+	api.ObserveUploadStep = func(step string, duration time.Duration) {
+		stepsMutex.Lock()
+		defer stepsMutex.Unlock()
+		h, found := stepHistograms[step]
+		if !found {
+			h = &histogram{}
+			stepHistograms[step] = h
+		}
+		h.observe(duration.Seconds())
+	}
+}
+
+// Start the metrics server on the metricsAddress. Unlike the control server it can listen on any interface, since it
+// is read-only
+func startMetricsServer() (*http.Server, error) {
+	listener, err := listen(metricsAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", getOnly(handleMetrics))
+	server := &http.Server{Handler: mux}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("Metrics server stopped: %v\n", err)
+		}
+	}()
+	log.Printf("Metrics server listening on %v\n", metricsAddress)
+	return server, nil
+}
+
+// Write the metrics in the Prometheus text format
+func handleMetrics(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writeMetrics(w)
+}
+
+func writeMetrics(w io.Writer) {
+	metric := func(name string, kind string, help string) {
+		fmt.Fprintf(w, "# HELP gphotosuploader_%v %v\n# TYPE gphotosuploader_%v %v\n", name, help, name, kind)
+	}
+
+	statusMutex.Lock()
+	metric("files_uploaded_total", "counter", "Files uploaded.")
+	fmt.Fprintf(w, "gphotosuploader_files_uploaded_total %v\n", uploadedFilesCount)
+	metric("files_ignored_total", "counter", "Files not uploaded, by reason.")
+	for _, reason := range sortedKeys(ignoredByReason) {
+		fmt.Fprintf(w, "gphotosuploader_files_ignored_total{reason=%q} %v\n", reason, ignoredByReason[reason])
+	}
+	metric("files_errors_total", "counter", "Upload errors, by class.")
+	for _, class := range sortedKeys(errorsByClass) {
+		fmt.Fprintf(w, "gphotosuploader_files_errors_total{class=%q} %v\n", class, errorsByClass[class])
+	}
+	metric("bytes_uploaded_total", "counter", "Bytes uploaded, after compression.")
+	fmt.Fprintf(w, "gphotosuploader_bytes_uploaded_total %v\n", uploadedBytes)
+	metric("retries_total", "counter", "Failed uploads attempted again.")
+	fmt.Fprintf(w, "gphotosuploader_retries_total %v\n", retriesCount)
+	metric("last_upload_timestamp_seconds", "gauge", "Unix time of the last successful upload, 0 if none.")
+	if lastUploadTime.IsZero() {
+		fmt.Fprintln(w, "gphotosuploader_last_upload_timestamp_seconds 0")
+	} else {
+		fmt.Fprintf(w, "gphotosuploader_last_upload_timestamp_seconds %v\n", lastUploadTime.Unix())
+	}
+	statusMutex.Unlock()
+
+	metric("token_refreshes_total", "counter", "At tokens obtained.")
+	fmt.Fprintf(w, "gphotosuploader_token_refreshes_total %v\n", tokenRefreshCount.Load())
+
+	// Gauges of the uploader of each account
+	if len(accounts) > 0 {
+		metric("queue_depth", "gauge", "Uploads waiting for their turn.")
+		for _, acc := range accounts {
+			fmt.Fprintf(w, "gphotosuploader_queue_depth{account=%q} %v\n", acc.Name, len(acc.uploader.QueuedUploads()))
+		}
+		metric("uploads_in_flight", "gauge", "Started uploads.")
+		for _, acc := range accounts {
+			fmt.Fprintf(w, "gphotosuploader_uploads_in_flight{account=%q} %v\n", acc.Name, len(acc.uploader.InFlightUploads()))
+		}
+		metric("storage_used_bytes", "gauge", "Storage used, as last known.")
+		for _, acc := range accounts {
+			if used, total := acc.uploader.Storage(); total > 0 {
+				fmt.Fprintf(w, "gphotosuploader_storage_used_bytes{account=%q} %v\n", acc.Name, used)
+			}
+		}
+		metric("storage_total_bytes", "gauge", "Total storage, as last known.")
+		for _, acc := range accounts {
+			if _, total := acc.uploader.Storage(); total > 0 {
+				fmt.Fprintf(w, "gphotosuploader_storage_total_bytes{account=%q} %v\n", acc.Name, total)
+			}
+		}
+	}
+
+	stepsMutex.Lock()
+	defer stepsMutex.Unlock()
+	metric("upload_step_duration_seconds", "histogram", "Duration of the upload steps, by step.")
+	for _, step := range sortedKeys(stepHistograms) {
+		h := stepHistograms[step]
+		for i, bound := range stepBuckets {
+			fmt.Fprintf(w, "gphotosuploader_upload_step_duration_seconds_bucket{step=%q,le=\"%v\"} %v\n", step, bound, h.counts[i])
+		}
+		fmt.Fprintf(w, "gphotosuploader_upload_step_duration_seconds_bucket{step=%q,le=\"+Inf\"} %v\n", step, h.count)
+		fmt.Fprintf(w, "gphotosuploader_upload_step_duration_seconds_sum{step=%q} %v\n", step, h.sum)
+		fmt.Fprintf(w, "gphotosuploader_upload_step_duration_seconds_count{step=%q} %v\n", step, h.count)
+	}
+}
+
+func sortedKeys[K ~string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i] < keys[j]
+	})
+	return keys
+}
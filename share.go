@@ -0,0 +1,163 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/GaPhi/gphotosuploader/api"
+	"github.com/GaPhi/gphotosuploader/auth"
+)
+
+const shareUsage = `Usage: gphotosuploader share <command> [arguments]
+
+Commands:
+  list -album ID                         List the members of a shared album
+  add -album ID -user USER               Share an album with a Google userId or userEmail
+  remove -album ID -user USERID          Remove a member from a shared album
+  link -album ID [-collaborate=BOOL] [-comments=BOOL]
+                                         Create a shareable link, and set the options given
+  unlink -album ID                       Revoke the shareable link
+  options -album ID [-collaborate=BOOL] [-comments=BOOL]
+                                         Set the collaboration and/or comments options
+  leave -album ID                        Leave an album shared by someone else
+`
+
+// Run the share subcommand, returning the exit code
+func runShareCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, shareUsage)
+		return exitUsage
+	}
+
+	flags := flag.NewFlagSet("share "+args[0], flag.ExitOnError)
+	flags.StringVar(&authFile, "auth", "auth.json", authUsageText)
+	flags.BoolVar(&api.LogRequests, "debug", false, "Log Google requests and responses")
+	albumArg := flags.String("album", "", "Album id, shared album id or URL")
+	user := flags.String("user", "", "Google userId or userEmail")
+	collaborate := flags.Bool("collaborate", false, "Let members add their own photos and videos")
+	comments := flags.Bool("comments", false, "Let members comment and like")
+	_ = flags.Parse(args[1:])
+
+	// The options not given are left unchanged
+	given := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	// Check arguments before authenticating
+	switch args[0] {
+	case "list", "link", "unlink", "leave":
+	case "options":
+		if !given["collaborate"] && !given["comments"] {
+			log.Println("Missing collaborate or comments")
+			return exitUsage
+		}
+	case "add", "remove":
+		if *user == "" {
+			log.Println("Missing user")
+			return exitUsage
+		}
+	default:
+		fmt.Fprint(os.Stderr, shareUsage)
+		return exitUsage
+	}
+	album, err := api.ResolveAlbumRef(*albumArg)
+	if err != nil {
+		log.Println(err)
+		return exitUsage
+	}
+
+	credentials := initAuthentication()
+
+	// Most commands need the shared album id
+	var sharedAlbumId api.SharedAlbumID
+	switch args[0] {
+	case "list", "remove", "unlink", "options":
+		sharedAlbumId, err = sharedAlbumIdOf(credentials, album)
+		if err != nil {
+			log.Println(err)
+			return exitFailure
+		}
+	}
+
+	switch args[0] {
+	case "list":
+		var members []api.AlbumMember
+		members, err = api.ListSharedAlbumMembers(credentials, sharedAlbumId)
+		for _, member := range members {
+			owner := ""
+			if member.Owner {
+				owner = "owner"
+			}
+			fmt.Printf("%v\t%v\t%v\n", member.UserId, member.Name, owner)
+		}
+	case "add":
+		if album.IsShared() {
+			err = api.AlbumShareAddUser(credentials, album.SharedAlbumId, *user)
+		} else {
+			sharedAlbumId, err = api.AlbumShareWithUser(credentials, album.AlbumId, *user)
+			if err == nil {
+				log.Printf("Album '%v' shared as '%v'\n", album, sharedAlbumId)
+			}
+		}
+	case "remove":
+		err = api.AlbumShareRemoveUser(credentials, sharedAlbumId, *user)
+	case "link":
+		if album.IsShared() {
+			log.Println("A shareable link can only be created with the album id, not the shared album id")
+			return exitUsage
+		}
+		var link string
+		sharedAlbumId, link, err = api.CreateAlbumShareLink(credentials, album.AlbumId)
+		if err == nil {
+			log.Printf("Album '%v' shared as '%v'\n", album, sharedAlbumId)
+			fmt.Println(link)
+			if given["collaborate"] || given["comments"] {
+				err = setSharingOptions(credentials, sharedAlbumId, given, *collaborate, *comments)
+			}
+		}
+	case "unlink":
+		err = api.RevokeAlbumShareLink(credentials, sharedAlbumId)
+	case "options":
+		err = setSharingOptions(credentials, sharedAlbumId, given, *collaborate, *comments)
+	case "leave":
+		if !album.IsShared() {
+			log.Println("Only an album shared by someone else can be left, use its shared album id")
+			return exitUsage
+		}
+		err = api.LeaveSharedAlbum(credentials, album.SharedAlbumId)
+	}
+	if err != nil {
+		log.Printf("Can't %v: %v\n", args[0], err)
+		return exitFailure
+	}
+	if args[0] != "list" && args[0] != "link" {
+		log.Printf("Album '%v': %v done\n", album, args[0])
+	}
+	return exitOK
+}
+
+// Set the collaboration and/or comments options of a shared album, depending on the arguments given
+func setSharingOptions(credentials auth.CookieCredentials, sharedAlbumId api.SharedAlbumID, given map[string]bool, collaborate bool, comments bool) error {
+	switch {
+	case given["collaborate"] && given["comments"]:
+		return api.SetAlbumSharingOptions(credentials, sharedAlbumId, api.AlbumSharingOptions{
+			Collaborate: collaborate,
+			Comments:    comments,
+		})
+	case given["collaborate"]:
+		return api.SetAlbumCollaboration(credentials, sharedAlbumId, collaborate)
+	default:
+		return api.SetAlbumComments(credentials, sharedAlbumId, comments)
+	}
+}
+
+// Get the shared album id of an album, looking for it if the album is referenced by its album id
+func sharedAlbumIdOf(credentials auth.CookieCredentials, album api.AlbumRef) (api.SharedAlbumID, error) {
+	if album.IsShared() {
+		return album.SharedAlbumId, nil
+	}
+	return api.FindSharedAlbumId(credentials, album.AlbumId)
+}
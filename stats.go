@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/GaPhi/gphotosuploader/api"
+	"github.com/GaPhi/gphotosuploader/utils"
+)
+
+// Run the stats subcommand, returning the exit code
+func runStatsCommand(args []string) int {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	flags.StringVar(&authFile, "auth", "auth.json", authUsageText)
+	flags.BoolVar(&api.LogRequests, "debug", false, "Log Google requests and responses")
+	format := flags.String("format", "text", "Output format (text or json)")
+	monthly := flags.Bool("monthly", false, "Show media items by month instead of by year")
+	_ = flags.Parse(args)
+
+	if *format != "text" && *format != "json" {
+		log.Printf("Unknown format '%v'\n", *format)
+		return exitUsage
+	}
+
+	credentials := initAuthentication()
+
+	log.Println("Computing library statistics, it can take a while...")
+	stats, err := utils.GetLibraryStats(credentials)
+	if err != nil {
+		log.Printf("Can't get library statistics: %v\n", err)
+		return exitFailure
+	}
+
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		_ = encoder.Encode(stats)
+		return exitOK
+	}
+
+	fmt.Printf("Storage:      %v / %v (%v%%)\n", formatBytes(stats.StorageUsed), formatBytes(stats.StorageTotal), percent(stats.StorageUsed, stats.StorageTotal))
+	fmt.Printf("Media items:  %v\n", stats.MediaItems)
+	fmt.Printf("Photos:       %v\n", stats.Photos)
+	fmt.Printf("Videos:       %v\n", stats.Videos)
+	fmt.Printf("Unsupported:  %v\n", stats.Unsupported)
+	fmt.Println()
+
+	periods := stats.Years
+	if *monthly {
+		periods = stats.Months
+	}
+	fmt.Printf("%-10v %12v %12v\n", "Period", "Media items", "Total")
+	for _, period := range periods {
+		fmt.Printf("%-10v %12v %12v\n", period.Period, period.MediaItems, period.Total)
+	}
+	return exitOK
+}
+
+// Format a number of bytes with a binary unit
+func formatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%v B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+func percent(part int64, total int64) int64 {
+	if total <= 0 {
+		return 0
+	}
+	return 100 * part / total
+}
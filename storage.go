@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/GaPhi/gphotosuploader/api"
+)
+
+// Run the storage subcommand, returning the exit code
+func runStorageCommand(args []string) int {
+	flags := flag.NewFlagSet("storage", flag.ExitOnError)
+	flags.StringVar(&authFile, "auth", "auth.json", authUsageText)
+	flags.BoolVar(&api.LogRequests, "debug", false, "Log Google requests and responses")
+	_ = flags.Parse(args)
+
+	credentials := initAuthentication()
+
+	used, total, err := api.QueryStorage(credentials)
+	if err != nil {
+		log.Printf("Can't get storage data: %v\n", err)
+		return exitFailure
+	}
+	fmt.Printf("Used:   %v (%v%%)\n", formatBytes(used), percent(used, total))
+	fmt.Printf("Left:   %v\n", formatBytes(total-used))
+	fmt.Printf("Total:  %v\n", formatBytes(total))
+	return exitOK
+}
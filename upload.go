@@ -0,0 +1,449 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/GaPhi/gphotosuploader/api"
+	"github.com/GaPhi/gphotosuploader/auth"
+	"github.com/GaPhi/gphotosuploader/utils"
+	"github.com/fsnotify/fsnotify"
+)
+
+// Files and directories used by a command: the uploaded files, the watched directories, or both
+type uploadMode int
+
+const (
+	uploadFiles uploadMode = 1 << iota
+	watchDirectories
+)
+
+// Run the upload subcommand, returning the exit code
+func runUploadCommand(args []string) int {
+	flags := flag.NewFlagSet("upload", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: gphotosuploader upload [arguments] FILE_OR_DIRECTORY...")
+		flags.PrintDefaults()
+	}
+	checkArguments := addUploadFlags(flags, uploadFiles)
+	_ = flags.Parse(args)
+
+	for _, name := range flags.Args() {
+		if err := filesToUpload.Set(name); err != nil {
+			log.Println(err)
+			return exitUsage
+		}
+	}
+	if err := checkArguments(); err != nil {
+		log.Println(err)
+		return exitUsage
+	}
+	if len(filesToUpload) == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	credentials := initAuthentication()
+	album, err := resolveUploadAlbum(credentials)
+	if err != nil {
+		log.Println(err)
+		return exitFailure
+	}
+	return runUploads(credentials, album)
+}
+
+// Run the watch subcommand, returning the exit code
+func runWatchCommand(args []string) int {
+	flags := flag.NewFlagSet("watch", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: gphotosuploader watch [arguments] DIRECTORY...")
+		flags.PrintDefaults()
+	}
+	checkArguments := addUploadFlags(flags, watchDirectories)
+	_ = flags.Parse(args)
+
+	for _, name := range flags.Args() {
+		if err := directoriesToWatch.Set(name); err != nil {
+			log.Println(err)
+			return exitUsage
+		}
+	}
+	if err := checkArguments(); err != nil {
+		log.Println(err)
+		return exitUsage
+	}
+	if len(directoriesToWatch) == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	credentials := initAuthentication()
+	album, err := resolveUploadAlbum(credentials)
+	if err != nil {
+		log.Println(err)
+		return exitFailure
+	}
+	return runUploads(credentials, album)
+}
+
+// Register the arguments of the commands that upload files on the flag set. The returned function must be called once
+// the arguments are parsed: it reads the configuration file and checks the arguments
+func addUploadFlags(flags *flag.FlagSet, mode uploadMode) func() error {
+	flags.StringVar(&authFile, "auth", "auth.json", authUsageText)
+	addLoginFlags(flags)
+	flags.StringVar(&albumId, "album", "", "Use this parameter to move new images to a specific album (album id, shared album id or URL)")
+	flags.StringVar(&albumName, "albumName", "", "Use this parameter to move new images to a new album")
+	flags.Var(&albumRules, "albumRule", "Use this parameter to move new images to albums named after their directory (directory=template, template placeholders: {dir}, {path}, {root}, {1}, {2}, ...)")
+	flags.StringVar(&albumCacheFile, "albumCache", "albums.json", "List of albums created by album rules")
+	flags.StringVar(&uploadedListFile, "uploadedList", "uploaded.txt", "List to already uploaded files")
+	flags.Var(&accountConfigs, "account", "Use this parameter to upload the files of some directories with another Google account (name=NAME,auth=STORE,dir=DIR1|DIR2, optional: uploadedList=FILE,albumCache=FILE,maxConcurrent=N)")
+	flags.IntVar(&maxConcurrentUploads, "maxConcurrent", 1, "Number of max concurrent uploads")
+	flags.Var(&compressionRules, "compress", "Use this parameter to compress JPEG and PNG files before uploading them (ext=jpg|png,minSize=2M,quality=85,maxDim=4096)")
+	flags.Var(&includedExtensions, "includeExt", "Extensions of the files to upload even if they don't look like photos or videos (comma separated)")
+	flags.Var(&excludedExtensions, "excludeExt", "Extensions of the files to never upload (comma separated)")
+	flags.StringVar(&logFile, "logFile", "", "Also write the logs to this file")
+	flags.Var(&includePatterns, "include", "Gitignore-style pattern of the files to upload (all the files if not set)")
+	flags.Var(&excludePatterns, "exclude", "Gitignore-style pattern of the files and directories to ignore (see also the .gphotosignore files)")
+	noDefaultExcludes := flags.Bool("noDefaultExcludes", false, "Don't ignore hidden files and directories and NAS directories (@eaDir, #recycle, #snapshot)")
+	minSize := flags.String("minSize", "", "Ignore files smaller than this size (like 10K)")
+	maxSize := flags.String("maxSize", "", "Ignore files bigger than this size (like 2G)")
+	maxAge := flags.Int("maxAge", 0, "Ignore files modified more than this number of days ago (0: no limit)")
+	timestamp := flags.String("timestamp", "exif,video,mtime", "Sources of the date of the uploaded files, by precedence (exif, video and mtime)")
+	quota := flags.String("quota", "warn", "What to do when the files to upload don't fit in the storage left (off, warn or refuse)")
+	flags.BoolVar(&api.LogRequests, "debug", false, "Log Google requests and responses")
+	flags.BoolVar(&failOnError, "failOnError", false, "Stop the uploads at the first error (the exit code is 3 when some files are not uploaded, with or without this argument)")
+	output := flags.String("output", outputText, "Format of the standard output: text, or json for one event per line")
+	configFile := flags.String("config", defaultConfigFile, "Configuration file (YAML), whose values are overridden by the CLI arguments")
+	profile := flags.String("profile", "", "Profile of the configuration file to use")
+
+	rescanMinutes, quotaMinutes, delay, shutdownSeconds, tokenMinutes := new(int), new(int), new(int), new(int), new(int)
+	if mode&watchDirectories != 0 {
+		flags.BoolVar(&watchRecursively, "watchRecursively", true, "Start watching new directories in currently watched directories")
+		rescanMinutes = flags.Int("rescanInterval", 0, "Distance of time between two scans of the watched directories, to upload the files missed while watching (minutes, 0: no scan)")
+		quotaMinutes = flags.Int("quotaInterval", 10, "Distance of time between two storage checks while watching (minutes)")
+		delay = flags.Int("eventDelay", 3, "Distance of time to wait to consume different events of the same file (seconds)")
+		flags.BoolVar(&daemonMode, "daemon", false, "Run without any prompt, notify systemd (readiness and watchdog) and reload the configuration file on SIGHUP")
+		flags.StringVar(&metricsAddress, "metrics", "", "Address of the Prometheus metrics server (like :9464), the metrics are also served by the control server")
+		flags.StringVar(&controlAddress, "control", "", "Address of the local HTTP control and status server (like localhost:7357 or unix:/run/gphotosuploader.sock)")
+		flags.StringVar(&controlToken, "controlToken", "", "Bearer token required by the control server (Authorization: Bearer TOKEN)")
+		tokenMinutes = flags.Int("tokenRefresh", 360, "Distance of time between two refreshes of the At token and of the cookies, to keep the session alive while watching (minutes, 0: only when Google refuses the token)")
+		shutdownSeconds = flags.Int("shutdownTimeout", 30, "Distance of time to wait for the started uploads to finish when stopping (seconds)")
+	}
+
+	return func() error {
+		// Use the configuration file for the arguments not given
+		configGiven := false
+		flags.Visit(func(f *flag.Flag) {
+			configGiven = configGiven || f.Name == "config"
+		})
+		configFileName, configProfile, configRequired = *configFile, *profile, configGiven
+		settings, err := loadConfig(*configFile, *profile, configGiven)
+		if err != nil {
+			return fmt.Errorf("invalid configuration: %v", err)
+		}
+		if err := applyConfig(flags, settings); err != nil {
+			return fmt.Errorf("invalid configuration: %v", err)
+		}
+		if mode&uploadFiles != 0 {
+			if err := useConfigUploads(settings); err != nil {
+				return fmt.Errorf("invalid configuration: %v", err)
+			}
+		}
+		if mode&watchDirectories != 0 {
+			if err := useConfigWatch(settings); err != nil {
+				return fmt.Errorf("invalid configuration: %v", err)
+			}
+		}
+		if err := useConfigAccounts(settings); err != nil {
+			return fmt.Errorf("invalid configuration: %v", err)
+		}
+		initLogFile(logFile)
+
+		// Check flags
+		if err := setOutputFormat(*output); err != nil {
+			return err
+		}
+		if albumId != "" && albumName != "" {
+			return fmt.Errorf("can't use album and albumName at the same time")
+		}
+
+		timestampSources, err = api.ParseTimestampSources(*timestamp)
+		if err != nil {
+			return fmt.Errorf("invalid timestamp: %v", err)
+		}
+		fileFilter = utils.NewFileFilter(!*noDefaultExcludes)
+		fileFilter.Include = includePatterns
+		fileFilter.Exclude = append(fileFilter.Exclude, excludePatterns...)
+		fileFilter.MaxAge = time.Duration(*maxAge) * 24 * time.Hour
+		if *minSize != "" {
+			if fileFilter.MinSize, err = utils.ParseSize(*minSize); err != nil {
+				return fmt.Errorf("invalid minSize: %v", err)
+			}
+		}
+		if *maxSize != "" {
+			if fileFilter.MaxSize, err = utils.ParseSize(*maxSize); err != nil {
+				return fmt.Errorf("invalid maxSize: %v", err)
+			}
+		}
+		if err := initDirectoryFilters(); err != nil {
+			return fmt.Errorf("invalid watched directory: %v", err)
+		}
+		// The patterns are relative to the files and directories passed as arguments, and to the watched directories
+		for _, name := range append(append([]string{}, filesToUpload...), directoriesToWatch...) {
+			filterOf(name).AddRoot(name)
+		}
+		quotaPolicy, err = utils.ParseQuotaPolicy(*quota)
+		if err != nil {
+			return fmt.Errorf("invalid quota: %v", err)
+		}
+
+		// Convert delay as int into duration
+		eventDelay = time.Duration(*delay) * time.Second
+		quotaInterval = time.Duration(*quotaMinutes) * time.Minute
+		rescanInterval = time.Duration(*rescanMinutes) * time.Minute
+		shutdownTimeout = time.Duration(*shutdownSeconds) * time.Second
+		tokenRefreshInterval = time.Duration(*tokenMinutes) * time.Minute
+		return nil
+	}
+}
+
+// Resolve the album passed as argument (album id, shared album id or URL), or create the album named by albumName
+func resolveUploadAlbum(credentials auth.CookieCredentials) (api.AlbumRef, error) {
+	var album api.AlbumRef
+	if albumId != "" {
+		ref, err := api.ResolveAlbumRef(albumId)
+		if err != nil {
+			return album, fmt.Errorf("can't use album: %v", err)
+		}
+		album = ref
+	}
+
+	// Create Album first to get albumId
+	if albumName != "" {
+		id, err := api.CreateAlbum(credentials, albumName)
+		if err != nil {
+			return album, fmt.Errorf("can't create album: %v", err)
+		}
+		album.AlbumId = id
+		log.Printf("New album with ID '%v' created\n", album.AlbumId)
+		emitAlbumCreated(albumName, id)
+	}
+	return album, nil
+}
+
+// Upload the files passed as arguments, then watch the directories, returning the exit code. The files of the
+// directories of the other accounts are uploaded by their own uploader
+func runUploads(credentials auth.CookieCredentials, album api.AlbumRef) int {
+	start := time.Now()
+	if err := openAccounts(credentials); err != nil {
+		log.Printf("Can't use the accounts: %v\n", err)
+		return exitUsage
+	}
+
+	// Choose the album of each uploaded file. The album argument is an album of the default account
+	uploadAlbumId, err := albumIdOf(credentials, album)
+	if err != nil {
+		log.Printf("Can't move new images to album: %v\n", err)
+		return exitFailure
+	}
+	directoryAlbums := make(map[*account]map[string]utils.AlbumResolver)
+	for _, watch := range watchSettings {
+		path, _ := filepath.Abs(watch.Path)
+		if watch.AlbumRule != "" {
+			albumRules = append(utils.AlbumRules{{Root: path, Template: watch.AlbumRule}}, albumRules...)
+		} else if watch.Album != "" {
+			owner := accountOf(path)
+			watchAlbum, err := api.ResolveAlbumRef(watch.Album)
+			if err == nil {
+				watchAlbum.AlbumId, err = albumIdOf(owner.credentials, watchAlbum)
+			}
+			if err != nil {
+				log.Printf("Can't use album of '%v': %v\n", watch.Path, err)
+				return exitFailure
+			}
+			if directoryAlbums[owner] == nil {
+				directoryAlbums[owner] = make(map[string]utils.AlbumResolver)
+			}
+			directoryAlbums[owner][path] = utils.FixedAlbum(watchAlbum.AlbumId)
+		}
+	}
+
+	stopHandlers := make([]chan bool, len(accounts))
+	for i, acc := range accounts {
+		fallbackAlbumId := api.AlbumID("")
+		if acc.Name == defaultAccountName {
+			fallbackAlbumId = uploadAlbumId
+		}
+		var albums utils.AlbumResolver = utils.FixedAlbum(fallbackAlbumId)
+		if len(albumRules) > 0 {
+			mapper := utils.NewAlbumMapper(acc.credentials, albumRules, fallbackAlbumId, acc.AlbumCache)
+			mapper.OnAlbumCreated = emitAlbumCreated
+			albums = mapper
+		}
+		if len(directoryAlbums[acc]) > 0 {
+			albums = utils.DirectoryAlbums{Directories: directoryAlbums[acc], Fallback: albums}
+		}
+
+		acc.uploader, err = utils.NewUploader(acc.credentials, albums, acc.MaxConcurrent)
+		if err != nil {
+			log.Printf("Can't create uploader%v: %v\n", acc.logSuffix(), err)
+			return exitFailure
+		}
+		acc.uploader.SetCompressionRules(compressionRules)
+		acc.uploader.SetTimestampSources(timestampSources)
+		acc.uploader.SetExtensionFilter(includedExtensions, excludedExtensions)
+		loadAlreadyUploadedFiles(acc)
+
+		stopHandlers[i] = make(chan bool)
+		go handleUploaderEvents(acc, stopHandlers[i])
+	}
+
+	initMetrics()
+	if metricsAddress != "" {
+		server, err := startMetricsServer()
+		if err != nil {
+			log.Printf("Can't start the metrics server: %v\n", err)
+			return exitUsage
+		}
+		defer func(server *http.Server) {
+			_ = server.Close()
+		}(server)
+	}
+	if controlAddress != "" {
+		server, err := startControlServer()
+		if err != nil {
+			log.Printf("Can't start the control server: %v\n", err)
+			return exitUsage
+		}
+		defer func(server *http.Server) {
+			_ = server.Close()
+		}(server)
+	}
+
+	// Check that the files passed as arguments fit in the storage left of their account
+	if quotaPolicy != utils.QuotaIgnore {
+		sizes := sizeOfArgumentsFiles()
+		for _, acc := range accounts {
+			acc.uploader.SetQuotaPolicy(quotaPolicy)
+			status, err := acc.uploader.CheckQuota(sizes[acc])
+			if err != nil {
+				log.Printf("Can't check storage quota%v: %v\n", acc.logSuffix(), err)
+			} else if !status.Fits() {
+				if quotaPolicy == utils.QuotaRefuse {
+					log.Printf("Not enough storage left%v: %v\n", acc.logSuffix(), status)
+					return exitQuota
+				}
+				log.Printf("[WARNING] Not enough storage left%v: %v\n", acc.logSuffix(), status)
+			}
+		}
+	}
+
+	// Upload files passed as arguments
+	uploadArgumentsFiles()
+
+	// Wait until all the uploads are completed
+	for _, acc := range accounts {
+		acc.uploader.WaitUploadsCompleted()
+	}
+
+	// Start to watch all the directories if needed
+	if len(directoriesToWatch) > 0 {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			panic(err)
+		}
+		defer func(watcher *fsnotify.Watcher) {
+			_ = watcher.Close()
+		}(watcher)
+		stopWatcher := make(chan bool)
+		go handleFileSystemEvents(watcher, stopWatcher)
+
+		// Check the storage left from time to time
+		if quotaPolicy != utils.QuotaIgnore {
+			for _, acc := range accounts {
+				acc.uploader.StartQuotaMonitor(quotaInterval)
+			}
+		}
+
+		// Upload the files missed by the watcher from time to time
+		stopRescans := make(chan struct{})
+		if rescanInterval > 0 {
+			startRescans(rescanInterval, stopRescans)
+		}
+
+		// Keep the sessions alive
+		if tokenRefreshInterval > 0 {
+			stopTokenRefresh := make(chan struct{})
+			defer close(stopTokenRefresh)
+			for _, acc := range accounts {
+				startTokenRefresh(acc.credentials, tokenRefreshInterval, stopTokenRefresh)
+			}
+		}
+
+		// Add all the directories passed as argument to the watcher
+		for _, name := range directoriesToWatch {
+			if err := startToWatch(name, watcher); err != nil {
+				panic(err)
+			}
+		}
+
+		waitWhileWatching(watcher)
+
+		// Stop watching and rescanning, then let the started uploads finish
+		stopWatcher <- true
+		<-stopWatcher
+		close(stopRescans)
+		if !drainUploads(shutdownTimeout) {
+			log.Printf("Some uploads are still running after %v, they are abandoned\n", shutdownTimeout)
+		}
+	}
+
+	for i, acc := range accounts {
+		stopHandlers[i] <- true
+		<-stopHandlers[i]
+		acc.uploader.Close()
+	}
+
+	// Summary
+	elapsed := time.Since(start)
+	throughput := int64(float64(uploadedBytes) / elapsed.Seconds())
+	log.Printf("Done (%v files uploaded, %v files ignored, %v errors, %v uploaded in %v, %v/s)",
+		uploadedFilesCount, ignoredCount, errorsCount, formatBytes(uploadedBytes), elapsed.Round(time.Second),
+		formatBytes(throughput))
+	for _, path := range failedFiles {
+		log.Printf("Not uploaded: '%v'\n", path)
+	}
+	exitCode := uploadsExitCode()
+	emit(outputSummary{
+		Uploaded:   uploadedFilesCount,
+		Ignored:    ignoredCount,
+		Errors:     errorsCount,
+		Bytes:      uploadedBytes,
+		Elapsed:    elapsed.Seconds(),
+		Throughput: throughput,
+		Failed:     failedFiles,
+		ExitCode:   exitCode,
+	})
+	return exitCode
+}
+
+// Exit code of the uploads, once they are completed
+func uploadsExitCode() int {
+	statusMutex.Lock()
+	defer statusMutex.Unlock()
+	if authRefused {
+		return exitAuth
+	}
+	if quotaExhausted {
+		return exitQuota
+	}
+	if len(failedFiles) > 0 {
+		return exitPartialFailure
+	}
+	return exitOK
+}
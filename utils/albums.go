@@ -0,0 +1,250 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/GaPhi/gphotosuploader/api"
+	"github.com/GaPhi/gphotosuploader/auth"
+)
+
+// Resolves the album in which an uploaded file must be placed. An empty album id means that the file doesn't need to
+// be moved into an album
+type AlbumResolver interface {
+	ResolveAlbum(filePath string) (api.AlbumID, error)
+}
+
+// AlbumResolver that places every file in the same album
+type FixedAlbum api.AlbumID
+
+func (a FixedAlbum) ResolveAlbum(string) (api.AlbumID, error) {
+	return api.AlbumID(a), nil
+}
+
+// AlbumResolver that uses the resolver of the deepest directory containing the file, or the fallback resolver
+type DirectoryAlbums struct {
+	// Resolvers by absolute directory path
+	Directories map[string]AlbumResolver
+
+	Fallback AlbumResolver
+}
+
+func (d DirectoryAlbums) ResolveAlbum(filePath string) (api.AlbumID, error) {
+	var resolver AlbumResolver
+	deepest := ""
+	for dir, r := range d.Directories {
+		if strings.HasPrefix(filePath, dir+string(filepath.Separator)) && len(dir) > len(deepest) {
+			resolver, deepest = r, dir
+		}
+	}
+	if resolver == nil {
+		resolver = d.Fallback
+	}
+	if resolver == nil {
+		return "", nil
+	}
+	return resolver.ResolveAlbum(filePath)
+}
+
+// Rule that maps the files contained in a directory tree to an album name.
+// The album name is built from a template that can contain the following placeholders:
+//   - {dir}: name of the directory containing the file
+//   - {path}: path of the directory containing the file, relative to the rule root
+//   - {root}: name of the rule root directory
+//   - {1}, {2}, ...: components of the relative path ({1} is the first directory under the root)
+type AlbumRule struct {
+	// Absolute path of the directory to which the rule applies
+	Root string
+
+	// Template of the album name
+	Template string
+}
+
+// Parse a rule written as ROOT=TEMPLATE
+func ParseAlbumRule(value string) (AlbumRule, error) {
+	root, template, found := strings.Cut(value, "=")
+	if !found || root == "" || template == "" {
+		return AlbumRule{}, fmt.Errorf("album rule '%v' must be written as directory=template", value)
+	}
+
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return AlbumRule{}, fmt.Errorf("can't get the absolute path of '%v' (%v)", root, err)
+	}
+
+	return AlbumRule{Root: abs, Template: template}, nil
+}
+
+// Returns the album name of the file, or false if the file is not under the rule root
+func (r AlbumRule) AlbumName(filePath string) (string, bool) {
+	rel, err := filepath.Rel(r.Root, filepath.Dir(filePath))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+
+	var components []string
+	if rel != "." {
+		components = strings.Split(rel, string(filepath.Separator))
+	}
+
+	replacements := []string{
+		"{dir}", filepath.Base(filepath.Dir(filePath)),
+		"{path}", strings.Join(components, "/"),
+		"{root}", filepath.Base(r.Root),
+	}
+	for i := len(components); i > 0; i-- {
+		replacements = append(replacements, "{"+strconv.Itoa(i)+"}", components[i-1])
+	}
+	name := strings.NewReplacer(replacements...).Replace(r.Template)
+
+	return strings.TrimSpace(name), true
+}
+
+// Slice of album rules, usable as a CLI argument
+type AlbumRules []AlbumRule
+
+func (a *AlbumRules) String() string {
+	return "Album rule"
+}
+
+func (a *AlbumRules) Set(value string) error {
+	rule, err := ParseAlbumRule(value)
+	if err != nil {
+		return err
+	}
+
+	*a = append(*a, rule)
+	return nil
+}
+
+// AlbumResolver that maps each file to an album using a list of rules. Albums that don't exist yet are created the
+// first time a file needs them
+type AlbumMapper struct {
+	credentials auth.CookieCredentials
+
+	// Rules are checked in order, the first rule whose root contains the file wins
+	rules []AlbumRule
+
+	// Album id used when no rule matches
+	fallbackAlbumId api.AlbumID
+
+	// Optional file in which the known albums are saved, so that they are not created twice across runs
+	cacheFile string
+
+	// Optional function called when an album is created
+	OnAlbumCreated func(albumName string, albumId api.AlbumID)
+
+	// Known albums, by name
+	albums       map[string]api.AlbumID
+	albumsLoaded bool
+	mutex        sync.Mutex
+}
+
+// Creates a new AlbumMapper. The fallback album id is used for the files that don't match any rule (use an empty
+// string to leave them out of any album). The cache file is optional
+func NewAlbumMapper(credentials auth.CookieCredentials, rules []AlbumRule, fallbackAlbumId api.AlbumID, cacheFile string) *AlbumMapper {
+	return &AlbumMapper{
+		credentials:     credentials,
+		rules:           rules,
+		fallbackAlbumId: fallbackAlbumId,
+		cacheFile:       cacheFile,
+		albums:          make(map[string]api.AlbumID),
+	}
+}
+
+func (m *AlbumMapper) ResolveAlbum(filePath string) (api.AlbumID, error) {
+	for _, rule := range m.rules {
+		if name, matches := rule.AlbumName(filePath); matches {
+			if name == "" {
+				return m.fallbackAlbumId, nil
+			}
+			return m.albumIdByName(name)
+		}
+	}
+	return m.fallbackAlbumId, nil
+}
+
+func (m *AlbumMapper) albumIdByName(name string) (api.AlbumID, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// Without the existing albums, an album could be created twice: the file is not uploaded, and the albums are
+	// listed again for the next file
+	if !m.albumsLoaded {
+		if err := m.loadAlbums(); err != nil {
+			return "", fmt.Errorf("can't list existing albums (%w)", err)
+		}
+		m.albumsLoaded = true
+	}
+
+	if albumId, exists := m.albums[name]; exists {
+		return albumId, nil
+	}
+
+	albumId, err := api.CreateAlbum(m.credentials, name)
+	if err != nil {
+		return "", fmt.Errorf("can't create album '%v' (%w)", name, err)
+	}
+	log.Printf("New album '%v' with ID '%v' created\n", name, albumId)
+	m.albums[name] = albumId
+	m.saveAlbums()
+	if m.OnAlbumCreated != nil {
+		m.OnAlbumCreated(name, albumId)
+	}
+
+	return albumId, nil
+}
+
+func (m *AlbumMapper) loadAlbums() error {
+	albums, err := api.ListAllAlbums(m.credentials, nil)
+	if err != nil {
+		return err
+	}
+	for _, album := range albums {
+		m.albums[album.AlbumName] = album.AlbumId
+	}
+
+	// Albums of the cache file win, they were created by a previous run
+	if m.cacheFile == "" {
+		return nil
+	}
+	file, err := os.Open(m.cacheFile)
+	if err != nil {
+		return nil
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	cached := map[string]api.AlbumID{}
+	if err := json.NewDecoder(file).Decode(&cached); err != nil {
+		log.Printf("uploader: Can't read album cache '%v' (%v)\n", m.cacheFile, err)
+		return nil
+	}
+	for name, albumId := range cached {
+		m.albums[name] = albumId
+	}
+	return nil
+}
+
+func (m *AlbumMapper) saveAlbums() {
+	if m.cacheFile == "" {
+		return
+	}
+	file, err := os.Create(m.cacheFile)
+	if err != nil {
+		log.Printf("uploader: Can't update album cache '%v' (%v)\n", m.cacheFile, err)
+		return
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	_ = json.NewEncoder(file).Encode(m.albums)
+}
@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/GaPhi/gphotosuploader/api"
+)
+
+func TestAlbumRuleAlbumName(t *testing.T) {
+	root := filepath.FromSlash("/photos/Trips")
+	tests := []struct {
+		template string
+		file     string
+		name     string
+		matches  bool
+	}{
+		{"{dir}", "/photos/Trips/2021/Rome/a.jpg", "Rome", true},
+		{"{path}", "/photos/Trips/2021/Rome/a.jpg", "2021/Rome", true},
+		{"{root} {1}", "/photos/Trips/2021/Rome/a.jpg", "Trips 2021", true},
+		{"{2} ({1})", "/photos/Trips/2021/Rome/a.jpg", "Rome (2021)", true},
+		{"{1}-{10}", "/photos/Trips/1/2/3/4/5/6/7/8/9/10/a.jpg", "1-10", true},
+		{"{2}", "/photos/Trips/2021/a.jpg", "{2}", true},
+		{" {path} ", "/photos/Trips/a.jpg", "", true},
+		{"{dir}", "/photos/Trips/a.jpg", "Trips", true},
+		{"Fixed", "/photos/Trips/2021/a.jpg", "Fixed", true},
+		{"{dir}", "/photos/Trips/..2021/a.jpg", "..2021", true},
+		{"{dir}", "/photos/Other/a.jpg", "", false},
+		{"{dir}", "/photos/TripsOld/a.jpg", "", false},
+		{"{dir}", "/photos/a.jpg", "", false},
+	}
+	for _, test := range tests {
+		rule := AlbumRule{Root: root, Template: test.template}
+		name, matches := rule.AlbumName(filepath.FromSlash(test.file))
+		if name != test.name || matches != test.matches {
+			t.Errorf("%q of %v: got (%q, %v), want (%q, %v)", test.template, test.file, name, matches, test.name, test.matches)
+		}
+	}
+}
+
+func TestParseAlbumRule(t *testing.T) {
+	rule, err := ParseAlbumRule("photos={dir}=x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if abs, _ := filepath.Abs("photos"); rule.Root != abs || rule.Template != "{dir}=x" {
+		t.Errorf("got %+v", rule)
+	}
+
+	for _, value := range []string{"", "photos", "photos=", "={dir}"} {
+		if _, err := ParseAlbumRule(value); err == nil {
+			t.Errorf("ParseAlbumRule(%q) accepted", value)
+		}
+	}
+
+	var rules AlbumRules
+	if err := rules.Set("a={dir}"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rules.Set("b"); err == nil {
+		t.Error("invalid rule accepted")
+	}
+	if err := rules.Set("b={path}"); err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 || rules[1].Template != "{path}" {
+		t.Errorf("got %+v", rules)
+	}
+}
+
+func TestDirectoryAlbums(t *testing.T) {
+	resolver := DirectoryAlbums{
+		Directories: map[string]AlbumResolver{
+			filepath.FromSlash("/photos"):      FixedAlbum("photos"),
+			filepath.FromSlash("/photos/2021"): FixedAlbum("2021"),
+		},
+		Fallback: FixedAlbum("fallback"),
+	}
+	tests := map[string]api.AlbumID{
+		"/photos/a.jpg":          "photos",
+		"/photos/2021/a.jpg":     "2021",
+		"/photos/2021/sub/a.jpg": "2021",
+		"/photos/20210/a.jpg":    "photos",
+		"/other/a.jpg":           "fallback",
+	}
+	for file, want := range tests {
+		if got, err := resolver.ResolveAlbum(filepath.FromSlash(file)); err != nil || got != want {
+			t.Errorf("%v: got (%q, %v), want %q", file, got, err, want)
+		}
+	}
+
+	resolver.Fallback = nil
+	if got, err := resolver.ResolveAlbum(filepath.FromSlash("/other/a.jpg")); err != nil || got != "" {
+		t.Errorf("without fallback: got (%q, %v)", got, err)
+	}
+}
+
+// The rules are checked in order, and the known albums are not created again
+func TestAlbumMapper(t *testing.T) {
+	mapper := &AlbumMapper{
+		rules: []AlbumRule{
+			{Root: filepath.FromSlash("/photos/Trips"), Template: "Trip {1}"},
+			{Root: filepath.FromSlash("/photos"), Template: "{path}"},
+		},
+		fallbackAlbumId: "fallback",
+		albums:          map[string]api.AlbumID{"Trip 2021": "trip", "Family": "family"},
+		albumsLoaded:    true,
+	}
+	tests := map[string]api.AlbumID{
+		"/photos/Trips/2021/Rome/a.jpg": "trip",
+		"/photos/Family/a.jpg":          "family",
+		"/photos/a.jpg":                 "fallback",
+		"/other/a.jpg":                  "fallback",
+	}
+	for file, want := range tests {
+		if got, err := mapper.ResolveAlbum(filepath.FromSlash(file)); err != nil || got != want {
+			t.Errorf("%v: got (%q, %v), want %q", file, got, err, want)
+		}
+	}
+}
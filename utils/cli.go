@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"gopkg.in/headzoo/surf.v1/errors"
 	"os"
+	"strconv"
+	"strings"
 )
 
 // Slice of name of file and directories to upload
@@ -45,3 +47,27 @@ func (a *DirectoriesToWatch) Set(name string) error {
 	*a = append(*a, name)
 	return nil
 }
+
+// Parse a size in bytes, with an optional K, M or G suffix (powers of 1024)
+func ParseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	value = strings.TrimSuffix(value, "B")
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(value, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(value, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(value, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		value = value[:len(value)-1]
+	}
+
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid size '%v'", value)
+	}
+	return size * multiplier, nil
+}
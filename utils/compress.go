@@ -0,0 +1,296 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Extensions that can be compressed
+var compressibleExtensions = []string{".jpg", ".jpeg", ".png"}
+
+// Rule describing which files are compressed before being uploaded, and how.
+// JPEG files are re-encoded with the given quality, PNG files are losslessly re-encoded with the best compression.
+// Both can be downscaled. The EXIF metadata of the original file is kept
+type CompressionRule struct {
+	// Extensions of the files to compress (lower case, with the dot). Empty for all the supported extensions
+	Extensions []string
+
+	// Only compress files bigger than this size, in bytes
+	MinSize int64
+
+	// JPEG quality (1-100)
+	Quality int
+
+	// Maximum width and height of the images, in pixels. 0 to keep the original size
+	MaxDimension int
+}
+
+// Parse a rule written as a list of key=value separated by commas, like "ext=jpg|png,minSize=2M,quality=85,maxDim=4096"
+func ParseCompressionRule(value string) (CompressionRule, error) {
+	rule := CompressionRule{Quality: 85}
+	for _, option := range strings.Split(value, ",") {
+		key, val, found := strings.Cut(strings.TrimSpace(option), "=")
+		if !found {
+			return rule, fmt.Errorf("compression option '%v' must be written as key=value", option)
+		}
+
+		var err error
+		switch key {
+		case "ext":
+			for _, extension := range strings.Split(val, "|") {
+				extension = "." + strings.TrimPrefix(strings.ToLower(extension), ".")
+				if !isCompressible(extension) {
+					return rule, fmt.Errorf("can't compress '%v' files", extension)
+				}
+				rule.Extensions = append(rule.Extensions, extension)
+			}
+		case "minSize":
+			rule.MinSize, err = ParseSize(val)
+		case "quality":
+			rule.Quality, err = strconv.Atoi(val)
+			if err == nil && (rule.Quality < 1 || rule.Quality > 100) {
+				err = fmt.Errorf("quality must be between 1 and 100")
+			}
+		case "maxDim":
+			rule.MaxDimension, err = strconv.Atoi(val)
+		default:
+			err = fmt.Errorf("unknown compression option '%v'", key)
+		}
+		if err != nil {
+			return rule, err
+		}
+	}
+	return rule, nil
+}
+
+// Check if the rule applies to a file
+func (r CompressionRule) Matches(filePath string, size int64) bool {
+	extension := strings.ToLower(filepath.Ext(filePath))
+	if !isCompressible(extension) || size < r.MinSize {
+		return false
+	}
+	if len(r.Extensions) == 0 {
+		return true
+	}
+	for _, ext := range r.Extensions {
+		if ext == extension {
+			return true
+		}
+	}
+	return false
+}
+
+// Compress the file into a temporary file, that must be closed and removed by the caller. It returns nil if the
+// compressed file is not smaller than the original one
+func (r CompressionRule) Compress(file *os.File) (*os.File, error) {
+	original, err := io.ReadAll(io.NewSectionReader(file, 0, 1<<62))
+	if err != nil {
+		return nil, err
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(original))
+	if err != nil {
+		return nil, fmt.Errorf("can't decode image (%v)", err)
+	}
+	img = downscale(img, r.MaxDimension)
+
+	var (
+		encoded    bytes.Buffer
+		compressed []byte
+	)
+	switch format {
+	case "jpeg":
+		if err := jpeg.Encode(&encoded, img, &jpeg.Options{Quality: r.Quality}); err != nil {
+			return nil, err
+		}
+		compressed = copyJpegMetadata(original, encoded.Bytes())
+	case "png":
+		encoder := png.Encoder{CompressionLevel: png.BestCompression}
+		if err := encoder.Encode(&encoded, img); err != nil {
+			return nil, err
+		}
+		compressed = copyPngMetadata(original, encoded.Bytes())
+	default:
+		return nil, fmt.Errorf("can't compress '%v' images", format)
+	}
+
+	if len(compressed) >= len(original) {
+		return nil, nil
+	}
+
+	temp, err := os.CreateTemp("", "gphotosuploader-*"+filepath.Ext(file.Name()))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := temp.Write(compressed); err != nil {
+		_ = temp.Close()
+		_ = os.Remove(temp.Name())
+		return nil, err
+	}
+	_, _ = temp.Seek(0, io.SeekStart)
+	return temp, nil
+}
+
+// Slice of compression rules, usable as a CLI argument
+type CompressionRules []CompressionRule
+
+func (a *CompressionRules) String() string {
+	return "Compression rule"
+}
+
+func (a *CompressionRules) Set(value string) error {
+	rule, err := ParseCompressionRule(value)
+	if err != nil {
+		return err
+	}
+
+	*a = append(*a, rule)
+	return nil
+}
+
+// First rule that applies to a file, or nil
+func (a CompressionRules) Match(filePath string, size int64) *CompressionRule {
+	for i := range a {
+		if a[i].Matches(filePath, size) {
+			return &a[i]
+		}
+	}
+	return nil
+}
+
+func isCompressible(extension string) bool {
+	for _, ext := range compressibleExtensions {
+		if ext == extension {
+			return true
+		}
+	}
+	return false
+}
+
+// Downscale the image so that its width and height don't exceed maxDimension, averaging the source pixels
+func downscale(img image.Image, maxDimension int) image.Image {
+	bounds := img.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+	if maxDimension <= 0 || (srcWidth <= maxDimension && srcHeight <= maxDimension) {
+		return img
+	}
+
+	dstWidth, dstHeight := maxDimension, maxDimension
+	if srcWidth > srcHeight {
+		dstHeight = max(1, srcHeight*maxDimension/srcWidth)
+	} else {
+		dstWidth = max(1, srcWidth*maxDimension/srcHeight)
+	}
+
+	src := image.NewRGBA(image.Rect(0, 0, srcWidth, srcHeight))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+
+	for y := 0; y < dstHeight; y++ {
+		y0, y1 := y*srcHeight/dstHeight, max((y+1)*srcHeight/dstHeight, y*srcHeight/dstHeight+1)
+		for x := 0; x < dstWidth; x++ {
+			x0, x1 := x*srcWidth/dstWidth, max((x+1)*srcWidth/dstWidth, x*srcWidth/dstWidth+1)
+
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+
+			count := (y1 - y0) * (x1 - x0)
+			offset := y*dst.Stride + x*4
+			for i := 0; i < 4; i++ {
+				dst.Pix[offset+i] = uint8(sum[i] / count)
+			}
+		}
+	}
+	return dst
+}
+
+// Copy the EXIF (APP1) and ICC profile (APP2) segments of the original JPEG into the compressed one, right after its
+// start of image marker
+func copyJpegMetadata(original []byte, compressed []byte) []byte {
+	if len(original) < 4 || len(compressed) < 2 || original[0] != 0xFF || original[1] != 0xD8 {
+		return compressed
+	}
+
+	var segments []byte
+	for offset := 2; offset+4 <= len(original); {
+		if original[offset] != 0xFF {
+			break
+		}
+		marker := original[offset+1]
+		if marker == 0xDA || marker == 0xD9 { // Start of scan or end of image: no more metadata
+			break
+		}
+		length := int(binary.BigEndian.Uint16(original[offset+2:]))
+		end := offset + 2 + length
+		if end > len(original) {
+			break
+		}
+		if marker == 0xE1 || marker == 0xE2 {
+			segments = append(segments, original[offset:end]...)
+		}
+		offset = end
+	}
+
+	result := make([]byte, 0, len(compressed)+len(segments))
+	result = append(result, compressed[:2]...)
+	result = append(result, segments...)
+	return append(result, compressed[2:]...)
+}
+
+// Copy the eXIf chunk of the original PNG into the compressed one, right after its IHDR chunk
+func copyPngMetadata(original []byte, compressed []byte) []byte {
+	const signatureLength = 8
+	exif := findPngChunk(original, "eXIf")
+	if exif == nil || len(compressed) < signatureLength+8 {
+		return compressed
+	}
+
+	ihdrEnd := signatureLength + 12 + int(binary.BigEndian.Uint32(compressed[signatureLength:]))
+	if ihdrEnd > len(compressed) {
+		return compressed
+	}
+
+	result := make([]byte, 0, len(compressed)+len(exif))
+	result = append(result, compressed[:ihdrEnd]...)
+	result = append(result, exif...)
+	return append(result, compressed[ihdrEnd:]...)
+}
+
+// Find a PNG chunk by type, returning it whole (length, type, data and CRC)
+func findPngChunk(data []byte, chunkType string) []byte {
+	for offset := 8; offset+12 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[offset:]))
+		end := offset + 12 + length
+		if length < 0 || end > len(data) {
+			return nil
+		}
+		if string(data[offset+4:offset+8]) == chunkType {
+			chunk := data[offset:end]
+			if crc32.ChecksumIEEE(chunk[4:8+length]) != binary.BigEndian.Uint32(chunk[8+length:]) {
+				return nil
+			}
+			return chunk
+		}
+		offset = end
+	}
+	return nil
+}
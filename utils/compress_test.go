@@ -0,0 +1,180 @@
+package utils
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseCompressionRule(t *testing.T) {
+	tests := []struct {
+		value string
+		rule  CompressionRule
+		valid bool
+	}{
+		{"quality=70", CompressionRule{Quality: 70}, true},
+		{"ext=JPG|.png, minSize=2K, maxDim=1024", CompressionRule{Extensions: []string{".jpg", ".png"}, MinSize: 2048,
+			Quality: 85, MaxDimension: 1024}, true},
+		{"ext=gif", CompressionRule{}, false},
+		{"quality=0", CompressionRule{}, false},
+		{"quality=101", CompressionRule{}, false},
+		{"quality", CompressionRule{}, false},
+		{"minSize=big", CompressionRule{}, false},
+		{"level=9", CompressionRule{}, false},
+	}
+	for _, test := range tests {
+		rule, err := ParseCompressionRule(test.value)
+		if (err == nil) != test.valid {
+			t.Errorf("ParseCompressionRule(%q): error %v", test.value, err)
+		} else if test.valid && !reflect.DeepEqual(rule, test.rule) {
+			t.Errorf("ParseCompressionRule(%q) = %+v, want %+v", test.value, rule, test.rule)
+		}
+	}
+}
+
+func TestCompressionRulesMatch(t *testing.T) {
+	var rules CompressionRules
+	for _, value := range []string{"ext=png,minSize=1M", "ext=jpg|jpeg,quality=60", "quality=90"} {
+		if err := rules.Set(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		path    string
+		size    int64
+		quality int
+	}{
+		{"photo.JPG", 10, 60},
+		{"photo.jpeg", 10, 60},
+		{"image.png", 2 << 20, 85},
+		{"image.png", 10, 90},
+		{"image.gif", 2 << 20, 0},
+		{"video.mp4", 2 << 20, 0},
+	}
+	for _, test := range tests {
+		rule := rules.Match(test.path, test.size)
+		switch {
+		case rule == nil && test.quality != 0:
+			t.Errorf("Match(%v, %v): no rule", test.path, test.size)
+		case rule != nil && rule.Quality != test.quality:
+			t.Errorf("Match(%v, %v): rule %+v, want quality %v", test.path, test.size, *rule, test.quality)
+		}
+	}
+}
+
+func TestDownscale(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 10))
+	for x := 0; x < 40; x++ {
+		for y := 0; y < 10; y++ {
+			if x%2 == 0 {
+				img.Set(x, y, color.RGBA{R: 200, A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{B: 100, A: 255})
+			}
+		}
+	}
+	tests := []struct {
+		maxDimension  int
+		width, height int
+	}{
+		{0, 40, 10},
+		{50, 40, 10},
+		{20, 20, 5},
+		{4, 4, 1},
+		{1, 1, 1},
+	}
+	for _, test := range tests {
+		scaled := downscale(img, test.maxDimension)
+		if bounds := scaled.Bounds(); bounds.Dx() != test.width || bounds.Dy() != test.height {
+			t.Errorf("downscale(%v) = %vx%v, want %vx%v", test.maxDimension, bounds.Dx(), bounds.Dy(), test.width,
+				test.height)
+		}
+	}
+
+	// The pixels are averaged
+	r, g, b, _ := downscale(img, 20).At(3, 2).RGBA()
+	if r>>8 != 100 || g != 0 || b>>8 != 50 {
+		t.Errorf("averaged pixel: %v, %v, %v", r>>8, g>>8, b>>8)
+	}
+}
+
+// The compressed images are smaller, decodable and keep the EXIF metadata of the original files
+func TestCompress(t *testing.T) {
+	tests := []struct {
+		file     string
+		rule     CompressionRule
+		metadata []byte
+		size     int
+	}{
+		{"photo.jpg", CompressionRule{Quality: 50}, []byte("\xFF\xE1"), 96},
+		{"photo.jpg", CompressionRule{Quality: 90, MaxDimension: 48}, []byte("\xFF\xE1"), 48},
+		{"photo.png", CompressionRule{}, []byte("eXIf"), 96},
+	}
+	for _, test := range tests {
+		original, err := os.ReadFile(filepath.Join("testdata", test.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		file, err := os.Open(filepath.Join("testdata", test.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		compressed, err := test.rule.Compress(file)
+		_ = file.Close()
+		if err != nil || compressed == nil {
+			t.Errorf("Compress(%v, %+v) = %v, %v", test.file, test.rule, compressed, err)
+			continue
+		}
+		data, err := os.ReadFile(compressed.Name())
+		_ = compressed.Close()
+		_ = os.Remove(compressed.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(data) >= len(original) {
+			t.Errorf("%v: compressed size %v, original size %v", test.file, len(data), len(original))
+		}
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("%v: can't decode the compressed image (%v)", test.file, err)
+		} else if img.Bounds().Dx() != test.size {
+			t.Errorf("%v: width %v, want %v", test.file, img.Bounds().Dx(), test.size)
+		}
+		if !bytes.Contains(data, test.metadata) || !bytes.Contains(data, []byte("2021:06:15 10:20:30")) {
+			t.Errorf("%v: the EXIF metadata is not kept", test.file)
+		}
+	}
+}
+
+func TestCompressNotSmaller(t *testing.T) {
+	// A JPEG compressed again with the best quality is not smaller
+	file, err := os.Open(filepath.Join("testdata", "photo.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+	compressed, err := CompressionRule{Quality: 100}.Compress(file)
+	if compressed != nil {
+		_ = compressed.Close()
+		_ = os.Remove(compressed.Name())
+	}
+	if err != nil || compressed != nil {
+		t.Errorf("got %v, %v, want no compressed file", compressed, err)
+	}
+}
+
+func TestCopyJpegMetadataInvalid(t *testing.T) {
+	compressed := []byte{0xFF, 0xD8, 0xFF, 0xD9}
+	for _, original := range [][]byte{nil, {0xFF}, []byte("not a jpeg"), {0xFF, 0xD8, 0xFF, 0xE1, 0xFF, 0xFF}} {
+		if result := copyJpegMetadata(original, compressed); !bytes.Equal(result, compressed) {
+			t.Errorf("copyJpegMetadata(%x) = %x", original, result)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+)
+
+// File uploaded by the ConcurrentUploader
+type CompletedUpload struct {
+	// Absolute path of the file
+	Path string
+
+	// Id and URL of the uploaded image, empty if Google didn't return them
+	ImageID  string
+	ImageUrl string
+
+	// Number of bytes sent (after compression)
+	Bytes int64
+
+	// Time taken by the upload, without the time spent waiting for its turn
+	Duration time.Duration
+}
+
+// Reason why a file has not been uploaded
+type IgnoreReason string
+
+const (
+	IgnoredAlreadyUploaded   IgnoreReason = "already-uploaded"
+	IgnoredAlreadyQueued     IgnoreReason = "already-queued"
+	IgnoredNotMedia          IgnoreReason = "not-media"
+	IgnoredExcludedExtension IgnoreReason = "excluded-extension"
+)
+
+// File not uploaded by the ConcurrentUploader
+type IgnoredUpload struct {
+	// Absolute path of the file
+	Path string
+
+	Reason IgnoreReason
+}
+
+// Class of an upload error, telling what failed
+type ErrorClass string
+
+const (
+	// The file can't be read
+	ErrorFile ErrorClass = "file"
+
+	// The storage of the user is full
+	ErrorQuota ErrorClass = "quota"
+
+	// The album of the file can't be found or created
+	ErrorAlbum ErrorClass = "album"
+
+	// The upload requests failed
+	ErrorUpload ErrorClass = "upload"
+
+	// Google refused the requests even with a new at token: the cookies have expired
+	ErrorAuth ErrorClass = "auth"
+
+	// The upload has not been attempted because the uploads are stopped
+	ErrorStopped ErrorClass = "stopped"
+)
+
+// Error sent by the ConcurrentUploader on its Errors channel
+type UploadError struct {
+	// Absolute path of the file
+	Path string
+
+	Class ErrorClass
+	Err   error
+}
+
+func (e *UploadError) Error() string {
+	return fmt.Sprintf("Error with '%s': %v", e.Path, e.Err)
+}
+
+func (e *UploadError) Unwrap() error {
+	return e.Err
+}
@@ -1,10 +1,24 @@
 package utils
 
+import (
+	"path/filepath"
+	"strings"
+)
+
 var supportedExtensions = [...]string{
 	// Images
 	".jpg",
+	".jpeg",
 	".png",
 	".webp",
+	".heic",
+	".heif",
+	".avif",
+	".gif",
+	".tif",
+	".tiff",
+	".bmp",
+	".ico",
 
 	// Raw images
 	".crw",
@@ -39,9 +53,11 @@ var supportedExtensions = [...]string{
 	".m2ts",
 	".mts",
 	".mkv",
+	".webm",
 }
 
 func isExtensionSupported(toCheck string) bool {
+	toCheck = strings.ToLower(toCheck)
 	for _, extension := range supportedExtensions {
 		if toCheck == extension {
 			return true
@@ -49,3 +65,31 @@ func isExtensionSupported(toCheck string) bool {
 	}
 	return false
 }
+
+// List of file extensions separated by commas, usable as a CLI argument. Extensions are stored in lower case, with the
+// dot
+type Extensions []string
+
+func (e *Extensions) String() string {
+	return strings.Join(*e, ",")
+}
+
+func (e *Extensions) Set(value string) error {
+	for _, extension := range strings.Split(value, ",") {
+		if extension = strings.TrimSpace(extension); extension != "" {
+			*e = append(*e, "."+strings.TrimPrefix(strings.ToLower(extension), "."))
+		}
+	}
+	return nil
+}
+
+// Check if the extension of a file is in the list (case insensitive)
+func (e Extensions) Contains(filePath string) bool {
+	extension := strings.ToLower(filepath.Ext(filePath))
+	for _, ext := range e {
+		if ext == extension {
+			return true
+		}
+	}
+	return false
+}
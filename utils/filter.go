@@ -0,0 +1,303 @@
+package utils
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Name of the files listing the paths to ignore in a directory and its subdirectories
+const IgnoreFileName = ".gphotosignore"
+
+// Paths excluded unless the filter is created without the defaults: hidden files and directories (like .thumbnails or
+// .trash) and the directories created by the NAS
+var DefaultExcludePatterns = []string{".*", "@eaDir/", "#recycle/", "#snapshot/"}
+
+// Pattern written with the gitignore syntax
+type pathPattern struct {
+	// Pattern starting with '!': the matching paths are included again
+	negate bool
+
+	// Pattern ending with '/': it only matches directories
+	dirOnly bool
+
+	// Components of the pattern, '**' matching any number of components
+	segments []string
+
+	// Directory of the pattern, the paths are matched relative to it
+	base string
+}
+
+// Parse a gitignore pattern relative to base. It returns false for empty lines and comments
+func parsePathPattern(line string, base string) (pathPattern, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return pathPattern{}, false
+	}
+
+	pattern := pathPattern{base: base}
+	if strings.HasPrefix(line, "!") {
+		pattern.negate = true
+		line = line[1:]
+	}
+	line = strings.TrimPrefix(line, "\\")
+	if strings.HasSuffix(line, "/") {
+		pattern.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	// A pattern without slash matches at any level, otherwise it is relative to its directory
+	if !strings.Contains(line, "/") {
+		pattern.segments = []string{"**", line}
+	} else {
+		pattern.segments = strings.Split(strings.TrimPrefix(line, "/"), "/")
+	}
+	return pattern, line != ""
+}
+
+// Check if the pattern matches the path or one of its parent directories
+func (p pathPattern) matches(path string, isDir bool) bool {
+	rel, err := filepath.Rel(p.base, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+
+	components := strings.Split(filepath.ToSlash(rel), "/")
+	for end := len(components); end > 0; end-- {
+		if end == len(components) && p.dirOnly && !isDir {
+			continue
+		}
+		if matchSegments(p.segments, components[:end]) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSegments(pattern []string, components []string) bool {
+	if len(pattern) == 0 {
+		return len(components) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(components); i++ {
+			if matchSegments(pattern[1:], components[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(components) == 0 {
+		return false
+	}
+	matched, _ := filepath.Match(pattern[0], components[0])
+	return matched && matchSegments(pattern[1:], components[1:])
+}
+
+// Slice of gitignore patterns, usable as a CLI argument
+type Patterns []string
+
+func (p *Patterns) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *Patterns) Set(value string) error {
+	*p = append(*p, value)
+	return nil
+}
+
+// Filter of the files to upload and of the directories to walk or watch. Paths are excluded by the exclude patterns
+// and by the .gphotosignore files found between the root directory and the path, written with the gitignore syntax
+// (the last matching pattern wins). When there are include patterns, only the files matching one of them are accepted
+type FileFilter struct {
+	// Gitignore patterns of the paths to upload, and of the paths to ignore
+	Include Patterns
+	Exclude Patterns
+
+	// Size of the files to upload, in bytes. 0 for no limit
+	MinSize int64
+	MaxSize int64
+
+	// Maximum age of the files to upload (based on their modification time). 0 for no limit
+	MaxAge time.Duration
+
+	// Root directories (the patterns are relative to them) and patterns of the .gphotosignore files by directory
+	roots       []string
+	mutex       sync.Mutex
+	ignoreFiles map[string][]pathPattern
+}
+
+// Create a filter with the default exclude patterns, or without any pattern
+func NewFileFilter(defaultExcludes bool) *FileFilter {
+	filter := &FileFilter{}
+	if defaultExcludes {
+		filter.Exclude = append(filter.Exclude, DefaultExcludePatterns...)
+	}
+	return filter
+}
+
+// Add a root directory: the patterns are relative to it and the .gphotosignore files are looked for from it.
+// A root is never excluded itself. Adding a root again has no effect
+func (f *FileFilter) AddRoot(path string) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for _, root := range f.roots {
+		if root == path {
+			return
+		}
+	}
+	f.roots = append(f.roots, path)
+}
+
+// Forget the patterns read from the .gphotosignore file of a directory, to read it again (after it changed)
+func (f *FileFilter) Forget(dir string) {
+	f.mutex.Lock()
+	delete(f.ignoreFiles, dir)
+	f.mutex.Unlock()
+}
+
+// Check if a directory must be walked or watched
+func (f *FileFilter) AcceptsDir(path string) bool {
+	return !f.excluded(path, true)
+}
+
+// Check if a file must be uploaded
+func (f *FileFilter) Accepts(path string, info os.FileInfo) bool {
+	if info.IsDir() || f.excluded(path, false) {
+		return false
+	}
+	if len(f.Include) > 0 {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		root := f.rootOf(path)
+		included := false
+		for _, line := range f.Include {
+			if pattern, ok := parsePathPattern(line, root); ok && pattern.matches(path, false) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+
+	if f.MinSize > 0 && info.Size() < f.MinSize {
+		return false
+	}
+	if f.MaxSize > 0 && info.Size() > f.MaxSize {
+		return false
+	}
+	if f.MaxAge > 0 && time.Since(info.ModTime()) > f.MaxAge {
+		return false
+	}
+	return true
+}
+
+// Walk the files of a directory (or a single file), skipping the excluded directories. The directory is excluded like
+// the others unless it is a root of the filter (see AddRoot)
+func (f *FileFilter) Walk(root string, walkFn func(path string, info os.FileInfo)) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			if !f.AcceptsDir(path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if f.Accepts(path, info) {
+			walkFn(path, info)
+		}
+		return nil
+	})
+}
+
+func (f *FileFilter) excluded(path string, isDir bool) bool {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if filepath.Base(path) == IgnoreFileName {
+		return true
+	}
+	root := f.rootOf(path)
+	if root == path {
+		return false
+	}
+
+	var patterns []pathPattern
+	for _, line := range f.Exclude {
+		if pattern, ok := parsePathPattern(line, root); ok {
+			patterns = append(patterns, pattern)
+		}
+	}
+	// Patterns of the .gphotosignore files, from the root to the directory of the path
+	var dirs []string
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+		if dir == root || dir == filepath.Dir(dir) || !strings.HasPrefix(dir, root) {
+			break
+		}
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		patterns = append(patterns, f.ignoreFile(dirs[i])...)
+	}
+
+	excluded := false
+	for _, pattern := range patterns {
+		if pattern.matches(path, isDir) {
+			excluded = !pattern.negate
+		}
+	}
+	return excluded
+}
+
+// Longest root containing the path, or the directory of the path if there's none
+func (f *FileFilter) rootOf(path string) string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	root := ""
+	for _, r := range f.roots {
+		if (path == r || strings.HasPrefix(path, r+string(filepath.Separator))) && len(r) > len(root) {
+			root = r
+		}
+	}
+	if root == "" {
+		return filepath.Dir(path)
+	}
+	return root
+}
+
+// Patterns of the .gphotosignore file of a directory, read once
+func (f *FileFilter) ignoreFile(dir string) []pathPattern {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if patterns, found := f.ignoreFiles[dir]; found {
+		return patterns
+	}
+	if f.ignoreFiles == nil {
+		f.ignoreFiles = map[string][]pathPattern{}
+	}
+
+	var patterns []pathPattern
+	if file, err := os.Open(filepath.Join(dir, IgnoreFileName)); err == nil {
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if pattern, ok := parsePathPattern(scanner.Text(), dir); ok {
+				patterns = append(patterns, pattern)
+			}
+		}
+		_ = file.Close()
+	}
+	f.ignoreFiles[dir] = patterns
+	return patterns
+}
@@ -0,0 +1,230 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestPathPattern(t *testing.T) {
+	base := filepath.FromSlash("/photos")
+	tests := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		matches bool
+	}{
+		{"*.tmp", "/photos/a.tmp", false, true},
+		{"*.tmp", "/photos/2021/b.tmp", false, true},
+		{"*.tmp", "/photos/a.jpg", false, false},
+		{"/*.tmp", "/photos/a.tmp", false, true},
+		{"/*.tmp", "/photos/2021/b.tmp", false, false},
+		{"2021/*.jpg", "/photos/2021/a.jpg", false, true},
+		{"2021/*.jpg", "/photos/old/2021/a.jpg", false, false},
+		{"**/raw/*", "/photos/2021/trip/raw/a.cr3", false, true},
+		{"a/**/b", "/photos/a/b", false, true},
+		{"a/**/b", "/photos/a/x/y/b", false, true},
+		{"cache/", "/photos/cache", true, true},
+		{"cache/", "/photos/cache", false, false},
+		{"cache/", "/photos/2021/cache/a.jpg", false, true},
+		{"private", "/photos/private/a.jpg", false, true},
+		{"*.jpg", "/other/a.jpg", false, false},
+		{"*.jpg", "/photos", true, false},
+		{"\\#file", "/photos/#file", false, true},
+	}
+	for _, test := range tests {
+		pattern, ok := parsePathPattern(test.pattern, base)
+		if !ok {
+			t.Errorf("parsePathPattern(%q) ignored", test.pattern)
+			continue
+		}
+		if matches := pattern.matches(filepath.FromSlash(test.path), test.isDir); matches != test.matches {
+			t.Errorf("%q matches %v (dir %v): got %v", test.pattern, test.path, test.isDir, matches)
+		}
+	}
+
+	for _, line := range []string{"", "   ", "# comment", "/", "!"} {
+		if _, ok := parsePathPattern(line, base); ok {
+			t.Errorf("parsePathPattern(%q) not ignored", line)
+		}
+	}
+	if pattern, _ := parsePathPattern("!keep.jpg  ", base); !pattern.negate {
+		t.Error("negation not parsed")
+	}
+}
+
+// Create the files of a tree, the names ending with / being directories
+func createTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Relative paths of the files accepted by a walk
+func walkFiles(t *testing.T, filter *FileFilter, root string, dir string) []string {
+	t.Helper()
+	var files []string
+	if err := filter.Walk(dir, func(path string, _ os.FileInfo) {
+		rel, _ := filepath.Rel(root, path)
+		files = append(files, filepath.ToSlash(rel))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestFileFilterWalk(t *testing.T) {
+	root := t.TempDir()
+	createTree(t, root, map[string]string{
+		"a.jpg":                 "",
+		"b.tmp":                 "",
+		".hidden/c.jpg":         "",
+		"@eaDir/a.jpg":          "",
+		"2021/d.jpg":            "",
+		"2021/e.tmp":            "",
+		"2021/keep.tmp":         "",
+		"2021/.gphotosignore":   "*.jpg\n!d.jpg\n",
+		"2021/trip/f.jpg":       "",
+		"2021/trip/g.mp4":       "",
+		"private/h.jpg":         "",
+		"nested/private/i.jpg":  "",
+		"nested/.gphotosignore": "# Comment\n/j.jpg\n",
+		"nested/j.jpg":          "",
+		"nested/sub/j.jpg":      "",
+		"cache/k.jpg":           "",
+		"notcache/cache/l.jpg":  "",
+		"notcache/cache.jpg":    "",
+	})
+
+	filter := NewFileFilter(true)
+	filter.Exclude = append(filter.Exclude, "*.tmp", "!keep.tmp", "/private", "cache/")
+	filter.AddRoot(root)
+	got := walkFiles(t, filter, root, root)
+	want := []string{
+		"2021/d.jpg",
+		"2021/keep.tmp",
+		"2021/trip/g.mp4",
+		"a.jpg",
+		"nested/private/i.jpg",
+		"nested/sub/j.jpg",
+		"notcache/cache.jpg",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Include patterns
+	filter = NewFileFilter(true)
+	filter.Include = Patterns{"*.mp4", "/a.jpg"}
+	filter.AddRoot(root)
+	if got, want := walkFiles(t, filter, root, root), []string{"2021/trip/g.mp4", "a.jpg"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("include: got %v, want %v", got, want)
+	}
+}
+
+// A walked subdirectory is not a root: it is excluded like the other directories, and the anchored patterns stay
+// relative to the root
+func TestFileFilterWalkSubdirectory(t *testing.T) {
+	root := t.TempDir()
+	createTree(t, root, map[string]string{
+		".hidden/a.jpg":     "",
+		"2021/b.jpg":        "",
+		"2021/2021/b.jpg":   "",
+		"@eaDir/thumb.jpg":  "",
+		"2021/@eaDir/c.jpg": "",
+	})
+	filter := NewFileFilter(true)
+	filter.Exclude = append(filter.Exclude, "/2021/b.jpg")
+	filter.AddRoot(root)
+
+	if got := walkFiles(t, filter, root, filepath.Join(root, ".hidden")); len(got) != 0 {
+		t.Errorf("excluded directory walked: %v", got)
+	}
+	if got := walkFiles(t, filter, root, filepath.Join(root, "@eaDir")); len(got) != 0 {
+		t.Errorf("excluded directory walked: %v", got)
+	}
+	if got, want := walkFiles(t, filter, root, filepath.Join(root, "2021")), []string{"2021/2021/b.jpg"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if len(filter.roots) != 1 {
+		t.Errorf("the walks added roots: %v", filter.roots)
+	}
+}
+
+func TestFileFilterAddRoot(t *testing.T) {
+	root := t.TempDir()
+	filter := NewFileFilter(false)
+	filter.AddRoot(root)
+	filter.AddRoot(root)
+	filter.AddRoot(filepath.Join(root, "sub", ".."))
+	filter.AddRoot(filepath.Join(root, "sub"))
+	if want := []string{root, filepath.Join(root, "sub")}; !reflect.DeepEqual(filter.roots, want) {
+		t.Errorf("roots %v, want %v", filter.roots, want)
+	}
+
+	// The deepest root is used, and a root is never excluded
+	filter.Exclude = Patterns{"/sub"}
+	if !filter.AcceptsDir(filepath.Join(root, "sub")) {
+		t.Error("root excluded")
+	}
+	if filter.rootOf(filepath.Join(root, "sub", "a.jpg")) != filepath.Join(root, "sub") {
+		t.Error("not the deepest root")
+	}
+	if filter.rootOf(filepath.Join(root, "subway", "a.jpg")) != root {
+		t.Error("root matched by prefix")
+	}
+}
+
+func TestFileFilterAccepts(t *testing.T) {
+	root := t.TempDir()
+	createTree(t, root, map[string]string{
+		"small.jpg": "1",
+		"big.jpg":   "1234567890",
+		"old.jpg":   "12345",
+	})
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(filepath.Join(root, "old.jpg"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	filter := NewFileFilter(false)
+	filter.MinSize, filter.MaxSize, filter.MaxAge = 2, 9, 24*time.Hour
+	filter.AddRoot(root)
+	if got := walkFiles(t, filter, root, root); len(got) != 0 {
+		t.Errorf("got %v, want no file", got)
+	}
+	filter.MaxAge = 0
+	if got, want := walkFiles(t, filter, root, root), []string{"old.jpg"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestFileFilterForget(t *testing.T) {
+	root := t.TempDir()
+	createTree(t, root, map[string]string{"a.jpg": "", IgnoreFileName: "a.jpg\n"})
+	filter := NewFileFilter(false)
+	filter.AddRoot(root)
+	if got := walkFiles(t, filter, root, root); len(got) != 0 {
+		t.Errorf("got %v, want no file", got)
+	}
+
+	createTree(t, root, map[string]string{IgnoreFileName: "b.jpg\n"})
+	if got := walkFiles(t, filter, root, root); len(got) != 0 {
+		t.Errorf("the ignore file was read again: %v", got)
+	}
+	filter.Forget(root)
+	if got, want := walkFiles(t, filter, root, root), []string{"a.jpg"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"io"
 	"net/http"
 	"os"
 	"path"
@@ -16,7 +17,7 @@ func IsImageOrVideo(fileName string) (bool, error) {
 		return true, nil
 	}
 
-	// If extension check fails, try with mime
+	// If extension check fails, try with the content
 	if file, err := os.Open(fileName); err == nil {
 		defer func(file *os.File) {
 			_ = file.Close()
@@ -30,18 +31,30 @@ func IsImageOrVideo(fileName string) (bool, error) {
 // Check if the file has a image or video mime. This function read the first 512 bytes of the file.
 // Before and after the reading of the file offset is reset
 func IsFileImageOrVideo(file *os.File) (bool, error) {
+	mime, err := DetectMediaType(file)
+	if err != nil {
+		return false, err
+	}
+	return strings.HasPrefix(mime, "image/") || strings.HasPrefix(mime, "video/"), nil
+}
+
+// Detect the mime of a file from its first 512 bytes, using the media sniffer first and the standard library for the
+// formats it doesn't know. Before and after the reading of the file offset is reset
+func DetectMediaType(file *os.File) (string, error) {
 	// Read first 512 bytes
-	_, _ = file.Seek(0, 0)
+	_, _ = file.Seek(0, io.SeekStart)
 	buffer := make([]byte, sniffLen)
-	if _, err := file.Read(buffer); err != nil {
-		return false, err
+	n, err := io.ReadFull(file, buffer)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
 	}
+	buffer = buffer[:n]
 
 	// Reset the file
-	_, _ = file.Seek(0, 0)
-
-	// Detect content type
-	mime := http.DetectContentType(buffer)
+	_, _ = file.Seek(0, io.SeekStart)
 
-	return strings.Contains(mime, "image/") || strings.Contains(mime, "video/"), nil
+	if mime := SniffMediaType(buffer); mime != "" {
+		return mime, nil
+	}
+	return http.DetectContentType(buffer), nil
 }
@@ -0,0 +1,144 @@
+package utils
+
+import (
+	"io"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Upload waiting for its turn
+type QueuedUpload struct {
+	// Absolute path of the file
+	Path string
+
+	Queued time.Time
+}
+
+// Started upload, with the number of bytes sent
+type InFlightUpload struct {
+	// Absolute path of the file
+	Path string
+
+	// Size of the file to send (after compression) and bytes already sent
+	Size int64
+	Sent int64
+
+	Started time.Time
+}
+
+type uploadProgress struct {
+	size    atomic.Int64
+	sent    atomic.Int64
+	started time.Time
+}
+
+// Reader counting the bytes read
+type progressReader struct {
+	reader io.Reader
+	sent   *atomic.Int64
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.sent.Add(int64(n))
+	return n, err
+}
+
+// Uploads waiting for their turn (or for the uploads to be resumed), oldest first
+func (u *ConcurrentUploader) QueuedUploads() []QueuedUpload {
+	u.stateMutex.Lock()
+	defer u.stateMutex.Unlock()
+
+	uploads := make([]QueuedUpload, 0, len(u.queued))
+	for path, queued := range u.queued {
+		uploads = append(uploads, QueuedUpload{Path: path, Queued: queued})
+	}
+	sort.Slice(uploads, func(i, j int) bool {
+		return uploads[i].Queued.Before(uploads[j].Queued)
+	})
+	return uploads
+}
+
+// Started uploads with their progress, oldest first
+func (u *ConcurrentUploader) InFlightUploads() []InFlightUpload {
+	u.stateMutex.Lock()
+	defer u.stateMutex.Unlock()
+
+	uploads := make([]InFlightUpload, 0, len(u.inFlight))
+	for path, progress := range u.inFlight {
+		uploads = append(uploads, InFlightUpload{
+			Path:    path,
+			Size:    progress.size.Load(),
+			Sent:    progress.sent.Load(),
+			Started: progress.started,
+		})
+	}
+	sort.Slice(uploads, func(i, j int) bool {
+		return uploads[i].Started.Before(uploads[j].Started)
+	})
+	return uploads
+}
+
+func (u *ConcurrentUploader) startProgress(filePath string, fileSize int64) *uploadProgress {
+	progress := &uploadProgress{started: time.Now()}
+	progress.size.Store(fileSize)
+
+	u.stateMutex.Lock()
+	defer u.stateMutex.Unlock()
+	delete(u.queued, filePath)
+	u.inFlight[filePath] = progress
+	return progress
+}
+
+// Remove a queued upload that is not started
+func (u *ConcurrentUploader) dequeue(filePath string) {
+	u.stateMutex.Lock()
+	defer u.stateMutex.Unlock()
+	delete(u.queued, filePath)
+}
+
+func (u *ConcurrentUploader) endProgress(filePath string) {
+	u.stateMutex.Lock()
+	defer u.stateMutex.Unlock()
+	delete(u.inFlight, filePath)
+}
+
+// Pause the uploads: the started uploads go on, but the queued ones wait until Resume is called
+func (u *ConcurrentUploader) Pause() {
+	u.stateMutex.Lock()
+	defer u.stateMutex.Unlock()
+	if u.resumed == nil {
+		u.resumed = make(chan struct{})
+	}
+}
+
+// Resume the uploads paused by Pause
+func (u *ConcurrentUploader) Resume() {
+	u.stateMutex.Lock()
+	defer u.stateMutex.Unlock()
+	if u.resumed != nil {
+		close(u.resumed)
+		u.resumed = nil
+	}
+}
+
+// Tell whether the uploads are paused
+func (u *ConcurrentUploader) Paused() bool {
+	u.stateMutex.Lock()
+	defer u.stateMutex.Unlock()
+	return u.resumed != nil
+}
+
+func (u *ConcurrentUploader) waitWhilePaused() {
+	u.stateMutex.Lock()
+	resumed := u.resumed
+	u.stateMutex.Unlock()
+	if resumed == nil {
+		return
+	}
+	select {
+	case <-resumed:
+	case <-u.closed:
+	}
+}
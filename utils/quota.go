@@ -0,0 +1,185 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/GaPhi/gphotosuploader/api"
+)
+
+// What the uploader does when the queued uploads don't fit in the storage left
+type QuotaPolicy int
+
+const (
+	// Upload anyway, Google will refuse the files that don't fit
+	QuotaIgnore QuotaPolicy = iota
+
+	// Upload anyway, but send a QuotaStatus on the QuotaExceeded channel
+	QuotaWarn
+
+	// Send a QuotaStatus on the QuotaExceeded channel and refuse the uploads that don't fit
+	QuotaRefuse
+)
+
+// Parse a quota policy name (off, warn or refuse)
+func ParseQuotaPolicy(name string) (QuotaPolicy, error) {
+	switch name {
+	case "off":
+		return QuotaIgnore, nil
+	case "warn":
+		return QuotaWarn, nil
+	case "refuse":
+		return QuotaRefuse, nil
+	}
+	return QuotaIgnore, fmt.Errorf("unknown quota policy '%v' (off, warn or refuse)", name)
+}
+
+// Storage of the user compared with the size of the queued uploads
+type QuotaStatus struct {
+	// Storage used and total storage, in bytes. Total is <= 0 when unknown
+	Used  int64
+	Total int64
+
+	// Size of the queued uploads, in bytes
+	Pending int64
+}
+
+// Storage left, in bytes
+func (s QuotaStatus) Left() int64 {
+	return s.Total - s.Used
+}
+
+// True if the queued uploads fit in the storage left
+func (s QuotaStatus) Fits() bool {
+	return s.Total <= 0 || s.Used+s.Pending <= s.Total
+}
+
+func (s QuotaStatus) String() string {
+	return fmt.Sprintf("%v bytes to upload, %v bytes left (%v/%v used)", s.Pending, s.Left(), s.Used, s.Total)
+}
+
+// Set what the uploader does when the queued uploads don't fit in the storage left
+func (u *ConcurrentUploader) SetQuotaPolicy(policy QuotaPolicy) {
+	u.quotaPolicy = policy
+}
+
+// Query the storage of the user and compare it with the size of the queued uploads plus the given number of bytes.
+// Use it before enqueuing many files
+func (u *ConcurrentUploader) CheckQuota(extraBytes int64) (QuotaStatus, error) {
+	used, total, err := api.QueryStorage(u.credentials)
+	if err != nil {
+		return QuotaStatus{}, err
+	}
+
+	u.quotaMutex.Lock()
+	u.storageUsed, u.storageTotal = used, total
+	u.quotaMutex.Unlock()
+
+	return QuotaStatus{
+		Used:    used,
+		Total:   total,
+		Pending: u.pendingBytes.Load() + extraBytes,
+	}, nil
+}
+
+// Last known storage used and total storage, in bytes. Total is <= 0 when unknown (the storage is queried by
+// CheckQuota and StartQuotaMonitor)
+func (u *ConcurrentUploader) Storage() (used int64, total int64) {
+	u.quotaMutex.Lock()
+	defer u.quotaMutex.Unlock()
+	return u.storageUsed, u.storageTotal
+}
+
+// Periodically query the storage of the user, until the uploader is closed. A QuotaStatus is sent on the QuotaExceeded
+// channel each time the queued uploads don't fit
+func (u *ConcurrentUploader) StartQuotaMonitor(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				status, err := u.CheckQuota(0)
+				if err != nil {
+					log.Printf("uploader: Can't query storage (%v)\n", err)
+				} else if !status.Fits() {
+					u.notifyQuotaExceeded(status)
+				}
+			case <-u.closed:
+				return
+			}
+		}
+	}()
+}
+
+// Check, with the last known storage, that a new upload fits. It returns false if the upload must be refused
+func (u *ConcurrentUploader) reserveQuota(fileSize int64) bool {
+	u.quotaMutex.Lock()
+	status := QuotaStatus{
+		Used:    u.storageUsed,
+		Total:   u.storageTotal,
+		Pending: u.pendingBytes.Load() + fileSize,
+	}
+	exceeded := u.quotaPolicy != QuotaIgnore && !status.Fits()
+
+	// Notify only the first upload that doesn't fit, not all the following ones
+	notify := exceeded && !u.quotaNotified
+	u.quotaNotified = exceeded
+	u.quotaMutex.Unlock()
+
+	if notify {
+		u.notifyQuotaExceeded(status)
+	}
+	if exceeded && u.quotaPolicy == QuotaRefuse {
+		return false
+	}
+
+	u.pendingBytes.Add(fileSize)
+	return true
+}
+
+// Update the reservation of an upload once the size really uploaded is known (after the compression, or if the file
+// changed since it was queued). It returns false if the upload must be refused, the first reservation being kept
+func (u *ConcurrentUploader) resizeQuota(reservedSize int64, fileSize int64) bool {
+	if fileSize <= reservedSize {
+		u.pendingBytes.Add(fileSize - reservedSize)
+		return true
+	}
+	return u.reserveQuota(fileSize - reservedSize)
+}
+
+// Release the size of a finished upload, adding it to the used storage if it has been uploaded
+func (u *ConcurrentUploader) releaseQuota(fileSize int64, uploaded bool) {
+	u.pendingBytes.Add(-fileSize)
+	if uploaded {
+		u.quotaMutex.Lock()
+		u.storageUsed += fileSize
+		u.quotaMutex.Unlock()
+	}
+}
+
+// Update the last known storage after a failure due to a full storage
+func (u *ConcurrentUploader) quotaExceeded(err *api.QuotaExceededError) {
+	u.quotaMutex.Lock()
+	u.storageUsed, u.storageTotal = err.Used, err.Total
+	u.quotaMutex.Unlock()
+
+	u.notifyQuotaExceeded(QuotaStatus{
+		Used:    err.Used,
+		Total:   err.Total,
+		Pending: u.pendingBytes.Load(),
+	})
+}
+
+// Send the status on the QuotaExceeded channel, unless the quota is ignored. The channel is optional: the status is
+// dropped when a previous one has not been received yet
+func (u *ConcurrentUploader) notifyQuotaExceeded(status QuotaStatus) {
+	if u.quotaPolicy == QuotaIgnore {
+		return
+	}
+	select {
+	case u.QuotaExceeded <- status:
+	default:
+	}
+}
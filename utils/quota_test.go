@@ -0,0 +1,44 @@
+package utils
+
+import "testing"
+
+func TestQuotaReservation(t *testing.T) {
+	u := &ConcurrentUploader{
+		quotaPolicy:   QuotaRefuse,
+		storageUsed:   100,
+		storageTotal:  200,
+		QuotaExceeded: make(chan QuotaStatus, 1),
+	}
+
+	if !u.reserveQuota(80) || u.pendingBytes.Load() != 80 {
+		t.Fatalf("reservation refused, %v bytes pending", u.pendingBytes.Load())
+	}
+	if u.reserveQuota(30) {
+		t.Fatal("reservation over the quota accepted")
+	}
+	if status := <-u.QuotaExceeded; status.Pending != 110 || status.Left() != 100 {
+		t.Errorf("got status %v", status)
+	}
+
+	// The compressed file is smaller: the difference is released, and another file fits
+	if !u.resizeQuota(80, 50) || u.pendingBytes.Load() != 50 {
+		t.Fatalf("resize refused, %v bytes pending", u.pendingBytes.Load())
+	}
+	if !u.reserveQuota(30) || u.pendingBytes.Load() != 80 {
+		t.Fatalf("reservation refused, %v bytes pending", u.pendingBytes.Load())
+	}
+
+	// The file grew since it was queued: only the difference is reserved
+	if !u.resizeQuota(30, 45) || u.pendingBytes.Load() != 95 {
+		t.Fatalf("resize refused, %v bytes pending", u.pendingBytes.Load())
+	}
+	if u.resizeQuota(45, 60) || u.pendingBytes.Load() != 95 {
+		t.Fatalf("resize over the quota accepted, %v bytes pending", u.pendingBytes.Load())
+	}
+
+	u.releaseQuota(50, true)
+	u.releaseQuota(45, false)
+	if used, _ := u.Storage(); used != 150 || u.pendingBytes.Load() != 0 {
+		t.Errorf("got %v bytes used and %v bytes pending", used, u.pendingBytes.Load())
+	}
+}
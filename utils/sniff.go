@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+)
+
+// ISO base media file brands of the images, all the other brands are videos
+var bmffImageBrands = map[string]string{
+	"heic": "image/heic",
+	"heix": "image/heic",
+	"heim": "image/heic",
+	"heis": "image/heic",
+	"hevc": "image/heic-sequence",
+	"hevx": "image/heic-sequence",
+	"mif1": "image/heif",
+	"msf1": "image/heif-sequence",
+	"avif": "image/avif",
+	"avis": "image/avif-sequence",
+	"crx ": "image/x-canon-cr3",
+}
+
+// Detect the type of a photo or video from its first bytes (at least 512 bytes should be given). It knows all the
+// formats accepted by Google Photos and returns an empty string for the other ones
+func SniffMediaType(header []byte) string {
+	hasPrefix := func(offset int, prefix string) bool {
+		return len(header) >= offset+len(prefix) && string(header[offset:offset+len(prefix)]) == prefix
+	}
+
+	switch {
+	// Images
+	case hasPrefix(0, "\xFF\xD8\xFF"):
+		return "image/jpeg"
+	case hasPrefix(0, "\x89PNG\r\n\x1a\n"):
+		return "image/png"
+	case hasPrefix(0, "GIF87a"), hasPrefix(0, "GIF89a"):
+		return "image/gif"
+	case hasPrefix(0, "RIFF") && hasPrefix(8, "WEBP"):
+		return "image/webp"
+	case hasPrefix(0, "BM") && len(header) >= 14 && binary.LittleEndian.Uint32(header[10:]) < 1<<16:
+		return "image/bmp"
+	case hasPrefix(0, "\x00\x00\x01\x00"):
+		return "image/x-icon"
+
+	// Raw images (most of them are TIFF files)
+	case hasPrefix(0, "FUJIFILMCCD-RAW"):
+		return "image/x-fuji-raf"
+	case hasPrefix(0, "II\x1a\x00\x00\x00HEAPCCDR"):
+		return "image/x-canon-crw"
+	case hasPrefix(0, "IIRO"), hasPrefix(0, "IIRS"), hasPrefix(0, "MMOR"):
+		return "image/x-olympus-orf"
+	case hasPrefix(0, "IIU\x00"):
+		return "image/x-panasonic-rw2"
+	case hasPrefix(0, "II*\x00") && hasPrefix(8, "CR"):
+		return "image/x-canon-cr2"
+	case hasPrefix(0, "II*\x00"), hasPrefix(0, "MM\x00*"):
+		return "image/tiff"
+
+	// ISO base media files: HEIF, AVIF and CR3 images, MP4, QuickTime and 3GP videos
+	case hasPrefix(4, "ftyp") && len(header) >= 12:
+		return sniffBmffBrands(header)
+	case hasPrefix(4, "moov"), hasPrefix(4, "mdat"), hasPrefix(4, "wide"), hasPrefix(4, "free"), hasPrefix(4, "skip"):
+		return "video/quicktime"
+
+	// Other videos
+	case hasPrefix(0, "RIFF") && hasPrefix(8, "AVI "):
+		return "video/x-msvideo"
+	case hasPrefix(0, "\x30\x26\xB2\x75\x8E\x66\xCF\x11"):
+		return "video/x-ms-asf"
+	case hasPrefix(0, "\x1A\x45\xDF\xA3"):
+		if bytes.Contains(header, []byte("webm")) {
+			return "video/webm"
+		}
+		return "video/x-matroska"
+	case hasPrefix(0, "\x00\x00\x01\xBA"), hasPrefix(0, "\x00\x00\x01\xB3"):
+		return "video/mpeg"
+	case len(header) > 188 && header[0] == 0x47 && header[188] == 0x47:
+		return "video/mp2t"
+	case len(header) > 196 && header[4] == 0x47 && header[196] == 0x47:
+		// BDAV stream (M2TS, MTS) with a 4 bytes timecode before each packet
+		return "video/mp2t"
+	}
+	return ""
+}
+
+// Detect the type of an ISO base media file from its major and compatible brands
+func sniffBmffBrands(header []byte) string {
+	size := int(binary.BigEndian.Uint32(header))
+	if size < 16 || size > len(header) {
+		size = len(header)
+	}
+	brands := []string{string(header[8:12])}
+	for offset := 16; offset+4 <= size; offset += 4 {
+		brands = append(brands, string(header[offset:offset+4]))
+	}
+
+	for _, brand := range brands {
+		if mime, found := bmffImageBrands[brand]; found {
+			return mime
+		}
+	}
+	switch {
+	case brands[0] == "qt  ":
+		return "video/quicktime"
+	case strings.HasPrefix(brands[0], "3gp"):
+		return "video/3gpp"
+	case strings.HasPrefix(brands[0], "3g2"):
+		return "video/3gpp2"
+	}
+	return "video/mp4"
+}
@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Header of an ISO base media file with its major and compatible brands
+func ftypHeader(brands ...string) []byte {
+	header := make([]byte, 8, 16+4*len(brands))
+	binary.BigEndian.PutUint32(header, uint32(16+4*(len(brands)-1)))
+	copy(header[4:], "ftyp")
+	header = append(header, brands[0]...)
+	header = append(header, 0, 0, 0, 0)
+	for _, brand := range brands[1:] {
+		header = append(header, brand...)
+	}
+	return append(header, "\x00\x00\x00\x08free"...)
+}
+
+// Transport stream of two packets, with an optional timecode before each of them
+func transportStream(timecode int) []byte {
+	data := make([]byte, 2*(188+timecode))
+	data[timecode], data[188+2*timecode] = 0x47, 0x47
+	return data
+}
+
+func TestSniffMediaType(t *testing.T) {
+	bmp := []byte("BM\x00\x00\x00\x00\x00\x00\x00\x00\x36\x00\x00\x00")
+	tests := []struct {
+		header []byte
+		mime   string
+	}{
+		{[]byte("\xFF\xD8\xFF\xE0\x00\x10JFIF"), "image/jpeg"},
+		{[]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"), "image/png"},
+		{[]byte("GIF89a"), "image/gif"},
+		{[]byte("RIFF\x00\x00\x00\x00WEBPVP8 "), "image/webp"},
+		{bmp, "image/bmp"},
+		{[]byte("BM not a bitmap"), ""},
+		{[]byte("\x00\x00\x01\x00\x01\x00"), "image/x-icon"},
+		{[]byte("FUJIFILMCCD-RAW 0201"), "image/x-fuji-raf"},
+		{[]byte("II\x1a\x00\x00\x00HEAPCCDR"), "image/x-canon-crw"},
+		{[]byte("IIRO\x08\x00\x00\x00"), "image/x-olympus-orf"},
+		{[]byte("IIU\x00\x08\x00\x00\x00"), "image/x-panasonic-rw2"},
+		{[]byte("II*\x00\x10\x00\x00\x00CR\x02\x00"), "image/x-canon-cr2"},
+		{[]byte("II*\x00\x08\x00\x00\x00"), "image/tiff"},
+		{[]byte("MM\x00*\x00\x00\x00\x08"), "image/tiff"},
+		{ftypHeader("heic", "mif1", "heic"), "image/heic"},
+		{ftypHeader("mif1", "mif1", "miaf"), "image/heif"},
+		{ftypHeader("avif", "avif", "mif1"), "image/avif"},
+		{ftypHeader("crx ", "crx ", "isom"), "image/x-canon-cr3"},
+		{ftypHeader("isom", "isom", "avc1"), "video/mp4"},
+		{ftypHeader("mp42", "isom", "heic"), "image/heic"},
+		{ftypHeader("qt  ", "qt  "), "video/quicktime"},
+		{ftypHeader("3gp5", "3gp5"), "video/3gpp"},
+		{ftypHeader("3g2a", "3g2a"), "video/3gpp2"},
+		{[]byte("\x00\x00\x00\x08wide\x00\x00\x00\x00mdat"), "video/quicktime"},
+		{[]byte("RIFF\x00\x00\x00\x00AVI LIST"), "video/x-msvideo"},
+		{[]byte("\x30\x26\xB2\x75\x8E\x66\xCF\x11\xA6\xD9"), "video/x-ms-asf"},
+		{[]byte("\x1A\x45\xDF\xA3\x9F\x42\x82\x84webm"), "video/webm"},
+		{[]byte("\x1A\x45\xDF\xA3\x9F\x42\x82\x88matroska"), "video/x-matroska"},
+		{[]byte("\x00\x00\x01\xBA\x44\x00"), "video/mpeg"},
+		{transportStream(0), "video/mp2t"},
+		{transportStream(4), "video/mp2t"},
+		{[]byte("%PDF-1.7"), ""},
+		{[]byte("<!DOCTYPE html>"), ""},
+		{[]byte{}, ""},
+		{[]byte("\x00\x00\x00\x10ftyp"), ""},
+	}
+	for _, test := range tests {
+		if mime := SniffMediaType(test.header); mime != test.mime {
+			t.Errorf("SniffMediaType(%q) = %q, want %q", test.header, mime, test.mime)
+		}
+	}
+}
+
+func TestIsImageOrVideo(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content []byte
+		media   bool
+	}{
+		{"photo.JPG", []byte("not even a JPEG"), true},
+		{"video.mkv", nil, true},
+		{"photo", []byte("\xFF\xD8\xFF\xE1\x00\x10Exif"), true},
+		{"clip.bin", ftypHeader("isom", "isom"), true},
+		{"notes.txt", []byte("Some notes\n"), false},
+		{"page.html", []byte("<html><body></body></html>"), false},
+		{"empty", nil, false},
+	}
+	for _, test := range tests {
+		path := filepath.Join(dir, test.name)
+		if err := os.WriteFile(path, test.content, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if media, err := IsImageOrVideo(path); err != nil || media != test.media {
+			t.Errorf("IsImageOrVideo(%v) = %v, %v, want %v", test.name, media, err, test.media)
+		}
+	}
+	if _, err := IsImageOrVideo(filepath.Join(dir, "missing")); err == nil {
+		t.Error("no error for a missing file")
+	}
+}
+
+func TestExtensions(t *testing.T) {
+	var extensions Extensions
+	for _, value := range []string{"JPG, .Png", "", "txt,"} {
+		if err := extensions.Set(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := (Extensions{".jpg", ".png", ".txt"}); !reflect.DeepEqual(extensions, want) {
+		t.Errorf("got %v, want %v", extensions, want)
+	}
+	for path, contained := range map[string]bool{"a/b.jpg": true, "C.PNG": true, "notes.txt": true, "video.mp4": false,
+		"jpg": false} {
+		if extensions.Contains(path) != contained {
+			t.Errorf("Contains(%v) = %v", path, !contained)
+		}
+	}
+	if strings.Join(extensions, ",") != extensions.String() {
+		t.Errorf("String() = %v", extensions.String())
+	}
+}
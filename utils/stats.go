@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/GaPhi/gphotosuploader/api"
+	"github.com/GaPhi/gphotosuploader/auth"
+)
+
+// Statistics about the library of a user
+type LibraryStats struct {
+	// Storage used and total storage, in bytes
+	StorageUsed  int64 `json:"storageUsed"`
+	StorageTotal int64 `json:"storageTotal"`
+
+	// Number of media items, according to the timeline
+	MediaItems int64 `json:"mediaItems"`
+
+	// Number of photos and videos, according to the media items listing
+	Photos int64 `json:"photos"`
+	Videos int64 `json:"videos"`
+
+	// Number of unsupported media items
+	Unsupported int64 `json:"unsupported"`
+
+	// Media items by year and by month, from the oldest to the newest
+	Years  []PeriodStats `json:"years"`
+	Months []PeriodStats `json:"months"`
+}
+
+// Number of media items taken during a period (a year like "2024" or a month like "2024-08")
+type PeriodStats struct {
+	Period string `json:"period"`
+
+	// Media items taken during the period
+	MediaItems int64 `json:"mediaItems"`
+
+	// Media items taken until the end of the period (library growth)
+	Total int64 `json:"total"`
+}
+
+// Build the statistics of the library. All the media items are listed, which can take a while for big libraries
+func GetLibraryStats(credentials auth.CookieCredentials) (*LibraryStats, error) {
+	stats := &LibraryStats{}
+
+	var err error
+	stats.StorageUsed, stats.StorageTotal, err = api.QueryStorage(credentials)
+	if err != nil {
+		return nil, fmt.Errorf("can't get storage data (%v)", err)
+	}
+
+	timeline, err := api.GetWholeTimeline(credentials)
+	if err != nil {
+		return nil, fmt.Errorf("can't get timeline (%v)", err)
+	}
+	stats.Years, stats.Months = periodStats(timeline)
+	for _, entry := range timeline {
+		stats.MediaItems += entry.MediaCount
+	}
+
+	mediaItems := api.IterateMediaItemsBefore(credentials, nil, "")
+	defer mediaItems.Close()
+	for mediaItems.Next() {
+		if mediaItems.Item().IsVideo {
+			stats.Videos++
+		} else {
+			stats.Photos++
+		}
+	}
+	if err := mediaItems.Err(); err != nil {
+		return nil, fmt.Errorf("can't list media items (%v)", err)
+	}
+
+	unsupported, err := api.ListAllUnsupportedMediaItemsBefore(credentials, nil)
+	if err != nil {
+		return nil, fmt.Errorf("can't list unsupported media items (%v)", err)
+	}
+	stats.Unsupported = int64(len(unsupported))
+
+	return stats, nil
+}
+
+func periodStats(timeline []api.TimelineEntry) ([]PeriodStats, []PeriodStats) {
+	years := map[string]int64{}
+	months := map[string]int64{}
+	for _, entry := range timeline {
+		date := time.Unix(0, entry.From*1000000).Local()
+		years[date.Format("2006")] += entry.MediaCount
+		months[date.Format("2006-01")] += entry.MediaCount
+	}
+	return sortedPeriodStats(years), sortedPeriodStats(months)
+}
+
+func sortedPeriodStats(counts map[string]int64) []PeriodStats {
+	stats := make([]PeriodStats, 0, len(counts))
+	for period, count := range counts {
+		stats = append(stats, PeriodStats{Period: period, MediaItems: count})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Period < stats[j].Period
+	})
+
+	var total int64
+	for i := range stats {
+		total += stats[i].MediaItems
+		stats[i].Total = total
+	}
+	return stats
+}
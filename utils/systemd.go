@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Send a state (like "READY=1" or "WATCHDOG=1") to systemd, through the socket given by the NOTIFY_SOCKET environment
+// variable. It does nothing when the process has not been started by systemd with a notify service
+func SdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	if socket[0] == '@' {
+		// Abstract socket
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer func(conn *net.UnixConn) {
+		_ = conn.Close()
+	}(conn)
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// Interval of the watchdog of systemd (WatchdogSec of the service), or 0 if the watchdog is not enabled for this process
+func SdWatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// Ping the watchdog of systemd at half its interval, until the stop channel is closed. It does nothing if the watchdog
+// is not enabled
+func StartSdWatchdog(stop chan struct{}) {
+	interval := SdWatchdogInterval()
+	if interval == 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				_ = SdNotify("WATCHDOG=1")
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
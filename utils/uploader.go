@@ -1,11 +1,14 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/GaPhi/gphotosuploader/api"
 	"github.com/GaPhi/gphotosuploader/auth"
@@ -15,54 +18,131 @@ import (
 type ConcurrentUploader struct {
 	credentials auth.CookieCredentials
 
-	// Optional field to specify the destination album
-	albumId string
+	// Optional field to specify the destination album of each file
+	albums AlbumResolver
 
 	// Buffered channel to limit concurrent uploads
 	concurrentLimiter chan bool
 
-	// Map of uploaded files (used as a set)
+	// Map of uploaded files (used as a set), protected by the stateMutex
 	uploadedFiles map[string]bool
 
 	// Waiting group used for the implementation of the Wait method
 	waitingGroup sync.WaitGroup
 
 	// Flag to indicate if the client is waiting for all the upload to finish
-	waiting bool
+	waiting atomic.Bool
 
 	// Flag to indicate that no other upload shall be attempted
-	stopUploads bool
+	stopUploads atomic.Bool
 
-	CompletedUploads chan string
-	IgnoredUploads   chan string
+	// Quota check: policy, last known storage and size of the queued uploads
+	quotaPolicy   QuotaPolicy
+	quotaMutex    sync.Mutex
+	storageUsed   int64
+	storageTotal  int64
+	quotaNotified bool
+	pendingBytes  atomic.Int64
+
+	// Rules of the files to compress before uploading them
+	compressionRules CompressionRules
+
+	// Extensions always uploaded, and never uploaded, whatever the content of the files
+	includedExtensions Extensions
+	excludedExtensions Extensions
+
+	// Sources of the timestamps of the uploaded files, by precedence
+	timestampSources []api.TimestampSource
+
+	// Queued uploads waiting for their turn, and started uploads with their progress, by path. The uploaded files are
+	// also protected by the stateMutex, since the control server reads them
+	stateMutex sync.Mutex
+	queued     map[string]time.Time
+	inFlight   map[string]*uploadProgress
+
+	// Closed when the paused uploads are resumed, nil when the uploads are not paused
+	resumed chan struct{}
+
+	// Closed when the uploader is closed
+	closed chan struct{}
+
+	CompletedUploads chan CompletedUpload
+	IgnoredUploads   chan IgnoredUpload
 	Errors           chan error
+	QuotaExceeded    chan QuotaStatus
 }
 
 // Creates a new ConcurrentUploader using the specified credentials.
-// The second argument is the id of the album in which images are going to be added when uploaded. Use an empty string
-// if you don't want to move the images in to a specific album. The third argument is the maximum number of concurrent
-// uploads (which must not be 0).
-func NewUploader(credentials auth.CookieCredentials, albumId string, maxConcurrentUploads int) (*ConcurrentUploader, error) {
+// The second argument resolves the album in which each image is going to be added when uploaded (use FixedAlbum for a
+// single album, or an AlbumMapper to choose the album from the file path). Use nil if you don't want to move the
+// images in to an album. The third argument is the maximum number of concurrent uploads (which must not be 0).
+func NewUploader(credentials auth.CookieCredentials, albums AlbumResolver, maxConcurrentUploads int) (*ConcurrentUploader, error) {
 	if maxConcurrentUploads <= 0 {
 		return nil, fmt.Errorf("maxConcurrentUploads must be greater than zero")
 	}
 
 	return &ConcurrentUploader{
 		credentials: credentials,
-		albumId:     albumId,
+		albums:      albums,
 
 		concurrentLimiter: make(chan bool, maxConcurrentUploads),
 
 		uploadedFiles: make(map[string]bool),
 
-		CompletedUploads: make(chan string),
-		IgnoredUploads:   make(chan string),
+		queued:   make(map[string]time.Time),
+		inFlight: make(map[string]*uploadProgress),
+
+		closed: make(chan struct{}),
+
+		CompletedUploads: make(chan CompletedUpload),
+		IgnoredUploads:   make(chan IgnoredUpload),
 		Errors:           make(chan error),
+		QuotaExceeded:    make(chan QuotaStatus, 1),
 	}, nil
 }
 
+// Stop the background tasks of the uploader (like the quota monitor)
+func (u *ConcurrentUploader) Close() {
+	close(u.closed)
+}
+
+// Stop the uploads: the queued uploads and the next ones are not attempted, and fail with the ErrorStopped class
+func (u *ConcurrentUploader) StopUploads() {
+	u.stopUploads.Store(true)
+}
+
+// Attempt the uploads again after they have been stopped, by StopUploads or by an upload error
+func (u *ConcurrentUploader) RestartUploads() {
+	u.stopUploads.Store(false)
+}
+
+// Tell whether the uploads are stopped, by StopUploads or by an upload error
+func (u *ConcurrentUploader) Stopped() bool {
+	return u.stopUploads.Load()
+}
+
+// Set the rules of the files to compress before uploading them. The first rule that applies to a file is used
+func (u *ConcurrentUploader) SetCompressionRules(rules CompressionRules) {
+	u.compressionRules = rules
+}
+
+// Set the extensions of the files always uploaded (even if they don't look like photos or videos) and of the files
+// never uploaded
+func (u *ConcurrentUploader) SetExtensionFilter(included Extensions, excluded Extensions) {
+	u.includedExtensions = included
+	u.excludedExtensions = excluded
+}
+
+// Set the sources of the timestamps of the uploaded files, by precedence. The modification time of the files is used
+// when none of the sources has a timestamp
+func (u *ConcurrentUploader) SetTimestampSources(sources []api.TimestampSource) {
+	u.timestampSources = sources
+}
+
 // Add files to the list of already uploaded files
 func (u *ConcurrentUploader) AddUploadedFiles(files ...string) {
+	u.stateMutex.Lock()
+	defer u.stateMutex.Unlock()
 	for _, name := range files {
 		u.uploadedFiles[name] = true
 	}
@@ -71,9 +151,9 @@ func (u *ConcurrentUploader) AddUploadedFiles(files ...string) {
 // Enqueue a new upload. You must not call this method while waiting for some uploads to finish (The method return an
 // error if you try to do it).
 // Due to the fact that this method is asynchronous, if nil is return it doesn't mean the the upload was completed:
-// for that use the Errors and CompletedUploads channels
+// for that use the Errors and CompletedUploads channels. The errors sent on the Errors channel are *UploadError
 func (u *ConcurrentUploader) EnqueueUpload(filePath string) error {
-	if u.waiting {
+	if u.waiting.Load() {
 		return fmt.Errorf("can't add new uploads while waiting queued uploads to finish")
 	}
 
@@ -88,44 +168,127 @@ func (u *ConcurrentUploader) EnqueueUpload(filePath string) error {
 	}
 
 	if u.wasFileAlreadyUploaded(filePath) {
-		u.IgnoredUploads <- filePath
+		u.IgnoredUploads <- IgnoredUpload{Path: filePath, Reason: IgnoredAlreadyUploaded}
+		return nil
+	}
+	if u.isFileQueued(filePath) {
+		u.IgnoredUploads <- IgnoredUpload{Path: filePath, Reason: IgnoredAlreadyQueued}
 		return nil
 	}
 
-	// Check if the file is an image or a video
-	if valid, err := IsImageOrVideo(filePath); err != nil {
-		u.sendError(filePath, err)
+	// Check if the file is an image or a video, unless its extension is included or excluded
+	if u.excludedExtensions.Contains(filePath) {
+		u.IgnoredUploads <- IgnoredUpload{Path: filePath, Reason: IgnoredExcludedExtension}
 		return nil
-	} else if !valid {
-		u.IgnoredUploads <- filePath
+	}
+	if !u.includedExtensions.Contains(filePath) {
+		if valid, err := IsImageOrVideo(filePath); err != nil {
+			u.sendError(filePath, ErrorFile, err)
+			return nil
+		} else if !valid {
+			u.IgnoredUploads <- IgnoredUpload{Path: filePath, Reason: IgnoredNotMedia}
+			return nil
+		}
+	}
+
+	if u.stopUploads.Load() {
+		u.sendError(filePath, ErrorStopped, fmt.Errorf("stopping uploads"))
 		return nil
 	}
 
-	if u.stopUploads {
-		u.Errors <- fmt.Errorf("stopping uploads (%v)", filePath)
+	// Check that the file fits in the storage left
+	info, err := os.Stat(filePath)
+	if err != nil {
+		u.sendError(filePath, ErrorFile, err)
+		return nil
+	}
+	if !u.reserveQuota(info.Size()) {
+		u.sendError(filePath, ErrorQuota, fmt.Errorf("not enough storage left"))
+		return nil
+	}
+
+	// The file may have been enqueued by another goroutine (a rescan or the control server) in the meantime
+	if !u.addQueued(filePath) {
+		u.releaseQuota(info.Size(), false)
+		u.IgnoredUploads <- IgnoredUpload{Path: filePath, Reason: IgnoredAlreadyQueued}
 		return nil
 	}
 
 	started := make(chan bool)
-	go u.uploadFile(filePath, started)
+	go u.uploadFile(filePath, info.Size(), started)
 	<-started
 
 	return nil
 }
 
+// Check if a file has already been uploaded
+func (u *ConcurrentUploader) WasFileUploaded(filePath string) bool {
+	if abs, err := filepath.Abs(filePath); err == nil {
+		filePath = abs
+	}
+	return u.wasFileAlreadyUploaded(filePath)
+}
+
 func (u *ConcurrentUploader) wasFileAlreadyUploaded(filePath string) bool {
+	u.stateMutex.Lock()
+	defer u.stateMutex.Unlock()
 	_, uploaded := u.uploadedFiles[filePath]
 	return uploaded
 }
 
-func (u *ConcurrentUploader) uploadFile(filePath string, started chan bool) {
+// Check if a file is queued or being uploaded
+func (u *ConcurrentUploader) IsFileQueued(filePath string) bool {
+	if abs, err := filepath.Abs(filePath); err == nil {
+		filePath = abs
+	}
+	return u.isFileQueued(filePath)
+}
+
+func (u *ConcurrentUploader) isFileQueued(filePath string) bool {
+	u.stateMutex.Lock()
+	defer u.stateMutex.Unlock()
+	_, queued := u.queued[filePath]
+	_, inFlight := u.inFlight[filePath]
+	return queued || inFlight
+}
+
+// Add a file to the queued uploads, unless it is already queued or being uploaded
+func (u *ConcurrentUploader) addQueued(filePath string) bool {
+	u.stateMutex.Lock()
+	defer u.stateMutex.Unlock()
+	_, queued := u.queued[filePath]
+	_, inFlight := u.inFlight[filePath]
+	if queued || inFlight {
+		return false
+	}
+	u.queued[filePath] = time.Now()
+	return true
+}
+
+func (u *ConcurrentUploader) uploadFile(filePath string, fileSize int64, started chan bool) {
 	u.joinGroupAndWaitForTurn(started)
 	defer u.leaveGroupAndNotifyNextUpload()
 
+	uploaded := false
+	defer func() {
+		u.releaseQuota(fileSize, uploaded)
+	}()
+
+	// The uploads may have been stopped while waiting: don't compress the file nor create its album
+	if u.stopUploads.Load() {
+		u.dequeue(filePath)
+		u.sendError(filePath, ErrorStopped, fmt.Errorf("stopping uploads"))
+		return
+	}
+
+	progress := u.startProgress(filePath, fileSize)
+	defer u.endProgress(filePath)
+	start := time.Now()
+
 	// Open the file
 	file, err := os.Open(filePath)
 	if err != nil {
-		u.sendError(filePath, err)
+		u.sendError(filePath, ErrorFile, err)
 		return
 	}
 	defer func(file *os.File) {
@@ -133,34 +296,85 @@ func (u *ConcurrentUploader) uploadFile(filePath string, started chan bool) {
 	}(file)
 
 	// Create options
-	options, err := api.NewUploadOptionsFromFile(file)
+	options, err := api.NewUploadOptionsFromFile(file, u.timestampSources...)
 	if err != nil {
-		u.sendError(filePath, err)
+		u.sendError(filePath, ErrorFile, err)
 		return
 	}
-	options.AlbumId = u.albumId
+	// Compress the file if needed: the compressed file replaces the original one, with the same name and timestamp
+	if rule := u.compressionRules.Match(filePath, options.FileSize); rule != nil {
+		if compressed, err := rule.Compress(file); err != nil {
+			log.Printf("uploader: Can't compress '%v', uploading the original file. Error: %v\n", filePath, err)
+		} else if compressed != nil {
+			defer func(compressed *os.File) {
+				_ = compressed.Close()
+				_ = os.Remove(compressed.Name())
+			}(compressed)
+			if info, err := compressed.Stat(); err == nil {
+				options.Stream = compressed
+				options.FileSize = info.Size()
+			}
+		}
+	}
+
+	if u.albums != nil {
+		options.AlbumId, err = u.albums.ResolveAlbum(filePath)
+		if err != nil {
+			u.sendError(filePath, ErrorAlbum, err)
+			return
+		}
+	}
 
-	// Create a new upload
+	// The storage was reserved with the size of the file when it was queued: reserve the size really uploaded
+	if !u.resizeQuota(fileSize, options.FileSize) {
+		u.sendError(filePath, ErrorQuota, fmt.Errorf("not enough storage left"))
+		return
+	}
+	fileSize = options.FileSize
+
+	// Create a new upload, counting the bytes sent
+	progress.size.Store(options.FileSize)
+	options.Stream = &progressReader{reader: options.Stream, sent: &progress.sent}
 	upload, err := api.NewUpload(options, u.credentials)
 	if err != nil {
-		u.sendError(filePath, err)
+		u.sendError(filePath, ErrorFile, err)
 		return
 	}
 
 	// Try to upload the image
-	if u.stopUploads {
-		u.sendError(filePath, fmt.Errorf("stopping uploads"))
-	} else if _, err := upload.Upload(); err != nil {
-		u.stopUploads = true
-		u.sendError(filePath, err)
+	if u.stopUploads.Load() {
+		u.sendError(filePath, ErrorStopped, fmt.Errorf("stopping uploads"))
+	} else if result, err := upload.Upload(); err != nil {
+		u.stopUploads.Store(true)
+		var quotaErr *api.QuotaExceededError
+		if errors.As(err, &quotaErr) {
+			u.quotaExceeded(quotaErr)
+			u.sendError(filePath, ErrorQuota, err)
+		} else {
+			u.sendError(filePath, ErrorUpload, err)
+		}
 	} else {
+		uploaded = true
+		u.stateMutex.Lock()
 		u.uploadedFiles[filePath] = true
-		u.CompletedUploads <- filePath
+		u.stateMutex.Unlock()
+		u.CompletedUploads <- CompletedUpload{
+			Path:     filePath,
+			ImageID:  result.ImageID,
+			ImageUrl: result.ImageUrl,
+			Bytes:    options.FileSize,
+			Duration: time.Since(start),
+		}
 	}
 }
 
-func (u *ConcurrentUploader) sendError(filePath string, err error) {
-	u.Errors <- fmt.Errorf("Error with '%s': %s\n", filePath, err)
+// Send an upload error. Whatever failed, the requests refused by Google are authentication errors
+func (u *ConcurrentUploader) sendError(filePath string, class ErrorClass, err error) {
+	var authErr *api.AuthError
+	if errors.As(err, &authErr) {
+		class = ErrorAuth
+	}
+	u.Errors <- &UploadError{Path: filePath, Class: class, Err: err}
 }
 
 func (u *ConcurrentUploader) joinGroupAndWaitForTurn(started chan bool) {
@@ -171,6 +385,7 @@ func (u *ConcurrentUploader) joinGroupAndWaitForTurn(started chan bool) {
 	// Insert something in the channel. We remove values from it only when we complete an upload, blocking the
 	// goroutines if we exceed the maxConcurrentUpload
 	u.concurrentLimiter <- true
+	u.waitWhilePaused()
 }
 
 func (u *ConcurrentUploader) leaveGroupAndNotifyNextUpload() {
@@ -182,7 +397,7 @@ func (u *ConcurrentUploader) leaveGroupAndNotifyNextUpload() {
 
 // Blocks this goroutine until all the upload are completed. You can not add uploads when a goroutine call this method
 func (u *ConcurrentUploader) WaitUploadsCompleted() {
-	u.waiting = true
+	u.waiting.Store(true)
 	u.waitingGroup.Wait()
-	u.waiting = false
+	u.waiting.Store(false)
 }
@@ -2,31 +2,80 @@ package utils
 
 import (
 	"fmt"
+	"log"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/GaPhi/gphotosuploader/auth"
 	"github.com/tebeka/selenium"
+	"github.com/tebeka/selenium/chrome"
+	"github.com/tebeka/selenium/firefox"
 )
 
+// Options of the WebDriver wizard. The browser name and the WebDriver address that are not set are asked on the
+// standard input, unless a chromedriver is started
+type WebDriverOptions struct {
+	// Name of the browser (chrome, firefox, ...)
+	BrowserName string
+
+	// Address of the WebDriver (like http://localhost:9515)
+	DriverAddress string
+
+	// Path of a chromedriver executable to start on a free port, instead of connecting to DriverAddress
+	ChromeDriver string
+
+	// Profile directory of the browser, to reuse a profile already logged in Google Photos (chrome and firefox only)
+	ProfileDir string
+
+	// Run the browser without window (chrome and firefox only): the login can't be filled, so the profile must be
+	// already logged in
+	Headless bool
+
+	// Maximum time to wait for the login, 0 to wait forever
+	LoginTimeout time.Duration
+}
+
+// Tell whether the wizard can run without asking anything
+func (o WebDriverOptions) Scripted() bool {
+	return o.ChromeDriver != "" || o.BrowserName != "" && o.DriverAddress != ""
+}
+
 // Start a wizard that open a browser to let the user authenticate and return an auth.Credentials implementation
-func StartWebDriverCookieCredentialsWizard() (*auth.CookieCredentials, error) {
+func StartWebDriverCookieCredentialsWizard(options WebDriverOptions) (*auth.CookieCredentials, error) {
 	fmt.Print("\n-- WebDriver CookieCredentials Wizard --\n")
-	browserName, driverAddress := askBrowserAndDriverAddress()
+	if options.ChromeDriver != "" {
+		service, address, err := startChromeDriver(options.ChromeDriver)
+		if err != nil {
+			return nil, err
+		}
+		defer func(service *selenium.Service) {
+			_ = service.Stop()
+		}(service)
+		options.DriverAddress = address
+		if options.BrowserName == "" {
+			options.BrowserName = "chrome"
+		}
+	}
+	askBrowserAndDriverAddress(&options)
 
 	// Connect to the WebDriver
 	capabilities := selenium.Capabilities{
-		"browserName": browserName,
+		"browserName": options.BrowserName,
+	}
+	if err := addBrowserArgs(capabilities, options.BrowserName, options.ProfileDir, options.Headless); err != nil {
+		return nil, err
 	}
-	webDriver, err := selenium.NewRemote(capabilities, driverAddress)
+	webDriver, err := selenium.NewRemote(capabilities, options.DriverAddress)
 	if err != nil {
 		return nil, fmt.Errorf("can't initialize selenium library (%v)", err)
 	}
 	defer func(webDriver selenium.WebDriver) {
-		_ = webDriver.Close()
+		_ = webDriver.Quit()
 	}(webDriver)
 
-	if err := instructUserAndWaitForLogin(webDriver); err != nil {
+	if err := instructUserAndWaitForLogin(webDriver, options.LoginTimeout); err != nil {
 		return nil, err
 	}
 
@@ -42,21 +91,68 @@ func StartWebDriverCookieCredentialsWizard() (*auth.CookieCredentials, error) {
 	return credentials, err
 }
 
-func askBrowserAndDriverAddress() (string, string) {
-	var browserName string
-	var driverAddress string
+// Start a chromedriver listening on a free port of the loopback interface, and return its address
+func startChromeDriver(path string) (*selenium.Service, string, error) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return nil, "", fmt.Errorf("can't find a free port for chromedriver (%v)", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	_ = listener.Close()
+
+	log.Printf("Starting %v on port %v ...\n", path, port)
+	service, err := selenium.NewChromeDriverService(path, port)
+	if err != nil {
+		return nil, "", fmt.Errorf("can't start chromedriver (%v)", err)
+	}
+	return service, fmt.Sprintf("http://localhost:%d/wd/hub", port), nil
+}
 
-	fmt.Print("Please insert the name of the browser to use: ")
-	_, _ = fmt.Scanln(&browserName)
+// Make the browser use a profile directory, and run without window
+func addBrowserArgs(capabilities selenium.Capabilities, browserName string, profileDir string, headless bool) error {
+	if profileDir == "" && !headless {
+		return nil
+	}
+	switch strings.ToLower(browserName) {
+	case "chrome", "chromium":
+		var args []string
+		if profileDir != "" {
+			args = append(args, "--user-data-dir="+profileDir)
+		}
+		if headless {
+			args = append(args, "--headless=new")
+		}
+		capabilities.AddChrome(chrome.Capabilities{Args: args})
+	case "firefox":
+		var args []string
+		if profileDir != "" {
+			args = append(args, "-profile", profileDir)
+		}
+		if headless {
+			args = append(args, "-headless")
+		}
+		capabilities.AddFirefox(firefox.Capabilities{Args: args})
+	default:
+		return fmt.Errorf("can't use a browser profile or run headless with %v (only chrome and firefox)", browserName)
+	}
+	return nil
+}
 
-	fmt.Println("Insert the address of the WebDriver (example: http://localhost:9515): ")
-	_, _ = fmt.Scanln(&driverAddress)
+// Ask the browser name and the WebDriver address that are not set
+func askBrowserAndDriverAddress(options *WebDriverOptions) {
+	if options.BrowserName == "" {
+		fmt.Print("Please insert the name of the browser to use: ")
+		_, _ = fmt.Scanln(&options.BrowserName)
+	}
 
-	return browserName, driverAddress
+	if options.DriverAddress == "" {
+		fmt.Println("Insert the address of the WebDriver (example: http://localhost:9515): ")
+		_, _ = fmt.Scanln(&options.DriverAddress)
+	}
 }
 
-func instructUserAndWaitForLogin(webDriver selenium.WebDriver) error {
-	// Navigate to the Google Photos login page
+func instructUserAndWaitForLogin(webDriver selenium.WebDriver, timeout time.Duration) error {
+	// Navigate to the Google Photos login page, which redirects to the homepage if the profile is already logged in
 	if err := webDriver.Get(auth.LoginUrl); err != nil {
 		return fmt.Errorf("can't navigate to login page (%v)", err)
 	}
@@ -65,14 +161,19 @@ func instructUserAndWaitForLogin(webDriver selenium.WebDriver) error {
 	fmt.Println("\nA browser window should now appear with the Google Photos Login page.")
 	fmt.Println("Once you will be redirected to the Google Photos Homepage the browser will close automatically.")
 	fmt.Println("Please fill the form and login now")
-	loginCompleted := false
-	for !loginCompleted {
-		time.Sleep(1 * time.Second)
-
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	for {
 		url, _ := webDriver.CurrentURL()
-		if url == auth.HomeUrl {
-			loginCompleted = true
+		if url == auth.HomeUrl || strings.HasPrefix(url, auth.HomeUrl+"?") {
+			break
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return fmt.Errorf("the login has not been completed within %v", timeout)
 		}
+		time.Sleep(1 * time.Second)
 	}
 	fmt.Println("You should now be authenticated in the browser, now I'll try to get the cookies ...")
 	return nil
@@ -100,13 +201,18 @@ func SeleniumToGoCookies(seleniumCookies []selenium.Cookie) []*http.Cookie {
 
 // utility to convert a selenium cookie to a go http.Cookie
 func SeleniumToGoCookie(seleniumCookie selenium.Cookie) *http.Cookie {
-	return &http.Cookie{
+	cookie := &http.Cookie{
 		Name:   seleniumCookie.Name,
 		Domain: seleniumCookie.Domain,
 		Path:   seleniumCookie.Path,
 		Secure: seleniumCookie.Secure,
 		Value:  seleniumCookie.Value,
 	}
+	// The expiry of the session cookies is 0
+	if seleniumCookie.Expiry > 0 {
+		cookie.Expires = time.Unix(int64(seleniumCookie.Expiry), 0)
+	}
+	return cookie
 }
 
 func extractUserId(webDriver selenium.WebDriver) (string, error) {